@@ -0,0 +1,302 @@
+// Package baseline track accepted test failures. A baseline is a list of waivers, each accepting that a test of
+// the matching hosts fail with a given result, until an expiry date and for a documented reason. Evaluating test
+// results against a baseline mark waived failures as such, resurface the failures whose waiver expired, and
+// report the waivers that no longer match any failure.
+package baseline
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tigerwill90/observatory/types"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+)
+
+// DateLayout is the layout of waiver expiry dates.
+const DateLayout = "2006-01-02"
+
+const (
+	// StatusPass is the status of a test that passed.
+	StatusPass = "pass"
+	// StatusFail is the status of a failed test without waiver.
+	StatusFail = "fail"
+	// StatusWaived is the status of a failed test accepted by a waiver.
+	StatusWaived = "waived"
+	// StatusExpired is the status of a failed test whose waiver expired, which count as a failure.
+	StatusExpired = "expired"
+)
+
+var ErrInvalidBaseline = errors.New("invalid baseline")
+
+// Waiver accept that a test fail with a given result.
+type Waiver struct {
+	// glob pattern, as in path.Match, of the hosts the waiver apply to
+	Host string `yaml:"host" json:"host"`
+	// name of the test, such as content-security-policy
+	Test string `yaml:"test" json:"test"`
+	// accepted result of the test, such as csp-not-implemented
+	Result string `yaml:"result" json:"result"`
+	// last day the waiver apply, as YYYY-MM-DD in UTC
+	Expires string `yaml:"expires" json:"expires"`
+	// why the failure is accepted
+	Justification string `yaml:"justification" json:"justification"`
+	expires       time.Time
+}
+
+// UnmarshalYAML decode and validate a waiver.
+func (w *Waiver) UnmarshalYAML(value *yaml.Node) error {
+	type plain Waiver
+	if err := value.Decode((*plain)(w)); err != nil {
+		return err
+	}
+	return w.compile()
+}
+
+func (w *Waiver) compile() error {
+	switch {
+	case w.Host == "":
+		return fmt.Errorf("%w: waiver without host", ErrInvalidBaseline)
+	case w.Result == "":
+		return fmt.Errorf("%w: waiver of %s on %s without result", ErrInvalidBaseline, w.Test, w.Host)
+	case strings.TrimSpace(w.Justification) == "":
+		return fmt.Errorf("%w: waiver of %s on %s without justification", ErrInvalidBaseline, w.Test, w.Host)
+	}
+	if _, err := path.Match(w.Host, ""); err != nil {
+		return fmt.Errorf("%w: bad host pattern %q", ErrInvalidBaseline, w.Host)
+	}
+	if !types.IsTest(w.Test) {
+		return fmt.Errorf("%w: unknown test %q", ErrInvalidBaseline, w.Test)
+	}
+	expires, err := time.Parse(DateLayout, w.Expires)
+	if err != nil {
+		return fmt.Errorf("%w: waiver of %s on %s: expiry date must be YYYY-MM-DD", ErrInvalidBaseline, w.Test, w.Host)
+	}
+	w.expires = expires
+	return nil
+}
+
+// Expired return true if the waiver no longer apply at the given time. A waiver apply until the end of its
+// expiry day. The expiry date of a waiver that was not validated, see Baseline.Validate, is parsed on each call,
+// and the waiver is expired if the date is invalid.
+func (w *Waiver) Expired(now time.Time) bool {
+	expires := w.expires
+	if expires.IsZero() {
+		var err error
+		if expires, err = time.Parse(DateLayout, w.Expires); err != nil {
+			return true
+		}
+	}
+	return !now.Before(expires.AddDate(0, 0, 1))
+}
+
+// Match return true if the waiver apply to the test result of the host, regardless of its expiry date.
+func (w *Waiver) Match(host, test, result string) bool {
+	if w.Test != test || w.Result != result {
+		return false
+	}
+	return w.MatchHost(host)
+}
+
+// MatchHost return true if the host pattern of the waiver match the host.
+func (w *Waiver) MatchHost(host string) bool {
+	ok, _ := path.Match(w.Host, strings.ToLower(host))
+	return ok
+}
+
+// Baseline is a list of waivers.
+type Baseline struct {
+	Waivers []*Waiver `yaml:"waivers" json:"waivers"`
+}
+
+// Parse decode a YAML or JSON baseline and validate its waivers.
+func Parse(data []byte) (*Baseline, error) {
+	b := new(Baseline)
+	if err := yaml.Unmarshal(data, b); err != nil {
+		if errors.Is(err, ErrInvalidBaseline) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", ErrInvalidBaseline, err)
+	}
+	return b, nil
+}
+
+// Load read and parse the baseline file at path.
+func Load(path string) (*Baseline, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read baseline: %w", err)
+	}
+	return Parse(buf)
+}
+
+// Validate check the waivers of a baseline built in code rather than parsed, as Parse does: a known test, a result,
+// a justification and a valid host pattern and expiry date. The expiry dates are kept, so Expired no longer parse them.
+func (b *Baseline) Validate() error {
+	for _, w := range b.Waivers {
+		if err := w.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestOutcome is the status of a test of a scan.
+type TestOutcome struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	// one of StatusPass, StatusFail, StatusWaived or StatusExpired
+	Status string `json:"status"`
+	// waiver matching the failure, if any
+	Waiver *Waiver `json:"waiver,omitempty"`
+}
+
+// Failed return true if the test failed without a valid waiver.
+func (o TestOutcome) Failed() bool {
+	return o.Status == StatusFail || o.Status == StatusExpired
+}
+
+// Report hold the status of every test of a host, ordered by name.
+type Report struct {
+	Host  string        `json:"host"`
+	Tests []TestOutcome `json:"tests"`
+	// waivers of the host that match none of its failures
+	Unused []*Waiver `json:"unused,omitempty"`
+}
+
+// Evaluate evaluate the test results of a host at the given time. Tests without result are omitted. If b is
+// nil, every failure is a failure.
+func (b *Baseline) Evaluate(host string, tests *types.ScannerTestResult, now time.Time) *Report {
+	report := &Report{Host: host, Tests: make([]TestOutcome, 0)}
+	if tests == nil {
+		return report
+	}
+
+	used := make(map[*Waiver]bool)
+	for _, test := range tests.Summaries() {
+		if test.Result == "" {
+			continue
+		}
+		outcome := TestOutcome{Name: test.Name, Result: test.Result, Status: StatusPass}
+		if !test.Pass {
+			outcome.Status = StatusFail
+			if w := b.lookup(host, test.Name, test.Result, now); w != nil {
+				used[w] = true
+				outcome.Waiver = w
+				outcome.Status = StatusWaived
+				if w.Expired(now) {
+					outcome.Status = StatusExpired
+				}
+			}
+		}
+		report.Tests = append(report.Tests, outcome)
+	}
+
+	if b != nil {
+		for _, w := range b.Waivers {
+			if !used[w] && w.MatchHost(host) {
+				report.Unused = append(report.Unused, w)
+			}
+		}
+	}
+	return report
+}
+
+// lookup return the waiver matching the test result, preferring a waiver that did not expire.
+func (b *Baseline) lookup(host, test, result string, now time.Time) *Waiver {
+	if b == nil {
+		return nil
+	}
+	var expired *Waiver
+	for _, w := range b.Waivers {
+		if !w.Match(host, test, result) {
+			continue
+		}
+		if !w.Expired(now) {
+			return w
+		}
+		if expired == nil {
+			expired = w
+		}
+	}
+	return expired
+}
+
+// Unused return the waivers that are unused in at least one report and used in none. Waivers that do not
+// match the host of any report are not considered.
+func (b *Baseline) Unused(reports ...*Report) []*Waiver {
+	if b == nil {
+		return nil
+	}
+	used := make(map[*Waiver]bool)
+	candidates := make(map[*Waiver]bool)
+	for _, r := range reports {
+		for _, o := range r.Tests {
+			if o.Waiver != nil {
+				used[o.Waiver] = true
+			}
+		}
+		for _, w := range r.Unused {
+			candidates[w] = true
+		}
+	}
+
+	unused := make([]*Waiver, 0)
+	for _, w := range b.Waivers {
+		if candidates[w] && !used[w] {
+			unused = append(unused, w)
+		}
+	}
+	return unused
+}
+
+// Status return the status of a test, or an empty string if the test has no result or r is nil.
+func (r *Report) Status(test string) string {
+	if o, ok := r.Outcome(test); ok {
+		return o.Status
+	}
+	return ""
+}
+
+// Outcome return the outcome of a test.
+func (r *Report) Outcome(test string) (TestOutcome, bool) {
+	if r == nil {
+		return TestOutcome{}, false
+	}
+	for _, o := range r.Tests {
+		if o.Name == test {
+			return o, true
+		}
+	}
+	return TestOutcome{}, false
+}
+
+// Failures return the tests that failed without a valid waiver, including the ones whose waiver expired.
+func (r *Report) Failures() []TestOutcome {
+	return r.filter(func(o TestOutcome) bool { return o.Failed() })
+}
+
+// Waived return the failed tests accepted by a valid waiver.
+func (r *Report) Waived() []TestOutcome {
+	return r.filter(func(o TestOutcome) bool { return o.Status == StatusWaived })
+}
+
+// Expired return the failed tests whose waiver expired.
+func (r *Report) Expired() []TestOutcome {
+	return r.filter(func(o TestOutcome) bool { return o.Status == StatusExpired })
+}
+
+func (r *Report) filter(keep func(o TestOutcome) bool) []TestOutcome {
+	outcomes := make([]TestOutcome, 0)
+	if r == nil {
+		return outcomes
+	}
+	for _, o := range r.Tests {
+		if keep(o) {
+			outcomes = append(outcomes, o)
+		}
+	}
+	return outcomes
+}
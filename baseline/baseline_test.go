@@ -0,0 +1,110 @@
+package baseline
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory/types"
+	"testing"
+	"time"
+)
+
+const testBaseline = `
+waivers:
+  - host: "*.cdn.example.com"
+    test: content-security-policy
+    result: csp-not-implemented
+    expires: 2021-06-30
+    justification: the CDN can not set a CSP
+  - host: www.example.com
+    test: x-xss-protection
+    result: x-xss-protection-not-implemented
+    expires: 2021-03-31
+    justification: X-XSS-Protection is deprecated
+  - host: www.example.com
+    test: x-frame-options
+    result: x-frame-options-not-implemented
+    expires: 2021-12-31
+    justification: legacy iframe integration
+`
+
+func newTests() *types.ScannerTestResult {
+	tests := new(types.ScannerTestResult)
+	tests.ContentSecurityPolicy.Result = "csp-not-implemented"
+	tests.XXssProtection.Result = "x-xss-protection-not-implemented"
+	tests.XContentTypeOptions.Result = "x-content-type-options-nosniff"
+	tests.XContentTypeOptions.Pass = true
+	return tests
+}
+
+func TestEvaluate(t *testing.T) {
+	b, err := Parse([]byte(testBaseline))
+	require.Nil(t, err)
+	require.Len(t, b.Waivers, 3)
+
+	now := time.Date(2021, time.April, 1, 12, 0, 0, 0, time.UTC)
+	cdn := b.Evaluate("eu.cdn.example.com", newTests(), now)
+	assert.Equal(t, StatusWaived, cdn.Status(types.TestContentSecurityPolicy))
+	assert.Equal(t, StatusFail, cdn.Status(types.TestXXssProtection))
+	assert.Equal(t, StatusPass, cdn.Status(types.TestXContentTypeOptions))
+	assert.Equal(t, "", cdn.Status(types.TestXFrameOptions))
+	assert.Len(t, cdn.Failures(), 1)
+	assert.Empty(t, cdn.Unused)
+
+	www := b.Evaluate("www.example.com", newTests(), now)
+	assert.Equal(t, StatusFail, www.Status(types.TestContentSecurityPolicy))
+	assert.Equal(t, StatusExpired, www.Status(types.TestXXssProtection))
+	require.Len(t, www.Expired(), 1)
+	assert.Equal(t, "X-XSS-Protection is deprecated", www.Expired()[0].Waiver.Justification)
+	assert.Len(t, www.Failures(), 2)
+	assert.Empty(t, www.Waived())
+	require.Len(t, www.Unused, 1)
+	assert.Equal(t, types.TestXFrameOptions, www.Unused[0].Test)
+
+	// A waiver apply until the end of its expiry day.
+	www = b.Evaluate("www.example.com", newTests(), time.Date(2021, time.March, 31, 23, 59, 0, 0, time.UTC))
+	assert.Equal(t, StatusWaived, www.Status(types.TestXXssProtection))
+
+	assert.Equal(t, []*Waiver{b.Waivers[2]}, b.Unused(cdn, www))
+	assert.Len(t, b.Unused(cdn), 0)
+
+	var none *Baseline
+	report := none.Evaluate("www.example.com", newTests(), now)
+	assert.Len(t, report.Failures(), 2)
+	assert.Empty(t, none.Unused(report))
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name   string
+		waiver string
+	}{
+		{name: "missing host", waiver: "{test: cookies, result: cookies-without-secure-flag, expires: 2021-01-01, justification: x}"},
+		{name: "bad host pattern", waiver: "{host: '[', test: cookies, result: cookies-without-secure-flag, expires: 2021-01-01, justification: x}"},
+		{name: "unknown test", waiver: "{host: a.example.com, test: foo, result: bar, expires: 2021-01-01, justification: x}"},
+		{name: "missing result", waiver: "{host: a.example.com, test: cookies, expires: 2021-01-01, justification: x}"},
+		{name: "bad date", waiver: "{host: a.example.com, test: cookies, result: cookies-without-secure-flag, expires: 01/01/2021, justification: x}"},
+		{name: "missing justification", waiver: "{host: a.example.com, test: cookies, result: cookies-without-secure-flag, expires: 2021-01-01}"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse([]byte("waivers:\n  - " + tc.waiver + "\n"))
+			assert.ErrorIs(t, err, ErrInvalidBaseline)
+		})
+	}
+
+	b, err := Parse([]byte(`{"waivers": [{"host": "a.example.com", "test": "cookies", "result": "cookies-without-secure-flag", "expires": "2021-01-01", "justification": "x"}]}`))
+	require.Nil(t, err)
+	assert.False(t, b.Waivers[0].Expired(time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, b.Waivers[0].Expired(time.Date(2021, time.January, 2, 0, 0, 0, 0, time.UTC)))
+
+	b = &Baseline{Waivers: []*Waiver{{Host: "a.example.com", Test: "cookies", Result: "x", Expires: "2021", Justification: "x"}}}
+	assert.True(t, b.Waivers[0].Expired(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)))
+	assert.ErrorIs(t, b.Validate(), ErrInvalidBaseline)
+
+	// A waiver that was not validated is checked without being modified.
+	w := &Waiver{Host: "a.example.com", Test: "cookies", Result: "x", Expires: "2021-01-01", Justification: "x"}
+	assert.False(t, w.Expired(time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, w.Expired(time.Date(2021, time.January, 2, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, w.expires.IsZero())
+}
@@ -0,0 +1,180 @@
+package observatory
+
+import (
+	"context"
+	"errors"
+	"github.com/tigerwill90/observatory/logging"
+	"github.com/tigerwill90/observatory/telemetry"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned, possibly wrapped, when a call is not sent because the circuit breaker of the
+// endpoint is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// States of a circuit breaker, as reported by option.WithCircuitStateHook and telemetry.CircuitMeter.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return CircuitOpen
+	case breakerHalfOpen:
+		return CircuitHalfOpen
+	default:
+		return CircuitClosed
+	}
+}
+
+// outcome is the outcome of a request, as seen by a breaker.
+type outcome int
+
+const (
+	// the endpoint answered, even with an error other than 5xx
+	outcomeSuccess outcome = iota
+	// the endpoint failed with a 5xx response, a timeout or a connection error
+	outcomeFailure
+	// the request was canceled by the caller, which tell nothing about the endpoint
+	outcomeIgnored
+)
+
+func (o outcome) String() string {
+	switch o {
+	case outcomeFailure:
+		return "failure"
+	case outcomeIgnored:
+		return "ignored"
+	default:
+		return "success"
+	}
+}
+
+// breaker is a circuit breaker. It opens after threshold consecutive failures, then let a single probe request
+// through once the cooldown elapsed: the breaker closes if the probe succeed, and opens again otherwise.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+	// called on each state change, outside the lock, may be nil
+	onChange func(ctx context.Context, from, to breakerState)
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// newBreaker return a breaker, with the default threshold and cooldown for zero values.
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	return &breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow return true if a request can be sent. A true return must be followed by a call to done. A nil breaker
+// always allow.
+func (b *breaker) allow(ctx context.Context) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	from := b.state
+	allowed := true
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			allowed = false
+			break
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+	case breakerHalfOpen:
+		if b.probing {
+			allowed = false
+			break
+		}
+		b.probing = true
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(ctx, from, to)
+	return allowed
+}
+
+// done record the outcome of a request allowed by allow.
+func (b *breaker) done(ctx context.Context, o outcome) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	from := b.state
+	if b.state == breakerHalfOpen {
+		b.probing = false
+	}
+	switch o {
+	case outcomeSuccess:
+		b.state = breakerClosed
+		b.failures = 0
+	case outcomeFailure:
+		b.failures++
+		if b.state == breakerHalfOpen || b.failures >= b.threshold {
+			b.state = breakerOpen
+			b.openedAt = b.now()
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(ctx, from, to)
+}
+
+func (b *breaker) notify(ctx context.Context, from, to breakerState) {
+	if from != to && b.onChange != nil {
+		b.onChange(ctx, from, to)
+	}
+}
+
+// circuitChanged return the function reporting the state changes of the breaker of an endpoint to the logger,
+// the meter and the hook of the client.
+func (c *Client) circuitChanged(e *endpoint) func(ctx context.Context, from, to breakerState) {
+	return func(ctx context.Context, from, to breakerState) {
+		level := logging.LevelInfo
+		if to == breakerOpen {
+			level = logging.LevelWarn
+		}
+		if c.logEnabled(level) {
+			c.log(ctx, level, "circuit state changed",
+				logging.String("endpoint", e.name()),
+				logging.String("from", from.String()),
+				logging.String("to", to.String()),
+			)
+		}
+		if m, ok := c.meter.(telemetry.CircuitMeter); ok {
+			m.RecordCircuitState(ctx, e.name(), from.String(), to.String())
+		}
+		if c.circuitStateHook != nil {
+			c.circuitStateHook(e.name(), from.String(), to.String())
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package observatory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/tigerwill90/observatory/cache"
+	"github.com/tigerwill90/observatory/logging"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// assessmentLifetime is how long HTTP Observatory keep returning a finished scan instead of starting a new one.
+const assessmentLifetime = 24 * time.Hour
+
+// CacheStats return the hit and miss counts of the client cache. Both counts are zero if the
+// cache is not enabled.
+func (c *Client) CacheStats() cache.Stats {
+	return cache.Stats{
+		Hits:   atomic.LoadUint64(&c.cacheHits),
+		Misses: atomic.LoadUint64(&c.cacheMisses),
+	}
+}
+
+func (c *Client) cacheKey(apiCall string, params url.Values) string {
+	return fmt.Sprintf("%s/%s?%s", c.url, apiCall, params.Encode())
+}
+
+// cacheGet decode the cached value of key into v and report whether it was found.
+func (c *Client) cacheGet(ctx context.Context, key string, v interface{}) bool {
+	if c.cache == nil {
+		return false
+	}
+
+	buf, ok := c.cache.Get(key)
+	if ok && json.Unmarshal(buf, v) == nil {
+		atomic.AddUint64(&c.cacheHits, 1)
+		if c.logEnabled(logging.LevelDebug) {
+			c.log(ctx, logging.LevelDebug, "cache hit", logging.String("key", key))
+		}
+		return true
+	}
+	atomic.AddUint64(&c.cacheMisses, 1)
+	if c.logEnabled(logging.LevelDebug) {
+		c.log(ctx, logging.LevelDebug, "cache miss", logging.String("key", key))
+	}
+	return false
+}
+
+func (c *Client) cacheSet(key string, v interface{}, ttl time.Duration) {
+	if c.cache == nil || ttl < 0 {
+		return
+	}
+
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	c.cache.Set(key, buf, ttl)
+}
+
+func (c *Client) cacheDelete(key string) {
+	if c.cache == nil {
+		return
+	}
+	c.cache.Delete(key)
+}
+
+// cacheAssessment cache a finished assessment until it expire on HTTP Observatory side, or until the
+// configured ttl, whichever come first. Unfinished assessments evict any previous cached result.
+func (c *Client) cacheAssessment(host string, result *types.ScannerResult) {
+	key := c.assessmentKey(host)
+	if result.State != Finished {
+		c.cacheDelete(key)
+		return
+	}
+
+	ttl := c.assessmentTTL
+	if end, err := http.ParseTime(result.EndTime); err == nil {
+		if remaining := time.Until(end.Add(assessmentLifetime)); remaining < ttl {
+			ttl = remaining
+		}
+	}
+	if ttl <= 0 {
+		c.cacheDelete(key)
+		return
+	}
+	c.cacheSet(key, result, ttl)
+}
+
+func (c *Client) testResultsKey(scanID types.ScanID) string {
+	params := url.Values{}
+	params.Set("scan", fmt.Sprintf("%d", scanID))
+	return c.cacheKey(ApiCallGetScanResults, params)
+}
+
+func (c *Client) assessmentKey(host string) string {
+	params := url.Values{}
+	params.Set("host", host)
+	return c.cacheKey(ApiCallAnalyze, params)
+}
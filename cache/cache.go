@@ -0,0 +1,128 @@
+// Package cache provide the cache used by the HTTP Observatory client to avoid requesting the api for results
+// that can not have changed.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is a key-value store for encoded api responses. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get return the value stored for key, if any and not expired.
+	Get(key string) ([]byte, bool)
+	// Set store the value for key. A zero ttl means the value never expires.
+	Set(key string, value []byte, ttl time.Duration)
+	// Delete remove the value stored for key, if any.
+	Delete(key string)
+}
+
+// Stats hold the hit and miss counts of a cache.
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// HitRatio return the proportion of lookups that were served from the cache.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// LRU is an in-memory Cache that evict the least recently used entry once its maximum size is reached.
+type LRU struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+var _ Cache = (*LRU)(nil)
+
+// NewLRU return an LRU cache that hold at most size entries. A size lower than 1 is treated as 1.
+func NewLRU(size int) *LRU {
+	if size < 1 {
+		size = 1
+	}
+	return &LRU{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+		now:   time.Now,
+	}
+}
+
+// Get return the value stored for key, if any and not expired.
+func (l *LRU) Get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	elem, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := elem.Value.(*entry)
+	if !e.expires.IsZero() && !l.now().Before(e.expires) {
+		l.remove(elem)
+		return nil, false
+	}
+	l.ll.MoveToFront(elem)
+	return e.value, true
+}
+
+// Set store the value for key. A zero ttl means the value never expires.
+func (l *LRU) Set(key string, value []byte, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = l.now().Add(ttl)
+	}
+
+	if elem, ok := l.items[key]; ok {
+		e := elem.Value.(*entry)
+		e.value = value
+		e.expires = expires
+		l.ll.MoveToFront(elem)
+		return
+	}
+
+	l.items[key] = l.ll.PushFront(&entry{key: key, value: value, expires: expires})
+	for l.ll.Len() > l.size {
+		l.remove(l.ll.Back())
+	}
+}
+
+// Delete remove the value stored for key, if any.
+func (l *LRU) Delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if elem, ok := l.items[key]; ok {
+		l.remove(elem)
+	}
+}
+
+// Len return the number of entries in the cache, including expired entries not yet evicted.
+func (l *LRU) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ll.Len()
+}
+
+func (l *LRU) remove(elem *list.Element) {
+	l.ll.Remove(elem)
+	delete(l.items, elem.Value.(*entry).key)
+}
@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	now := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLRU(2)
+	l.now = func() time.Time { return now }
+
+	l.Set("a", []byte("1"), 0)
+	l.Set("b", []byte("2"), time.Minute)
+	_, ok := l.Get("a")
+	assert.True(t, ok)
+
+	// b is the least recently used entry.
+	l.Set("c", []byte("3"), 0)
+	_, ok = l.Get("b")
+	assert.False(t, ok)
+	assert.Equal(t, 2, l.Len())
+
+	l.Set("a", []byte("4"), time.Minute)
+	v, ok := l.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("4"), v)
+
+	now = now.Add(time.Minute)
+	_, ok = l.Get("a")
+	assert.False(t, ok)
+	v, ok = l.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("3"), v)
+
+	l.Delete("c")
+	assert.Equal(t, 0, l.Len())
+}
+
+func TestStatsHitRatio(t *testing.T) {
+	assert.Equal(t, float64(0), Stats{}.HitRatio())
+	assert.Equal(t, 0.75, Stats{Hits: 3, Misses: 1}.HitRatio())
+}
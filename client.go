@@ -4,14 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/tigerwill90/observatory/cache"
+	"github.com/tigerwill90/observatory/hostname"
 	"github.com/tigerwill90/observatory/internal/option"
+	"github.com/tigerwill90/observatory/logging"
+	"github.com/tigerwill90/observatory/middleware"
+	"github.com/tigerwill90/observatory/telemetry"
 	"github.com/tigerwill90/observatory/types"
 	"net/http"
 	"net/url"
 	"time"
 )
 
-const Endpoint = "https://http-observatory.security.mozilla.org/api/v1"
+const (
+	Endpoint   = "https://http-observatory.security.mozilla.org/api/v1"
+	EndpointV2 = "https://observatory-api.mdn.mozilla.net/api/v2"
+)
 
 const (
 	Aborted  = "ABORTED"
@@ -28,66 +36,183 @@ const (
 	ApiCallGetScanResults       = "getScanResults"
 	ApiCallGetHostHistory       = "getHostHistory"
 	ApiCallGetRecentScans       = "getRecentScans"
+	ApiCallGetScannerStats      = "__stats__"
+	// the heartbeat is served next to the api, see Client.Health
+	ApiCallHeartbeat = "__heartbeat__"
+	// v2 api calls, the v2 assessment and host history are retrieved with ApiCallAnalyze
+	ApiCallScan              = "scan"
+	ApiCallGradeDistribution = "grade_distribution"
 )
 
 var (
 	ErrScannerAborted = errors.New("scan aborted")
 	ErrScannerFailed  = errors.New("scan failed")
+	ErrUnsupported    = errors.New("unsupported by the api version")
 )
 
 // Client is an http.Client wrapper for HTTP Observatory api.
 type Client struct {
-	client *http.Client
-	url    string
+	// accessed atomically, kept first for 64-bit alignment on 32-bit platforms
+	cacheHits            uint64
+	cacheMisses          uint64
+	client               *http.Client
+	url                  string
+	endpoints            []*endpoint
+	sticky               *sticky
+	flights              *flightGroup
+	bearerToken          string
+	basicAuth            *option.BasicAuth
+	circuitStateHook     func(endpoint, from, to string)
+	hostValidation       bool
+	version              option.APIVersion
+	scans                *scanHosts
+	cache                cache.Cache
+	assessmentTTL        time.Duration
+	gradeDistributionTTL time.Duration
+	tracer               telemetry.Tracer
+	meter                telemetry.Meter
+	logger               logging.Logger
+	logLevel             logging.Level
+	doer                 middleware.Doer
 }
 
-// NewClient return a preconfigured HTTP Observatory client.
-// Use NewCustomClient to use an existing http.Client.
-func NewClient() *Client {
-	return &Client{
-		client: &http.Client{
+// NewClient return a preconfigured HTTP Observatory client, talking to Endpoint, or to EndpointV2 with
+// option.WithAPIVersion(option.APIv2). Use NewCustomClient to use an existing http.Client.
+func NewClient(opts ...option.ClientOption) *Client {
+	config := clientConfig(opts)
+	endpoint := Endpoint
+	if config.APIVersion == option.APIv2 {
+		endpoint = EndpointV2
+	}
+	return newClient(
+		&http.Client{
 			Transport: &http.Transport{
 				TLSHandshakeTimeout: 5 * time.Second,
 			},
 			Timeout: 10 * time.Second,
 		},
-		url: Endpoint,
-	}
+		endpoint,
+		config,
+	)
 }
 
 // NewCustomClient return an HTTP Observatory client from an
-// http.Client and an url.
-func NewCustomClient(c *http.Client, url string) *Client {
-	return &Client{
-		client: c,
-		url:    url,
+// http.Client and the base url of the api, such as Endpoint. The base url can have a path prefix and
+// query parameters, which are kept in every request, e.g. for a deployment behind a reverse proxy.
+func NewCustomClient(c *http.Client, url string, opts ...option.ClientOption) *Client {
+	return newClient(c, url, clientConfig(opts))
+}
+
+func clientConfig(opts []option.ClientOption) *option.ClientConfig {
+	config := option.DefaultClientConfig()
+	for _, opt := range opts {
+		opt.Apply(config)
+	}
+	return config
+}
+
+func newClient(c *http.Client, baseURL string, config *option.ClientConfig) *Client {
+	client := &Client{
+		client:               withTLS(c, config.TLSConfig),
+		url:                  baseURL,
+		bearerToken:          config.BearerToken,
+		basicAuth:            config.BasicAuth,
+		circuitStateHook:     config.CircuitStateHook,
+		hostValidation:       config.HostValidation,
+		version:              config.APIVersion,
+		scans:                newScanHosts(),
+		cache:                config.Cache,
+		assessmentTTL:        config.AssessmentTTL,
+		gradeDistributionTTL: config.GradeDistributionTTL,
+		tracer:               config.Tracer,
+		meter:                config.Meter,
+		logger:               config.Logger,
+		logLevel:             config.LogLevel,
+	}
+	client.endpoints = newEndpoints(baseURL, config.FallbackEndpoints, config.CircuitBreaker)
+	for _, e := range client.endpoints {
+		if e.breaker != nil {
+			e.breaker.onChange = client.circuitChanged(e)
+		}
+	}
+	client.sticky = newSticky()
+	if config.Deduplication {
+		client.flights = newFlightGroup()
+	}
+
+	mws := make([]middleware.Middleware, 0, len(config.Middlewares)+2)
+	if client.logger != nil {
+		mws = append(mws, middleware.Logging(logging.LoggerFunc(client.log), client.logLevel))
+	}
+	if client.meter != nil {
+		mws = append(mws, middleware.Metrics(client.meter))
 	}
+	client.doer = middleware.Chain(middleware.DoerFunc(client.do), append(mws, config.Middlewares...)...)
+	return client
+}
+
+// NormalizeHost return the host as the client send it to the api: normalized by hostname.Normalize, or as is if
+// host validation is disabled with option.WithHostValidation. Packages keying data by host, such as a store, use it
+// so that every variant of a host is the same one.
+func (c *Client) NormalizeHost(host string) (string, error) {
+	if !c.hostValidation {
+		return host, nil
+	}
+	return hostname.Normalize(host)
 }
 
 // Analyze is used to invoke a new scan of a website. By default, Analyze will return a cached site result if
 // the site has been scanned anytime in the previous 24 hours. Use option.ForceRescan to ignore cached result and
 // start a new scan. Regardless of the state of option.ForceRescan, HTTP Observatory can not be scanned at a
 // frequency greater than every 3 minutes and Analyze will return a cached result if it is the case.
+// When the client cache is enabled and option.ForceRescan is not set, a finished assessment still in
+// cache is returned without invoking a new scan. The host is normalized first, so that a URL such as
+// "https://Observatory.Mozilla.org/" is accepted, and an IP address or a private host is rejected, see
+// option.WithHostValidation.
 // https://github.com/mozilla/http-observatory/blob/master/httpobs/docs/api.md#invoke-assessment
-func (c *Client) Analyze(ctx context.Context, host string, opts ...option.Option) (*types.ScannerResult, error) {
+func (c *Client) Analyze(ctx context.Context, host string, opts ...option.Option) (result *types.ScannerResult, err error) {
+	if host, err = c.NormalizeHost(host); err != nil {
+		return nil, fmt.Errorf("invoke assessment failed: %w", err)
+	}
+	ctx, span := c.startSpan(ctx, "observatory.Analyze", ApiCallAnalyze, host, 0)
+	defer func() { endSpan(span, result, err) }()
+	ctx = c.withLogAttrs(ctx, host, 0)
+	if c.meter != nil {
+		start := time.Now()
+		defer func() { c.recordScan(ctx, host, result, start, err) }()
+	}
+
 	analyseOpt := option.DefaultOption()
 	for _, opt := range opts {
 		opt.Apply(analyseOpt)
 	}
 
-	result, err := c.analyze(ctx, host, analyseOpt)
+	if !analyseOpt.Rescan && c.assessmentTTL > 0 {
+		cached := new(types.ScannerResult)
+		if c.cacheGet(ctx, c.assessmentKey(host), cached) {
+			c.scans.set(host, cached.ScanID)
+			return cached, nil
+		}
+	}
+
+	result, err = c.analyze(ctx, host, analyseOpt)
 	if err != nil {
 		return nil, fmt.Errorf("invoke assessment failed: %w", err)
 	}
+	setLogScanID(ctx, result.ScanID)
+	if c.logEnabled(logging.LevelInfo) {
+		c.log(ctx, logging.LevelInfo, "assessment invoked", logging.String("state", result.State))
+	}
 
 	if result.State == "" {
-		result, err = c.GetAssessment(ctx, host)
+		result, err = c.getAssessment(ctx, host)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	if result.State == Finished || !analyseOpt.WaitFinished {
+		c.logFinished(ctx, result)
 		return result, nil
 	}
 
@@ -96,29 +221,68 @@ func (c *Client) Analyze(ctx context.Context, host string, opts ...option.Option
 		interval = analyseOpt.PullInterval
 	}
 
+	result, err = c.waitFinished(ctx, host, interval)
+	if err != nil {
+		return nil, err
+	}
+	c.logFinished(ctx, result)
+	return result, nil
+}
+
+// waitFinished poll the assessment of the host until its scan is finished. Concurrent callers waiting for the
+// same host share a single polling loop, at the interval of the first one.
+func (c *Client) waitFinished(ctx context.Context, host string, interval time.Duration) (*types.ScannerResult, error) {
+	if c.flights == nil {
+		return c.poll(ctx, host, interval)
+	}
+	v, shared, err := c.flights.do(copyLogAttrs(ctx), "poll "+host, func(ctx context.Context) (interface{}, error) {
+		return c.poll(ctx, host, interval)
+	})
+	if err != nil {
+		if err == ctx.Err() {
+			return nil, fmt.Errorf("retrieve assessment aborted: %w", err)
+		}
+		return nil, err
+	}
+	result := new(types.ScannerResult)
+	if err := copyResult(result, v, shared); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// poll retrieve the assessment of the host at each interval until its scan is finished.
+func (c *Client) poll(ctx context.Context, host string, interval time.Duration) (*types.ScannerResult, error) {
 	timer := time.NewTicker(interval)
 	defer timer.Stop()
-STOP:
 	for {
 		select {
 		case <-ctx.Done():
 			return nil, fmt.Errorf("retrieve assessment aborted: %w", ctx.Err())
 		case <-timer.C:
-			result, err = c.GetAssessment(ctx, host)
+			pollCtx, pollSpan := c.startSpan(ctx, "observatory.poll", ApiCallAnalyze, host, 0)
+			result, err := c.getAssessment(pollCtx, host)
+			endSpan(pollSpan, result, err)
 			if err != nil {
 				return nil, err
 			}
+			setLogScanID(ctx, result.ScanID)
+			if c.logEnabled(logging.LevelDebug) {
+				c.log(ctx, logging.LevelDebug, "assessment polled", logging.String("state", result.State))
+			}
 
 			if result.State == Finished {
-				break STOP
+				return result, nil
 			}
 		}
 	}
-
-	return result, nil
 }
 
 func (c *Client) analyze(ctx context.Context, host string, opt *option.AnalyzeOption) (*types.ScannerResult, error) {
+	if c.version == option.APIv2 {
+		return c.scanV2(ctx, host)
+	}
+
 	data := url.Values{}
 	data.Set("hidden", fmt.Sprintf("%t", opt.Hidden))
 	data.Set("rescan", fmt.Sprintf("%t", opt.Rescan))
@@ -141,12 +305,42 @@ func (c *Client) analyze(ctx context.Context, host string, opt *option.AnalyzeOp
 		return nil, err
 	}
 
+	if result.State != "" {
+		c.cacheAssessment(host, result)
+	}
 	return result, nil
 }
 
 // GetAssessment is used to retrieve the results of an existing, ongoing or completed scan.
+// When the client cache is enabled, a finished assessment is served from the cache.
 // https://github.com/mozilla/http-observatory/blob/master/httpobs/docs/api.md#retrieve-assessment
-func (c *Client) GetAssessment(ctx context.Context, host string) (*types.ScannerResult, error) {
+func (c *Client) GetAssessment(ctx context.Context, host string) (result *types.ScannerResult, err error) {
+	if host, err = c.NormalizeHost(host); err != nil {
+		return nil, fmt.Errorf("retrieve assessment failed: %w", err)
+	}
+	ctx, span := c.startSpan(ctx, "observatory.GetAssessment", ApiCallAnalyze, host, 0)
+	defer func() { endSpan(span, result, err) }()
+	ctx = c.withLogAttrs(ctx, host, 0)
+
+	cached := new(types.ScannerResult)
+	if c.assessmentTTL > 0 && c.cacheGet(ctx, c.assessmentKey(host), cached) {
+		// the v2 api retrieve the tests of the scan by host, which must be known even if the scan was cached
+		c.scans.set(host, cached.ScanID)
+		return cached, nil
+	}
+	return c.getAssessment(ctx, host)
+}
+
+// getAssessment always retrieve the assessment from the api, and refresh the cache with it.
+func (c *Client) getAssessment(ctx context.Context, host string) (*types.ScannerResult, error) {
+	if c.version == option.APIv2 {
+		analysis, err := c.analysisV2(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("retrieve assessment failed: %w", err)
+		}
+		return analysis.result, nil
+	}
+
 	queryParams := url.Values{}
 	queryParams.Set("host", host)
 
@@ -165,13 +359,33 @@ func (c *Client) GetAssessment(ctx context.Context, host string) (*types.Scanner
 		return nil, fmt.Errorf("retrieve assessment failed: %w", err)
 	}
 
+	c.cacheAssessment(host, result)
 	return result, nil
 }
 
 // GetTestResults returns the detailed test result of a scan. The results of all these tests can
-// bet retrieved once the scan's state has been placed in the FINISHED state.
+// bet retrieved once the scan's state has been placed in the FINISHED state. Since they can not change
+// afterward, test results are cached by scan ID without expiration when the client cache is enabled.
 // https://github.com/mozilla/http-observatory/blob/master/httpobs/docs/api.md#retrieve-test-results
-func (c *Client) GetTestResults(ctx context.Context, scanID types.ScanID) (*types.ScannerTestResult, error) {
+func (c *Client) GetTestResults(ctx context.Context, scanID types.ScanID) (_ *types.ScannerTestResult, err error) {
+	ctx, span := c.startSpan(ctx, "observatory.GetTestResults", ApiCallGetScanResults, "", scanID)
+	defer func() { endSpan(span, nil, err) }()
+	ctx = c.withLogAttrs(ctx, "", scanID)
+
+	key := c.testResultsKey(scanID)
+	testResult := new(types.ScannerTestResult)
+	if c.cacheGet(ctx, key, testResult) {
+		return testResult, nil
+	}
+
+	if c.version == option.APIv2 {
+		testResult, err = c.testResultsV2(ctx, scanID)
+		if err != nil {
+			return nil, fmt.Errorf("retrieve test results failed: %w", err)
+		}
+		return testResult, nil
+	}
+
 	data := url.Values{}
 	data.Set("scan", fmt.Sprintf("%d", scanID))
 
@@ -181,34 +395,63 @@ func (c *Client) GetTestResults(ctx context.Context, scanID types.ScanID) (*type
 		queryParams: data,
 	}
 
-	testResult := new(types.ScannerTestResult)
 	if err := c.doRequest(ctx, reqConfig, testResult); err != nil {
 		return nil, fmt.Errorf("retrieve test results failed: %w", err)
 	}
 
+	if hasTestResults(testResult) {
+		c.cacheSet(key, testResult, 0)
+	}
 	return testResult, nil
 }
 
 // GetGradeDistribution retrieve each possible grade in the HTTP Observatory, as well as how many scans
 // have fallen into that grade.
 // https://github.com/mozilla/http-observatory/blob/master/httpobs/docs/api.md#retrieve-overall-grade-distribution
-func (c *Client) GetGradeDistribution(ctx context.Context) (*types.ScannerGradeDistribution, error) {
-	reqConfig := request{
-		method:  "GET",
-		apiCall: ApiCallGetGradeDistribution,
-	}
+func (c *Client) GetGradeDistribution(ctx context.Context) (_ *types.ScannerGradeDistribution, err error) {
+	ctx, span := c.startSpan(ctx, "observatory.GetGradeDistribution", ApiCallGetGradeDistribution, "", 0)
+	defer func() { endSpan(span, nil, err) }()
+	ctx = c.withLogAttrs(ctx, "", 0)
 
+	key := c.cacheKey(ApiCallGetGradeDistribution, nil)
 	gradeDistribution := new(types.ScannerGradeDistribution)
-	if err := c.doRequest(ctx, reqConfig, gradeDistribution); err != nil {
+	if c.gradeDistributionTTL > 0 && c.cacheGet(ctx, key, gradeDistribution) {
+		return gradeDistribution, nil
+	}
+
+	if c.version == option.APIv2 {
+		gradeDistribution, err = c.gradeDistributionV2(ctx)
+	} else {
+		err = c.doRequest(ctx, request{method: "GET", apiCall: ApiCallGetGradeDistribution}, gradeDistribution)
+	}
+	if err != nil {
 		return nil, fmt.Errorf("retrieve overall grade distribution failed: %w", err)
 	}
 
+	if c.gradeDistributionTTL > 0 {
+		c.cacheSet(key, gradeDistribution, c.gradeDistributionTTL)
+	}
 	return gradeDistribution, nil
 }
 
 // GetScanHistory retrieve the ten most recent scans for the given host.
 // https://github.com/mozilla/http-observatory/blob/master/httpobs/docs/api.md#retrieve-hosts-scan-history
-func (c *Client) GetScanHistory(ctx context.Context, host string) ([]*types.ScannerHostHistory, error) {
+func (c *Client) GetScanHistory(ctx context.Context, host string) (_ []*types.ScannerHostHistory, err error) {
+	if host, err = c.NormalizeHost(host); err != nil {
+		return nil, fmt.Errorf("retrieve host's scan history failed: %w", err)
+	}
+	ctx, span := c.startSpan(ctx, "observatory.GetScanHistory", ApiCallGetHostHistory, host, 0)
+	defer func() { endSpan(span, nil, err) }()
+	ctx = c.withLogAttrs(ctx, host, 0)
+
+	if c.version == option.APIv2 {
+		analysis, err := c.analysisV2(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("retrieve host's scan history failed: %w", err)
+		}
+		return analysis.history, nil
+	}
+
 	data := url.Values{}
 	data.Set("host", host)
 	reqConfig := request{
@@ -225,20 +468,33 @@ func (c *Client) GetScanHistory(ctx context.Context, host string) ([]*types.Scan
 	return histories, nil
 }
 
-// GetRecentScans retrieve the ten most recent scans that fall withing a given score range.
-// Use option.WithMaxScore to set the upper limit or option.WithMinScore to set the lower limit.
+// GetRecentScans retrieve the ten most recent scans that fall withing a given score range, most recent first.
+// Use option.WithMinScore to set the lower limit and option.WithMaxScore to set the upper limit, and
+// option.WithGrades to only keep some grades.
 // https://github.com/mozilla/http-observatory/blob/master/httpobs/docs/api.md#retrieve-recent-scans
-func (c *Client) GetRecentScans(ctx context.Context, opt option.ScanOption) (types.ScannerRecentScans, error) {
+func (c *Client) GetRecentScans(ctx context.Context, opts ...option.ScanOption) (_ types.ScannerRecentScans, err error) {
+	ctx, span := c.startSpan(ctx, "observatory.GetRecentScans", ApiCallGetRecentScans, "", 0)
+	defer func() { endSpan(span, nil, err) }()
+	ctx = c.withLogAttrs(ctx, "", 0)
+
+	if c.version == option.APIv2 {
+		return nil, fmt.Errorf("retrieve recent scans failed: %w", ErrUnsupported)
+	}
+
 	o := option.DefaultScanOption()
-	opt.Apply(o)
+	for _, opt := range opts {
+		opt.Apply(o)
+	}
+	if o.Max != 0 && o.Min > o.Max {
+		return nil, fmt.Errorf("retrieve recent scans failed: min score %d greater than max score %d", o.Min, o.Max)
+	}
 	data := url.Values{}
+	data.Set("min", fmt.Sprintf("%d", o.Min))
 	if o.Max != 0 {
 		data.Set("max", fmt.Sprintf("%d", o.Max))
-	} else {
-		data.Set("min", fmt.Sprintf("%d", o.Min))
 	}
 
-	recentScans := make(types.ScannerRecentScans)
+	recentScans := make(types.ScannerRecentScans, 0)
 	reqConfig := request{
 		method:      "GET",
 		apiCall:     ApiCallGetRecentScans,
@@ -249,7 +505,43 @@ func (c *Client) GetRecentScans(ctx context.Context, opt option.ScanOption) (typ
 		return nil, fmt.Errorf("retrieve recent scans failed: %w", err)
 	}
 
-	return recentScans, nil
+	return filterGrades(recentScans, o.Grades), nil
+}
+
+// filterGrades return the scans with one of the grades, or all the scans without grades.
+func filterGrades(scans types.ScannerRecentScans, grades []string) types.ScannerRecentScans {
+	if len(grades) == 0 {
+		return scans
+	}
+	filtered := make(types.ScannerRecentScans, 0, len(scans))
+	for _, scan := range scans {
+		for _, grade := range grades {
+			if scan.Grade == grade {
+				filtered = append(filtered, scan)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// Health check that the api is up and that the client can reach it, authentication and TLS included, with the
+// heartbeat endpoint of HTTP Observatory. The heartbeat is served next to the api, e.g. at
+// https://observatory.example.com/__heartbeat__ for the https://observatory.example.com/api/v1 base url.
+func (c *Client) Health(ctx context.Context) (err error) {
+	ctx, span := c.startSpan(ctx, "observatory.Health", ApiCallHeartbeat, "", 0)
+	defer func() { endSpan(span, nil, err) }()
+	ctx = c.withLogAttrs(ctx, "", 0)
+
+	reqConfig := request{
+		method:  "GET",
+		apiCall: ApiCallHeartbeat,
+	}
+	status := make(map[string]interface{})
+	if err := c.doRequest(ctx, reqConfig, &status); err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	return nil
 }
 
 func checkScannerError(state string) error {
@@ -261,3 +553,14 @@ func checkScannerError(state string) error {
 	}
 	return nil
 }
+
+// hasTestResults return true if at least one test has a result, which is not the case
+// until the scan is finished.
+func hasTestResults(r *types.ScannerTestResult) bool {
+	for _, test := range r.Summaries() {
+		if test.Result != "" {
+			return true
+		}
+	}
+	return false
+}
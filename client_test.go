@@ -3,14 +3,22 @@ package observatory
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory/cache"
+	"github.com/tigerwill90/observatory/hostname"
+	internaloption "github.com/tigerwill90/observatory/internal/option"
+	"github.com/tigerwill90/observatory/logging"
+	"github.com/tigerwill90/observatory/middleware"
 	"github.com/tigerwill90/observatory/option"
+	"github.com/tigerwill90/observatory/telemetry"
 	"github.com/tigerwill90/observatory/types"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -139,7 +147,8 @@ func TestClientAnalyzeError(t *testing.T) {
 		{
 			name: "deadline exceeded",
 			ctx: func() context.Context {
-				ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				t.Cleanup(cancel)
 				return ctx
 			}(),
 			srv: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -292,35 +301,477 @@ func TestClientGetScanHistory(t *testing.T) {
 	assert.Equal(t, want, got)
 }
 
+func TestClientHostValidation(t *testing.T) {
+	var hosts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.URL.Query().Get("host"))
+		if err := json.NewEncoder(w).Encode(&types.ScannerResult{State: Finished, Grade: "A"}); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	c := NewCustomClient(srv.Client(), srv.URL)
+	_, err := c.GetAssessment(ctx, "https://Observatory.Mozilla.org/")
+	require.Nil(t, err)
+	_, err = c.Analyze(ctx, "observatory.mozilla.org:443")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"observatory.mozilla.org", "observatory.mozilla.org"}, hosts)
+
+	hosts = nil
+	_, err = c.Analyze(ctx, "192.0.2.1")
+	assert.ErrorIs(t, err, hostname.ErrIPAddress)
+	_, err = c.GetAssessment(ctx, "localhost")
+	assert.ErrorIs(t, err, hostname.ErrReservedHost)
+	_, err = c.GetScanHistory(ctx, "")
+	assert.ErrorIs(t, err, hostname.ErrInvalidHost)
+	assert.Empty(t, hosts)
+
+	c = NewCustomClient(srv.Client(), srv.URL, option.WithHostValidation(false))
+	_, err = c.GetAssessment(ctx, "intranet")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"intranet"}, hosts)
+}
+
 func TestClientGetRecentScans(t *testing.T) {
-	want := types.ScannerRecentScans{
-		"site1.mozilla.org": "A",
-		"site2.mozilla.org": "B-",
-		"site3.mozilla.org": "C+",
-		"site4.mozilla.org": "F",
-		"site5.mozilla.org": "F",
-		"site6.mozilla.org": "B",
-		"site7.mozilla.org": "F",
-		"site8.mozilla.org": "B+",
-		"site9.mozilla.org": "A+",
-		"site0.mozilla.org": "A-",
+	// The api return the most recent scans first, which is not the order of the hosts.
+	const body = `{"site9.mozilla.org": "A+", "site1.mozilla.org": "A", "site2.mozilla.org": "B-", "site3.mozilla.org": "C+", "site4.mozilla.org": null}`
+
+	cases := []struct {
+		name      string
+		opts      []internaloption.ScanOption
+		wantQuery url.Values
+		want      types.ScannerRecentScans
+	}{
+		{
+			name:      "min score",
+			opts:      []internaloption.ScanOption{option.WithMinScore(119)},
+			wantQuery: url.Values{"min": {"119"}},
+			want: types.ScannerRecentScans{
+				{Host: "site9.mozilla.org", Grade: "A+"},
+				{Host: "site1.mozilla.org", Grade: "A"},
+				{Host: "site2.mozilla.org", Grade: "B-"},
+				{Host: "site3.mozilla.org", Grade: "C+"},
+				{Host: "site4.mozilla.org", Grade: ""},
+			},
+		},
+		{
+			name:      "min and max score with grades",
+			opts:      []internaloption.ScanOption{option.WithMinScore(50), option.WithMaxScore(80), option.WithGrades("A", "C+")},
+			wantQuery: url.Values{"min": {"50"}, "max": {"80"}},
+			want: types.ScannerRecentScans{
+				{Host: "site1.mozilla.org", Grade: "A"},
+				{Host: "site3.mozilla.org", Grade: "C+"},
+			},
+		},
 	}
 
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, tc.wantQuery, r.URL.Query())
+				assert.Equal(t, fmt.Sprintf("/%s", ApiCallGetRecentScans), r.URL.Path)
+				fmt.Fprint(w, body)
+			}))
+			defer srv.Close()
+
+			c := NewCustomClient(srv.Client(), srv.URL)
+			got, err := c.GetRecentScans(context.Background(), tc.opts...)
+			require.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	c := NewCustomClient(http.DefaultClient, "http://127.0.0.1:0")
+	_, err := c.GetRecentScans(context.Background(), option.WithMinScore(80), option.WithMaxScore(50))
+	assert.NotNil(t, err)
+}
+
+func TestScannerRecentScansJSON(t *testing.T) {
+	scans := types.ScannerRecentScans{{Host: "b.example.com", Grade: "A"}, {Host: "a.example.com", Grade: "F"}}
+	buf, err := json.Marshal(scans)
+	require.Nil(t, err)
+	assert.Equal(t, `{"b.example.com":"A","a.example.com":"F"}`, string(buf))
+
+	var got types.ScannerRecentScans
+	require.Nil(t, json.Unmarshal(buf, &got))
+	assert.Equal(t, scans, got)
+	grade, ok := got.Grade("a.example.com")
+	assert.True(t, ok)
+	assert.Equal(t, "F", grade)
+
+	require.Nil(t, json.Unmarshal([]byte("null"), &got))
+	assert.Nil(t, got)
+	assert.NotNil(t, json.Unmarshal([]byte(`["a.example.com"]`), &got))
+}
+
+func TestClientGetScannerStats(t *testing.T) {
+	const body = `{
+  "gradeDistribution": {"latest": {"A+": 3, "F": 10}, "all": {"A+": 5, "F": 30}},
+  "gradeImprovements": {"-1": 2, "0": 40, "1": 7},
+  "misc": {
+    "mostRecentScanDate": "Tue, 27 Feb 2018 21:35:26 GMT",
+    "numHoursWithoutScansInLast24Hours": 1,
+    "numImprovedSites": 7,
+    "numScans": 120,
+    "numScansLast24Hours": 31,
+    "numSuccessfulScans": 35,
+    "numUniqueSites": 49
+  },
+  "recent": {
+    "scans": {
+      "best": {"site1.mozilla.org": "A+"},
+      "recent": {"site2.mozilla.org": "F"},
+      "worst": {"site2.mozilla.org": "F"},
+      "numPerHourLast24Hours": {
+        "2018-02-27 21:00:00+00:00": 10,
+        "2018-02-27 19:00:00+00:00": 20,
+        "2018-02-27 22:00:00+00:00": 1
+      }
+    }
+  },
+  "states": {"ABORTED": 1, "FAILED": 2, "FINISHED": 110, "PENDING": 3, "RUNNING": 2, "STARTING": 2}
+}`
+
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		wantQuery := url.Values{}
-		wantQuery.Set("min", "119")
+		wantQuery.Set("verbose", "true")
 		assert.Equal(t, wantQuery, r.URL.Query())
-		assert.Equal(t, fmt.Sprintf("/%s", ApiCallGetRecentScans), r.URL.Path)
-		if err := json.NewEncoder(w).Encode(&want); err != nil {
+		assert.Equal(t, fmt.Sprintf("/%s", ApiCallGetScannerStats), r.URL.Path)
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	c := NewCustomClient(srv.Client(), srv.URL)
+	got, err := c.GetScannerStats(context.Background(), option.WithVerbose(true))
+	require.Nil(t, err)
+	assert.Equal(t, types.ScannerStates{Aborted: 1, Failed: 2, Finished: 110, Pending: 3, Running: 2, Starting: 2}, got.States)
+	assert.Equal(t, 7, got.States.Queued())
+	assert.Equal(t, 3, got.GradeDistribution.Latest.A)
+	assert.Equal(t, 30, got.GradeDistribution.All.F)
+	assert.Equal(t, 7, got.GradeImprovements["1"])
+	assert.Equal(t, 31, got.Misc.NumScansLast24Hours)
+	assert.Equal(t, types.ScannerRecentScans{{Host: "site1.mozilla.org", Grade: "A+"}}, got.Recent.Scans.Best)
+
+	hour := time.Date(2018, time.February, 27, 19, 0, 0, 0, time.UTC)
+	assert.Equal(t, types.ScanSeries{
+		{Hour: hour, Count: 20},
+		{Hour: hour.Add(time.Hour), Count: 0},
+		{Hour: hour.Add(2 * time.Hour), Count: 10},
+		{Hour: hour.Add(3 * time.Hour), Count: 1},
+	}, got.ScansPerHour)
+	assert.Equal(t, 31, got.ScansPerHour.Total())
+	peak, ok := got.ScansPerHour.Peak()
+	require.True(t, ok)
+	assert.Equal(t, hour, peak.Hour)
+	quietest, ok := got.ScansPerHour.Quietest()
+	require.True(t, ok)
+	assert.Equal(t, hour.Add(time.Hour), quietest.Hour)
+}
+
+func TestScanSeries(t *testing.T) {
+	cases := []struct {
+		name    string
+		counts  map[string]int
+		want    types.ScanSeries
+		wantErr bool
+	}{
+		{name: "empty"},
+		{
+			name:   "http date",
+			counts: map[string]int{"Tue, 27 Feb 2018 21:00:00 GMT": 4},
+			want:   types.ScanSeries{{Hour: time.Date(2018, time.February, 27, 21, 0, 0, 0, time.UTC), Count: 4}},
+		},
+		{
+			name:   "offset",
+			counts: map[string]int{"2018-02-27T22:30:00+01:00": 4, "2018-02-27 21:00:00": 1},
+			want:   types.ScanSeries{{Hour: time.Date(2018, time.February, 27, 21, 0, 0, 0, time.UTC), Count: 5}},
+		},
+		{name: "invalid", counts: map[string]int{"yesterday": 4}, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := scanSeries(tc.counts)
+			if tc.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestClientCache(t *testing.T) {
+	finished := &types.ScannerResult{
+		EndTime: time.Now().UTC().Format(http.TimeFormat),
+		Grade:   "A",
+		ScanID:  1,
+		Score:   90,
+		State:   Finished,
+	}
+	testResult := new(types.ScannerTestResult)
+	testResult.ContentSecurityPolicy.Result = "csp-implemented-with-no-unsafe"
+
+	var analyzeCall, resultCall, distributionCall uint32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{}
+		switch r.URL.Path {
+		case fmt.Sprintf("/%s", ApiCallAnalyze):
+			atomic.AddUint32(&analyzeCall, 1)
+			resp = finished
+		case fmt.Sprintf("/%s", ApiCallGetScanResults):
+			atomic.AddUint32(&resultCall, 1)
+			resp = testResult
+		case fmt.Sprintf("/%s", ApiCallGetGradeDistribution):
+			atomic.AddUint32(&distributionCall, 1)
+			resp = new(types.ScannerGradeDistribution)
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
 			t.Fatal(err)
 		}
 	}))
 	defer srv.Close()
 
-	c := NewCustomClient(srv.Client(), srv.URL)
-	got, err := c.GetRecentScans(context.Background(), option.WithMinScore(119))
+	c := NewCustomClient(srv.Client(), srv.URL, option.WithCache(cache.NewLRU(10)))
+	for i := 0; i < 3; i++ {
+		got, err := c.GetAssessment(context.Background(), "observatory.mozilla.org")
+		require.Nil(t, err)
+		assert.Equal(t, finished, got)
+		_, err = c.GetTestResults(context.Background(), 1)
+		require.Nil(t, err)
+		_, err = c.GetGradeDistribution(context.Background())
+		require.Nil(t, err)
+	}
+	assert.Equal(t, uint32(1), atomic.LoadUint32(&analyzeCall))
+	assert.Equal(t, uint32(1), atomic.LoadUint32(&resultCall))
+	assert.Equal(t, uint32(1), atomic.LoadUint32(&distributionCall))
+
+	// A finished assessment in cache is returned without invoking a new scan, unless a rescan is forced.
+	_, err := c.Analyze(context.Background(), "observatory.mozilla.org")
 	require.Nil(t, err)
-	assert.Equal(t, want, got)
+	assert.Equal(t, uint32(1), atomic.LoadUint32(&analyzeCall))
+	_, err = c.Analyze(context.Background(), "observatory.mozilla.org", option.ForceRescan(true))
+	require.Nil(t, err)
+	assert.Equal(t, uint32(2), atomic.LoadUint32(&analyzeCall))
+
+	assert.Equal(t, cache.Stats{Hits: 7, Misses: 3}, c.CacheStats())
+}
+
+func TestClientCacheExpiredAssessment(t *testing.T) {
+	var call uint32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddUint32(&call, 1)
+		resp := &types.ScannerResult{
+			EndTime: time.Now().Add(-25 * time.Hour).UTC().Format(http.TimeFormat),
+			State:   Finished,
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewCustomClient(srv.Client(), srv.URL, option.WithCache(cache.NewLRU(10)))
+	for i := 0; i < 2; i++ {
+		_, err := c.GetAssessment(context.Background(), "observatory.mozilla.org")
+		require.Nil(t, err)
+	}
+	assert.Equal(t, uint32(2), atomic.LoadUint32(&call))
+}
+
+type spanKey struct{}
+
+type recordedSpan struct {
+	name   string
+	parent string
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string, attrs ...telemetry.Attribute) (context.Context, telemetry.Span) {
+	span := &recordedSpan{name: name, attrs: make(map[string]interface{})}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		span.parent = parent.name
+	}
+	span.SetAttributes(attrs...)
+	r.mu.Lock()
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...telemetry.Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordedSpan) RecordError(err error) {
+	s.err = err
+}
+
+func (s *recordedSpan) End() {
+	s.ended = true
+}
+
+type recordingMeter struct {
+	requests []string
+	scans    []string
+}
+
+func (m *recordingMeter) RecordRequest(_ context.Context, apiCall, method string, statusCode int, _ time.Duration, _ error) {
+	m.requests = append(m.requests, fmt.Sprintf("%s %s %d", method, apiCall, statusCode))
+}
+
+func (m *recordingMeter) RecordScan(_ context.Context, host, state string, _ time.Duration, _ error) {
+	m.scans = append(m.scans, fmt.Sprintf("%s %s", host, state))
+}
+
+func TestClientTelemetry(t *testing.T) {
+	var call uint32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := &types.ScannerResult{ScanID: 1, State: Pending}
+		if r.Method == "GET" && atomic.AddUint32(&call, 1) > 1 {
+			resp.State = Finished
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer srv.Close()
+
+	tracer := new(recordingTracer)
+	meter := new(recordingMeter)
+	c := NewCustomClient(srv.Client(), srv.URL, option.WithTracer(tracer), option.WithMeter(meter))
+	_, err := c.Analyze(context.Background(), "observatory.mozilla.org", option.WaitFinished(true, 10*time.Millisecond))
+	require.Nil(t, err)
+
+	got := make([]string, 0, len(tracer.spans))
+	for _, span := range tracer.spans {
+		assert.True(t, span.ended)
+		got = append(got, fmt.Sprintf("%s<-%s", span.name, span.parent))
+	}
+	assert.Equal(t, []string{
+		"observatory.Analyze<-",
+		"observatory.request<-observatory.Analyze",
+		"observatory.attempt<-observatory.request",
+		"observatory.poll<-observatory.Analyze",
+		"observatory.request<-observatory.poll",
+		"observatory.attempt<-observatory.request",
+		"observatory.poll<-observatory.Analyze",
+		"observatory.request<-observatory.poll",
+		"observatory.attempt<-observatory.request",
+	}, got)
+
+	analyze := tracer.spans[0]
+	assert.Equal(t, "observatory.mozilla.org", analyze.attrs[telemetry.KeyHost])
+	assert.Equal(t, ApiCallAnalyze, analyze.attrs[telemetry.KeyApiCall])
+	assert.Equal(t, 1, analyze.attrs[telemetry.KeyScanID])
+	assert.Equal(t, Finished, analyze.attrs[telemetry.KeyState])
+	assert.Equal(t, http.StatusOK, tracer.spans[1].attrs[telemetry.KeyStatusCode])
+	attempt := tracer.spans[2]
+	assert.Equal(t, srv.URL, attempt.attrs[telemetry.KeyEndpoint])
+	assert.Equal(t, http.StatusOK, attempt.attrs[telemetry.KeyStatusCode])
+	assert.Equal(t, "success", attempt.attrs[telemetry.KeyOutcome])
+
+	assert.Equal(t, []string{"POST analyze 200", "GET analyze 200", "GET analyze 200"}, meter.requests)
+	assert.Equal(t, []string{"observatory.mozilla.org FINISHED"}, meter.scans)
+}
+
+func TestClientLogger(t *testing.T) {
+	var call uint32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := &types.ScannerResult{ScanID: 7, State: Pending}
+		if r.Method == "GET" && atomic.AddUint32(&call, 1) > 1 {
+			resp.State = Finished
+			resp.Grade = "A"
+			resp.Score = 90
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer srv.Close()
+
+	var mu sync.Mutex
+	records := make([]string, 0)
+	logger := logging.LoggerFunc(func(_ context.Context, level logging.Level, msg string, fields ...logging.Field) {
+		kv := make(map[string]interface{}, len(fields))
+		for _, f := range fields {
+			kv[f.Key] = f.Value
+		}
+		assert.Equal(t, "observatory.mozilla.org", kv["host"], msg)
+		mu.Lock()
+		records = append(records, fmt.Sprintf("%s %s %v", level, msg, kv["scan_id"]))
+		mu.Unlock()
+	})
+
+	c := NewCustomClient(srv.Client(), srv.URL, option.WithLogger(logger, logging.LevelInfo))
+	_, err := c.Analyze(context.Background(), "observatory.mozilla.org", option.WaitFinished(true, 10*time.Millisecond))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"INFO assessment invoked 7", "INFO assessment finished 7"}, records)
+
+	records = records[:0]
+	c = NewCustomClient(srv.Client(), srv.URL, option.WithLogger(logger, logging.LevelDebug))
+	_, err = c.GetAssessment(context.Background(), "observatory.mozilla.org")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"DEBUG request sent <nil>", "DEBUG response received <nil>"}, records)
+}
+
+func TestClientMiddleware(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		if err := json.NewEncoder(w).Encode(&types.ScannerResult{ScanID: 7, State: Finished, Grade: "A"}); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer srv.Close()
+
+	calls := make([]string, 0)
+	audit := func(next middleware.Doer) middleware.Doer {
+		return middleware.DoerFunc(func(ctx context.Context, call *middleware.Call) (*middleware.Response, error) {
+			resp, err := next.Do(ctx, call)
+			if result, ok := call.Result.(*types.ScannerResult); ok && err == nil {
+				calls = append(calls, fmt.Sprintf("%s %s %s %d", call.Method, call.ApiCall, call.Query.Get("host"), result.ScanID))
+			}
+			return resp, err
+		})
+	}
+	c := NewCustomClient(
+		srv.Client(),
+		srv.URL,
+		option.WithMiddleware(middleware.Headers(http.Header{"Authorization": {"Bearer token"}}), audit),
+	)
+	result, err := c.Analyze(context.Background(), "observatory.mozilla.org")
+	require.Nil(t, err)
+	assert.Equal(t, "A", result.Grade)
+	assert.Equal(t, []string{"POST analyze observatory.mozilla.org 7"}, calls)
+
+	failure := errors.New("injected failure")
+	meter := new(recordingMeter)
+	c = NewCustomClient(
+		srv.Client(),
+		srv.URL,
+		option.WithMeter(meter),
+		option.WithMiddleware(func(middleware.Doer) middleware.Doer {
+			return middleware.DoerFunc(func(context.Context, *middleware.Call) (*middleware.Response, error) {
+				return &middleware.Response{StatusCode: http.StatusServiceUnavailable}, failure
+			})
+		}),
+	)
+	_, err = c.GetAssessment(context.Background(), "observatory.mozilla.org")
+	assert.ErrorIs(t, err, failure)
+	require.Len(t, meter.requests, 1)
+	assert.Equal(t, "GET analyze 503", meter.requests[0])
 }
 
 func Example_analyze() {
@@ -346,3 +797,94 @@ func Example_analyze() {
 	// Grade: A+, Score: 125
 	// Name: content-security-policy, Pass: true, Expectation: csp-implemented-with-no-unsafe
 }
+
+func TestClientBaseURL(t *testing.T) {
+	cases := []struct {
+		name     string
+		base     string
+		apiCall  string
+		query    url.Values
+		wantPath string
+		want     url.Values
+	}{
+		{name: "root", base: "", apiCall: ApiCallAnalyze, query: url.Values{"host": {"a.com"}}, wantPath: "/analyze", want: url.Values{"host": {"a.com"}}},
+		{name: "trailing slash", base: "/", apiCall: ApiCallGetGradeDistribution, wantPath: "/getGradeDistribution", want: url.Values{}},
+		{name: "prefix", base: "/observatory/api/v1/", apiCall: ApiCallAnalyze, query: url.Values{"host": {"a.com"}}, wantPath: "/observatory/api/v1/analyze", want: url.Values{"host": {"a.com"}}},
+		{name: "query", base: "/observatory/api/v1?tenant=sec&host=b.com", apiCall: ApiCallAnalyze, query: url.Values{"host": {"a.com"}}, wantPath: "/observatory/api/v1/analyze", want: url.Values{"host": {"a.com"}, "tenant": {"sec"}}},
+		{name: "heartbeat", base: "/observatory/api/v1", apiCall: ApiCallHeartbeat, wantPath: "/observatory/__heartbeat__", want: url.Values{}},
+		{name: "heartbeat without api path", base: "/observatory", apiCall: ApiCallHeartbeat, wantPath: "/observatory/__heartbeat__", want: url.Values{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, tc.wantPath, r.URL.Path)
+				assert.Equal(t, tc.want, r.URL.Query())
+				fmt.Fprint(w, "{}")
+			}))
+			defer srv.Close()
+
+			c := NewCustomClient(srv.Client(), srv.URL+tc.base)
+			err := c.doRequest(context.Background(), request{method: "GET", apiCall: tc.apiCall, queryParams: tc.query}, &map[string]interface{}{})
+			require.Nil(t, err)
+		})
+	}
+
+	c := NewCustomClient(http.DefaultClient, "observatory.example.com/api/v1")
+	_, err := c.GetGradeDistribution(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid base url")
+}
+
+func TestClientAuth(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []internaloption.ClientOption
+		want string
+	}{
+		{name: "none"},
+		{name: "bearer", opts: []internaloption.ClientOption{option.WithBearerToken("t0k3n")}, want: "Bearer t0k3n"},
+		{name: "basic", opts: []internaloption.ClientOption{option.WithBasicAuth("scanner", "s3cr3t")}, want: "Basic c2Nhbm5lcjpzM2NyM3Q="},
+		{name: "last wins", opts: []internaloption.ClientOption{option.WithBasicAuth("scanner", "s3cr3t"), option.WithBearerToken("t0k3n")}, want: "Bearer t0k3n"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, tc.want, r.Header.Get("Authorization"))
+				fmt.Fprint(w, "{}")
+			}))
+			defer srv.Close()
+
+			// Middlewares never see the credentials.
+			seen := middleware.Middleware(func(next middleware.Doer) middleware.Doer {
+				return middleware.DoerFunc(func(ctx context.Context, call *middleware.Call) (*middleware.Response, error) {
+					assert.Empty(t, call.Header.Get("Authorization"))
+					return next.Do(ctx, call)
+				})
+			})
+			c := NewCustomClient(srv.Client(), srv.URL, append(tc.opts, option.WithMiddleware(seen))...)
+			_, err := c.GetGradeDistribution(context.Background())
+			require.Nil(t, err)
+		})
+	}
+}
+
+func TestClientHealth(t *testing.T) {
+	healthy := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/__heartbeat__", r.URL.Path)
+		if !healthy {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"database": "FAIL"}`)
+			return
+		}
+		fmt.Fprint(w, `{"database": "OK"}`)
+	}))
+	defer srv.Close()
+
+	c := NewCustomClient(srv.Client(), srv.URL+"/api/v1")
+	assert.Nil(t, c.Health(context.Background()))
+	healthy = false
+	assert.NotNil(t, c.Health(context.Background()))
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/tigerwill90/observatory/baseline"
+	internaloption "github.com/tigerwill90/observatory/internal/option"
+	"github.com/tigerwill90/observatory/option"
+	"github.com/tigerwill90/observatory/policy"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+var checkCommand = &command{
+	name:  "check",
+	short: "check hosts against a policy or a baseline",
+	run:   runCheck,
+}
+
+// hostCheck is the result of the check of a host.
+type hostCheck struct {
+	Host     string           `json:"host"`
+	Policy   *policy.Report   `json:"policy,omitempty"`
+	Baseline *baseline.Report `json:"baseline,omitempty"`
+}
+
+// checkReport is the result of the check command.
+type checkReport struct {
+	Hosts []hostCheck `json:"hosts"`
+	// waivers that match none of the failures of the checked hosts
+	UnusedWaivers []*baseline.Waiver `json:"unused_waivers,omitempty"`
+}
+
+func runCheck(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: observatory check [-policy file] [-baseline file] [-inventory file] [flags] [host...]\n\n"+
+			"Scan each host and evaluate the result against the rules of a policy, the test failures against the waivers\n"+
+			"of a baseline, or both. Hosts of an inventory can override the scan settings and the policy they are checked\n"+
+			"against. Exit with status 1 if a rule or a test fail without a valid waiver.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	var cf clientFlags
+	cf.register(fs)
+	policyPath := fs.String("policy", "", "path of the YAML or JSON policy file, for the hosts without a policy in the inventory")
+	baselinePath := fs.String("baseline", "", "path of the YAML or JSON baseline file listing accepted failures")
+	rescan := fs.Bool("rescan", false, "ask for a new scan instead of reusing a recent one")
+	hidden := fs.Bool("hidden", false, "hide the scans from the public results")
+	poll := fs.Duration("poll", 5*time.Second, "delay between two retrievals of an ongoing scan")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	var inv inventoryFlags
+	inv.register(fs, "inventory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	hosts, err := inv.load(fs.Args())
+	if err != nil {
+		return err
+	}
+	if hosts.Len() == 0 {
+		fs.Usage()
+		return errors.New("expected at least one host")
+	}
+	policies, err := hosts.Policies()
+	if err != nil {
+		return err
+	}
+	if *policyPath == "" && *baselinePath == "" && len(policies) == 0 {
+		fs.Usage()
+		return errors.New("missing policy or baseline")
+	}
+
+	var p *policy.Policy
+	if *policyPath != "" {
+		if p, err = policy.Load(*policyPath); err != nil {
+			return err
+		}
+	}
+	var b *baseline.Baseline
+	if *baselinePath != "" {
+		if b, err = baseline.Load(*baselinePath); err != nil {
+			return err
+		}
+	}
+
+	c, err := cf.client()
+	if err != nil {
+		return err
+	}
+	report := &checkReport{Hosts: make([]hostCheck, 0, hosts.Len())}
+	baselines := make([]*baseline.Report, 0, hosts.Len())
+	now := time.Now()
+	for _, e := range hosts.Entries() {
+		host := e.Host
+		opts := append([]internaloption.Option{
+			option.WaitFinished(true, *poll),
+			option.ForceRescan(*rescan),
+			option.HideResult(*hidden),
+		}, e.Options()...)
+		result, err := c.Analyze(ctx, host, opts...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", host, err)
+		}
+		tests, err := c.GetTestResults(ctx, result.ScanID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", host, err)
+		}
+
+		hc := hostCheck{Host: host}
+		if b != nil {
+			hc.Baseline = b.Evaluate(host, tests, now)
+			baselines = append(baselines, hc.Baseline)
+		}
+		hostPolicy := p
+		if e.Policy != "" {
+			hostPolicy = policies[e.Policy]
+		}
+		if hostPolicy != nil {
+			hc.Policy = hostPolicy.Evaluate(host, result, tests)
+			hc.Policy.Waive(hc.Baseline)
+		}
+		report.Hosts = append(report.Hosts, hc)
+	}
+	report.UnusedWaivers = b.Unused(baselines...)
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else if err := printCheckReport(stdout, report); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, hc := range report.Hosts {
+		if hc.Policy != nil {
+			failed += len(hc.Policy.Failures())
+		}
+		if hc.Baseline != nil {
+			failed += len(hc.Baseline.Failures())
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d failure(s)", failed)
+	}
+	return nil
+}
+
+func printCheckReport(w io.Writer, report *checkReport) error {
+	var withPolicy, withBaseline bool
+	for _, hc := range report.Hosts {
+		withPolicy = withPolicy || hc.Policy != nil
+		withBaseline = withBaseline || hc.Baseline != nil
+	}
+
+	if withPolicy {
+		fmt.Fprintln(w, "Policy:")
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "  HOST\tRULE\tSTATUS\tEXPLANATION")
+		for _, hc := range report.Hosts {
+			for _, o := range hc.Policy.Outcomes {
+				status, explanation := passFail(o.Pass), o.Explanation
+				if o.Waived {
+					status, explanation = baseline.StatusWaived, explanation+" ("+o.Waiver.Justification+")"
+				}
+				fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", hc.Host, o.Rule, status, explanation)
+			}
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if withBaseline {
+		if withPolicy {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, "Failed tests:")
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "  HOST\tTEST\tSTATUS\tRESULT\tJUSTIFICATION")
+		for _, hc := range report.Hosts {
+			for _, o := range hc.Baseline.Tests {
+				if o.Status == baseline.StatusPass {
+					continue
+				}
+				justification := ""
+				if o.Waiver != nil {
+					justification = o.Waiver.Justification
+					if o.Status == baseline.StatusExpired {
+						justification = "expired on " + o.Waiver.Expires + ": " + justification
+					}
+				}
+				fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", hc.Host, o.Name, o.Status, o.Result, justification)
+			}
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(report.UnusedWaivers) > 0 {
+		fmt.Fprintln(w, "\nUnused waivers:")
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "  HOST\tTEST\tRESULT\tEXPIRES")
+		for _, waiver := range report.UnusedWaivers {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", waiver.Host, waiver.Test, waiver.Result, waiver.Expires)
+		}
+		return tw.Flush()
+	}
+	return nil
+}
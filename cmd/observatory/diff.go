@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/baseline"
+	"github.com/tigerwill90/observatory/diff"
+	"github.com/tigerwill90/observatory/store"
+	"github.com/tigerwill90/observatory/types"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+var diffCommand = &command{
+	name:  "diff",
+	short: "compare two scans of a host",
+	run:   runDiff,
+}
+
+func runDiff(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: observatory diff [flags] host\n\n"+
+			"Compare the two most recent scans of a host, or the scans selected with -old, -new and -since: their score,\n"+
+			"grade, tests and response headers. The api only return the response headers of the latest scan, use -store\n"+
+			"to compare those of the scans recorded by a monitor.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	var cf clientFlags
+	cf.register(fs)
+	oldID := fs.Int("old", 0, "scan ID of the old scan")
+	newID := fs.Int("new", 0, "scan ID of the new scan (default to the most recent scan)")
+	since := fs.Duration("since", 0, "select as old scan the most recent scan older than this duration, e.g. 168h")
+	storePath := fs.String("store", "", "path of a store recording the scans, to compare the response headers of scans older than the latest one")
+	storeType := fs.String("store-type", "bolt", "type of store, bolt or file")
+	baselinePath := fs.String("baseline", "", "path of a baseline file listing accepted failures, which are not regressions")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one host")
+	}
+	host := fs.Arg(0)
+
+	var b *baseline.Baseline
+	if *baselinePath != "" {
+		var err error
+		if b, err = baseline.Load(*baselinePath); err != nil {
+			return err
+		}
+	}
+
+	var s store.Store
+	if *storePath != "" {
+		var err error
+		if s, err = openStore(*storeType, *storePath); err != nil {
+			return err
+		}
+		defer s.Close()
+	}
+
+	c, err := cf.client()
+	if err != nil {
+		return err
+	}
+	// the store record the scans under the host the client scanned
+	if host, err = c.NormalizeHost(host); err != nil {
+		return err
+	}
+	histories, err := c.GetScanHistory(ctx, host)
+	if err != nil {
+		return err
+	}
+
+	oldScan, newScan, err := selectScans(histories, types.ScanID(*oldID), types.ScanID(*newID), *since, time.Now())
+	if err != nil {
+		return err
+	}
+
+	latest, err := c.GetAssessment(ctx, host)
+	if err != nil {
+		return err
+	}
+	old, err := loadScan(ctx, c, s, host, oldScan, latest)
+	if err != nil {
+		return err
+	}
+	new, err := loadScan(ctx, c, s, host, newScan, latest)
+	if err != nil {
+		return err
+	}
+
+	report := diff.Scans(old, new)
+	// without the response headers of a scan, every header of the other one would be reported as added or removed
+	headersKnown := old.Result.ResponseHeaders != nil && new.Result.ResponseHeaders != nil
+	if !headersKnown {
+		report.Headers = nil
+	}
+	if b != nil {
+		report.Waive(b.Evaluate(host, new.Tests, time.Now()))
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return printReport(stdout, host, report, headersKnown)
+}
+
+// loadScan return the result and test results of a scan of the host history. The result, with its response
+// headers, is read from the store if the scan was recorded, or is the latest assessment of the host if it is the
+// same scan. Otherwise, only the score and grade of the history are known.
+func loadScan(ctx context.Context, c *observatory.Client, s store.Store, host string, h *types.ScannerHostHistory, latest *types.ScannerResult) (*types.Scan, error) {
+	scan := &types.Scan{Result: &types.ScannerResult{ScanID: h.ScanId, Score: h.Score, Grade: h.Grade}}
+	if s != nil {
+		rec, err := s.Get(ctx, host, h.ScanId)
+		switch {
+		case err == nil:
+			if !rec.Partial {
+				scan.Result = rec.Result
+			}
+			scan.Tests = rec.Tests
+		case !errors.Is(err, store.ErrNotFound):
+			return nil, err
+		}
+	}
+	if scan.Result.ResponseHeaders == nil && latest.ScanID == h.ScanId {
+		scan.Result = latest
+	}
+	if scan.Tests == nil {
+		tests, err := c.GetTestResults(ctx, h.ScanId)
+		if err != nil {
+			return nil, err
+		}
+		scan.Tests = tests
+	}
+	return scan, nil
+}
+
+// selectScans pick the old and new scans to compare from the host history. By default, the most recent scan is
+// compared to the one before it.
+func selectScans(histories []*types.ScannerHostHistory, oldID, newID types.ScanID, since time.Duration, now time.Time) (*types.ScannerHostHistory, *types.ScannerHostHistory, error) {
+	if len(histories) == 0 {
+		return nil, nil, errors.New("no scan history found")
+	}
+
+	sorted := make([]*types.ScannerHostHistory, len(histories))
+	copy(sorted, histories)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].EndTimeUnixTimestamp < sorted[j].EndTimeUnixTimestamp
+	})
+
+	newIdx := len(sorted) - 1
+	if newID != 0 {
+		newIdx = indexOf(sorted, newID)
+		if newIdx < 0 {
+			return nil, nil, fmt.Errorf("scan %d not found in host history", newID)
+		}
+	}
+
+	oldIdx := newIdx - 1
+	switch {
+	case oldID != 0:
+		oldIdx = indexOf(sorted, oldID)
+		if oldIdx < 0 {
+			return nil, nil, fmt.Errorf("scan %d not found in host history", oldID)
+		}
+	case since > 0:
+		oldIdx = -1
+		limit := now.Add(-since).Unix()
+		for i := newIdx - 1; i >= 0; i-- {
+			if int64(sorted[i].EndTimeUnixTimestamp) <= limit {
+				oldIdx = i
+				break
+			}
+		}
+		if oldIdx < 0 {
+			return nil, nil, fmt.Errorf("no scan older than %s found in host history", since)
+		}
+	}
+	if oldIdx < 0 {
+		return nil, nil, errors.New("not enough scans in host history to compare")
+	}
+
+	return sorted[oldIdx], sorted[newIdx], nil
+}
+
+func indexOf(histories []*types.ScannerHostHistory, id types.ScanID) int {
+	for i, history := range histories {
+		if history.ScanId == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func printReport(w io.Writer, host string, report *diff.Report, headersKnown bool) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Host:\t%s\n", host)
+	fmt.Fprintf(tw, "Scan:\t%d -> %d\n", report.OldScanID, report.NewScanID)
+	fmt.Fprintf(tw, "Score:\t%d -> %d (%+d)\n", report.OldScore, report.NewScore, report.ScoreDelta())
+	fmt.Fprintf(tw, "Grade:\t%s -> %s\n", report.OldGrade, report.NewGrade)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if err := printTests(w, report); err != nil {
+		return err
+	}
+
+	switch {
+	case !headersKnown:
+		_, err := fmt.Fprintln(w, "\nResponse headers not compared, they are only known for the latest scan or with -store.")
+		return err
+	case len(report.Headers) == 0:
+		_, err := fmt.Fprintln(w, "\nNo response header changed.")
+		return err
+	}
+	fmt.Fprintln(w, "\nResponse headers:")
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  HEADER\tCHANGE\tVALUE")
+	for _, change := range report.Headers {
+		value := change.New
+		switch change.Kind {
+		case diff.HeaderRemoved:
+			value = change.Old
+		case diff.HeaderModified:
+			value = change.Old + " -> " + change.New
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", change.Name, change.Kind, value)
+	}
+	return tw.Flush()
+}
+
+func printTests(w io.Writer, report *diff.Report) error {
+	if len(report.Tests) == 0 {
+		_, err := fmt.Fprintln(w, "\nNo test changed.")
+		return err
+	}
+
+	fmt.Fprintln(w, "\nTests:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  TEST\tPASS\tMODIFIER\tRESULT")
+	for _, change := range report.Tests {
+		marker := " "
+		if change.Regressed() {
+			marker = "!"
+		}
+		waived := ""
+		if change.Waived() {
+			waived = "\twaived: " + change.Waiver.Justification
+		}
+		fmt.Fprintf(
+			tw,
+			"%s %s\t%s -> %s\t%d -> %d\t%s -> %s%s\n",
+			marker,
+			change.Name,
+			passFail(change.Old.Pass),
+			passFail(change.New.Pass),
+			change.Old.ScoreModifier,
+			change.New.ScoreModifier,
+			change.Old.Result,
+			change.New.Result,
+			waived,
+		)
+	}
+	return tw.Flush()
+}
+
+func passFail(pass bool) string {
+	if pass {
+		return "pass"
+	}
+	return "fail"
+}
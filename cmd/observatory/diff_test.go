@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/store"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestRunDiffHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{}
+		switch r.URL.Path {
+		case fmt.Sprintf("/%s", observatory.ApiCallGetHostHistory):
+			resp = []*types.ScannerHostHistory{
+				{ScanId: 1, EndTimeUnixTimestamp: 1614556800, Grade: "A", Score: 90},
+				{ScanId: 2, EndTimeUnixTimestamp: 1614643200, Grade: "B", Score: 70},
+			}
+		case fmt.Sprintf("/%s", observatory.ApiCallAnalyze):
+			resp = &types.ScannerResult{
+				ScanID:          2,
+				State:           observatory.Finished,
+				Grade:           "B",
+				Score:           70,
+				ResponseHeaders: map[string]string{"X-Frame-Options": "SAMEORIGIN", "Server": "nginx"},
+			}
+		case fmt.Sprintf("/%s", observatory.ApiCallGetScanResults):
+			resp = new(types.ScannerTestResult)
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	s, err := store.NewFileStore(dir)
+	require.Nil(t, err)
+	require.Nil(t, s.Save(context.Background(), &store.Record{
+		Host:   "observatory.mozilla.org",
+		ScanID: 1,
+		Time:   time.Unix(1614556800, 0),
+		Result: &types.ScannerResult{
+			ScanID:          1,
+			State:           observatory.Finished,
+			Grade:           "A",
+			Score:           90,
+			ResponseHeaders: map[string]string{"X-Frame-Options": "DENY", "X-Powered-By": "PHP"},
+		},
+		Tests: new(types.ScannerTestResult),
+	}))
+	require.Nil(t, s.Close())
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	require.Nil(t, runDiff(context.Background(), []string{"-endpoint", srv.URL, "-store", dir, "-store-type", "file", "observatory.mozilla.org"}))
+	assert.Contains(t, out.String(), "Grade:  A -> B")
+	assert.Contains(t, out.String(), "Response headers:")
+	assert.Regexp(t, regexp.MustCompile(`x-frame-options\s+modified\s+DENY -> SAMEORIGIN`), out.String())
+	assert.Regexp(t, regexp.MustCompile(`server\s+added\s+nginx`), out.String())
+	assert.Regexp(t, regexp.MustCompile(`x-powered-by\s+removed\s+PHP`), out.String())
+
+	// Without store, the headers of the old scan are unknown.
+	out.Reset()
+	require.Nil(t, runDiff(context.Background(), []string{"-endpoint", srv.URL, "observatory.mozilla.org"}))
+	assert.Contains(t, out.String(), "Response headers not compared")
+	assert.NotContains(t, out.String(), "x-frame-options")
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/tigerwill90/observatory/distribution"
+	"github.com/tigerwill90/observatory/store"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+var distributionCommand = &command{
+	name:  "distribution",
+	short: "record the grade distribution and rank hosts against it",
+	run:   runDistribution,
+}
+
+type distributionReport struct {
+	Snapshot *store.Snapshot      `json:"snapshot"`
+	Shares   []distribution.Share `json:"shares"`
+	// change since the previous snapshot, if any
+	Trend *distribution.Trend `json:"trend,omitempty"`
+	Hosts []hostStanding      `json:"hosts,omitempty"`
+}
+
+type hostStanding struct {
+	Host string `json:"host"`
+	*distribution.Standing
+}
+
+func runDistribution(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("distribution", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: observatory distribution [flags] [host...]\n\n"+
+			"Record a snapshot of the grade distribution of HTTP Observatory in the store, print the share of each\n"+
+			"grade and its change since a previous snapshot, and where the grade of each host stands against every\n"+
+			"scanned site.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	var cf clientFlags
+	cf.register(fs)
+	storePath := fs.String("store", "observatory.db", "path of the store, a bbolt database file or a directory with -store-type file")
+	storeType := fs.String("store-type", "bolt", "type of store, bolt or file")
+	since := fs.Duration("since", 0, "compare to the most recent snapshot at least this old, e.g. 2160h for a quarter, instead of the previous one")
+	noRecord := fs.Bool("no-record", false, "use the latest snapshot of the store instead of recording a new one")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	s, err := openStore(*storeType, *storePath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	snapshots, ok := s.(store.SnapshotStore)
+	if !ok {
+		return fmt.Errorf("store type %q does not support snapshots", *storeType)
+	}
+	c, err := cf.client()
+	if err != nil {
+		return err
+	}
+
+	report := new(distributionReport)
+	if *noRecord {
+		report.Snapshot, err = distribution.At(ctx, snapshots, time.Now())
+	} else {
+		report.Snapshot, err = distribution.Record(ctx, c, snapshots, time.Now())
+	}
+	if err != nil {
+		return err
+	}
+	report.Shares = distribution.Shares(&report.Snapshot.Distribution)
+
+	before := report.Snapshot.Time.Add(-time.Nanosecond)
+	if *since > 0 {
+		before = report.Snapshot.Time.Add(-*since)
+	}
+	previous, err := distribution.At(ctx, snapshots, before)
+	switch {
+	case err == nil:
+		report.Trend = distribution.Compare(previous, report.Snapshot)
+	case !errors.Is(err, distribution.ErrNoSnapshot):
+		return err
+	}
+
+	for _, host := range fs.Args() {
+		result, err := c.GetAssessment(ctx, host)
+		if err != nil {
+			return fmt.Errorf("%s: %w", host, err)
+		}
+		standing, err := distribution.StandingOf(&report.Snapshot.Distribution, result.Grade)
+		if err != nil {
+			return fmt.Errorf("%s: %w", host, err)
+		}
+		report.Hosts = append(report.Hosts, hostStanding{Host: host, Standing: standing})
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return printDistributionReport(stdout, report)
+}
+
+func printDistributionReport(w io.Writer, report *distributionReport) error {
+	snap := report.Snapshot
+	fmt.Fprintf(w, "Grade distribution of %s, %d sites", snap.Time.Format(time.RFC3339), snap.Distribution.Total())
+	if report.Trend != nil {
+		fmt.Fprintf(w, ", %+d since %s", report.Trend.Total, report.Trend.From.Format(time.RFC3339))
+	}
+	fmt.Fprintln(w, ":")
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if report.Trend != nil {
+		fmt.Fprintln(tw, "  GRADE\tSITES\tSHARE\tCHANGE")
+		for _, d := range report.Trend.Deltas {
+			fmt.Fprintf(tw, "  %s\t%d\t%.1f%%\t%+d (%+.1f pts)\n", d.Grade, d.New.Count, d.New.Percent, d.Count, d.Points)
+		}
+	} else {
+		fmt.Fprintln(tw, "  GRADE\tSITES\tSHARE")
+		for _, share := range report.Shares {
+			fmt.Fprintf(tw, "  %s\t%d\t%.1f%%\n", share.Grade, share.Count, share.Percent)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(report.Hosts) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w, "\nHosts:")
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  HOST\tGRADE\tSTANDING")
+	for _, h := range report.Hosts {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", h.Host, h.Grade, h.Standing)
+	}
+	return tw.Flush()
+}
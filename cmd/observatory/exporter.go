@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/tigerwill90/observatory/baseline"
+	"github.com/tigerwill90/observatory/exporter"
+	internaloption "github.com/tigerwill90/observatory/internal/option"
+	"github.com/tigerwill90/observatory/option"
+	"net/http"
+	"time"
+)
+
+var exporterCommand = &command{
+	name:  "exporter",
+	short: "expose host grades and scores as Prometheus metrics",
+	run:   runExporter,
+}
+
+func runExporter(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("exporter", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: observatory exporter [flags] [host...]\n\n"+
+			"Scan the hosts on a schedule and serve their results as Prometheus metrics on /metrics.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	var cf clientFlags
+	cf.register(fs)
+	listen := fs.String("listen", ":9111", "address to serve the metrics on")
+	var inv inventoryFlags
+	inv.register(fs, "hosts-file")
+	interval := fs.Duration("interval", exporter.DefaultInterval, "delay between two scans of every host")
+	concurrency := fs.Int("concurrency", exporter.DefaultConcurrency, "maximum number of hosts scanned at the same time")
+	rescan := fs.Bool("rescan", false, "force a rescan instead of using results cached by HTTP Observatory")
+	hidden := fs.Bool("hidden", true, "hide the scans from the public results")
+	baselinePath := fs.String("baseline", "", "path of a baseline file listing accepted failures, exposed by observatory_test_waived")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	hosts, err := inv.load(fs.Args())
+	if err != nil {
+		return err
+	}
+	if hosts.Len() == 0 {
+		fs.Usage()
+		return errors.New("no host to scan")
+	}
+	hostOptions := make(map[string][]internaloption.Option, hosts.Len())
+	for _, e := range hosts.Entries() {
+		hostOptions[e.Host] = e.Options()
+	}
+
+	var b *baseline.Baseline
+	if *baselinePath != "" {
+		if b, err = baseline.Load(*baselinePath); err != nil {
+			return err
+		}
+	}
+
+	c, err := cf.client()
+	if err != nil {
+		return err
+	}
+	e := exporter.New(c, exporter.Config{
+		Hosts:       hosts.Hosts(),
+		HostOptions: hostOptions,
+		Interval:    *interval,
+		Concurrency: *concurrency,
+		Baseline:    b,
+	}, option.ForceRescan(*rescan), option.HideResult(*hidden))
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	srv := &http.Server{Addr: *listen, Handler: mux}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	go func() {
+		_ = e.Run(ctx)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/tigerwill90/observatory/history"
+	"github.com/tigerwill90/observatory/store"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+var historyCommand = &command{
+	name:  "history",
+	short: "chart the score history of a host and detect regressions and flapping grades",
+	run:   runHistory,
+}
+
+func runHistory(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: observatory history [flags] host\n\n"+
+			"Chart the score history of a host and print its grade changes, regressions and whether its grade flap.\n"+
+			"The api only return the last scans of a host, use -store to merge them with the scans recorded by\n"+
+			"a monitor.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	var cf clientFlags
+	cf.register(fs)
+	storePath := fs.String("store", "", "path of the store to merge the history with, a bbolt database file or a directory with -store-type file")
+	storeType := fs.String("store-type", "bolt", "type of store, bolt or file")
+	width := fs.Int("width", 80, "maximum width of the chart, only the most recent scans are charted")
+	height := fs.Int("height", 10, "height of the chart")
+	asJSON := fs.Bool("json", false, "print the analysis as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one host")
+	}
+	c, err := cf.client()
+	if err != nil {
+		return err
+	}
+	host, err := c.NormalizeHost(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var s store.Store
+	if *storePath != "" {
+		if s, err = openStore(*storeType, *storePath); err != nil {
+			return err
+		}
+		defer s.Close()
+	}
+
+	scans, err := history.Load(ctx, c, s, host)
+	if err != nil {
+		return err
+	}
+	a := history.Analyze(host, scans, time.Now())
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(a)
+	}
+	return printAnalysis(stdout, a, *width, *height)
+}
+
+func printAnalysis(w io.Writer, a *history.Analysis, width, height int) error {
+	if len(a.Scans) == 0 {
+		fmt.Fprintf(w, "No scan of %s\n", a.Host)
+		return nil
+	}
+	fmt.Fprintf(w, "History of %s, %d scans, last scan %s ago:\n\n", a.Host, len(a.Scans), a.SinceLastScan.Round(time.Minute))
+	fmt.Fprint(w, history.Chart(a.Scans, width, height))
+
+	fmt.Fprintf(w, "\nRegressions: %d", a.Regressions)
+	if a.MeanTimeBetweenRegressions > 0 {
+		fmt.Fprintf(w, ", every %s on average", a.MeanTimeBetweenRegressions.Round(time.Minute))
+	}
+	fmt.Fprintln(w)
+	flapping := "no"
+	if a.Flapping {
+		flapping = "yes"
+	}
+	fmt.Fprintf(w, "Flapping: %s, %d grade changes reverted\n", flapping, a.Flaps)
+
+	if len(a.Changes) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w, "\nGrade changes:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  TIME\tSCAN\tGRADE\tSCORE\t")
+	for _, change := range a.Changes {
+		mark := ""
+		if change.Regression() {
+			mark = "regression"
+		}
+		fmt.Fprintf(tw, "  %s\t%d\t%s -> %s\t%d -> %d\t%s\n", change.To.Time.Format(time.RFC3339), change.To.ScanID,
+			change.From.Grade, change.To.Grade, change.From.Score, change.To.Score, mark)
+	}
+	return tw.Flush()
+}
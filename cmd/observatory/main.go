@@ -0,0 +1,178 @@
+// Command observatory is a command line client for the HTTP Observatory api.
+//
+// Usage:
+//
+//	observatory <command> [flags] [arguments]
+//
+// Run "observatory <command> -h" to print the usage of a command.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/tigerwill90/observatory"
+	internaloption "github.com/tigerwill90/observatory/internal/option"
+	"github.com/tigerwill90/observatory/inventory"
+	"github.com/tigerwill90/observatory/option"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// stdout is where the commands print their report.
+var stdout io.Writer = os.Stdout
+
+type command struct {
+	name  string
+	short string
+	// run execute the command with the arguments that follow its name.
+	run func(ctx context.Context, args []string) error
+}
+
+var commands = []*command{
+	checkCommand,
+	diffCommand,
+	distributionCommand,
+	exporterCommand,
+	historyCommand,
+	monitorCommand,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err := cmd.run(ctx, os.Args[2:])
+		stop()
+		if err == flag.ErrHelp {
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "observatory %s: %s\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "observatory: unknown command %q\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: observatory <command> [flags] [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.short)
+	}
+}
+
+// clientFlags register the flags shared by every command that talk to the api.
+type clientFlags struct {
+	endpoint   string
+	timeout    time.Duration
+	token      string
+	basicAuth  string
+	caBundle   string
+	clientCert string
+	clientKey  string
+	// consecutive failures opening the circuit breaker, 0 to disable it
+	breakerThreshold int
+	breakerCooldown  time.Duration
+}
+
+func (f *clientFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.endpoint, "endpoint", observatory.Endpoint, "HTTP Observatory api endpoint, such as https://observatory.example.com/api/v1 for a self-hosted instance")
+	fs.DurationVar(&f.timeout, "timeout", 10*time.Second, "timeout of each api request")
+	fs.StringVar(&f.token, "bearer-token", os.Getenv("OBSERVATORY_BEARER_TOKEN"), "bearer token sent to the endpoint, default to $OBSERVATORY_BEARER_TOKEN")
+	fs.StringVar(&f.basicAuth, "basic-auth", os.Getenv("OBSERVATORY_BASIC_AUTH"), "user:password sent to the endpoint, default to $OBSERVATORY_BASIC_AUTH")
+	fs.StringVar(&f.caBundle, "ca-bundle", "", "PEM file of the CAs trusted in addition to the system ones")
+	fs.StringVar(&f.clientCert, "client-cert", "", "PEM file of the client certificate, for mTLS")
+	fs.StringVar(&f.clientKey, "client-key", "", "PEM file of the key of the client certificate")
+	fs.IntVar(&f.breakerThreshold, "circuit-breaker", 0, "fail fast after this many consecutive failures of the endpoint, 0 to disable")
+	fs.DurationVar(&f.breakerCooldown, "circuit-cooldown", 30*time.Second, "delay before retrying an endpoint once the circuit breaker is open")
+}
+
+func (f *clientFlags) client() (*observatory.Client, error) {
+	opts := make([]internaloption.ClientOption, 0, 3)
+	if f.token != "" {
+		opts = append(opts, option.WithBearerToken(f.token))
+	}
+	if f.basicAuth != "" {
+		i := strings.Index(f.basicAuth, ":")
+		if i < 0 {
+			return nil, errors.New("basic auth must be user:password")
+		}
+		opts = append(opts, option.WithBasicAuth(f.basicAuth[:i], f.basicAuth[i+1:]))
+	}
+	if f.caBundle != "" {
+		pool, err := observatory.LoadCABundle(f.caBundle)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, option.WithRootCAs(pool))
+	}
+	if f.clientCert != "" || f.clientKey != "" {
+		cert, err := tls.LoadX509KeyPair(f.clientCert, f.clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		opts = append(opts, option.WithClientCertificate(cert))
+	}
+	if f.breakerThreshold > 0 {
+		opts = append(opts, option.WithCircuitBreaker(f.breakerThreshold, f.breakerCooldown))
+	}
+	return observatory.NewCustomClient(&http.Client{Timeout: f.timeout}, f.endpoint, opts...), nil
+}
+
+// inventoryFlags register a repeatable flag listing inventory files.
+type inventoryFlags struct {
+	paths []string
+}
+
+func (f *inventoryFlags) String() string {
+	return strings.Join(f.paths, ",")
+}
+
+func (f *inventoryFlags) Set(value string) error {
+	f.paths = append(f.paths, value)
+	return nil
+}
+
+func (f *inventoryFlags) register(fs *flag.FlagSet, name string) {
+	fs.Var(f, name, "inventory file of hosts, can be repeated: YAML or JSON (.yaml, .yml, .json), CSV (.csv),\n"+
+		"DNS zone (.zone, .db), or one host per line otherwise")
+}
+
+// load return the inventory of the files and of the hosts given as arguments.
+func (f *inventoryFlags) load(hosts []string) (*inventory.Inventory, error) {
+	inv, err := inventory.Load(f.paths...)
+	if err != nil {
+		return nil, err
+	}
+	for _, host := range hosts {
+		if err := inv.Add(inventory.Entry{Host: host}); err != nil {
+			return nil, err
+		}
+	}
+	return inv, nil
+}
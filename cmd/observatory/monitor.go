@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/tigerwill90/observatory/baseline"
+	"github.com/tigerwill90/observatory/logging"
+	"github.com/tigerwill90/observatory/monitor"
+	"github.com/tigerwill90/observatory/notify"
+	"github.com/tigerwill90/observatory/store"
+	"net/http"
+	"os"
+	"time"
+)
+
+var monitorCommand = &command{
+	name:  "monitor",
+	short: "scan hosts on a schedule and notify on security regressions",
+	run:   runMonitor,
+}
+
+func runMonitor(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("monitor", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: observatory monitor -config file [flags]\n\n"+
+			"Scan the hosts listed in the YAML or JSON config file on schedule, save every result in the store,\n"+
+			"notify grade drops, newly failing tests, policy violations and failed scans to the configured notifiers\n"+
+			"and to stderr, unless the failures are waived by the baseline, and serve the status of each host on /hosts.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	var cf clientFlags
+	cf.register(fs)
+	configPath := fs.String("config", "", "monitor config file")
+	listen := fs.String("listen", ":9112", "address to serve the status API on")
+	storePath := fs.String("store", "observatory.db", "path of the store, a bbolt database file or a directory with -store-type file")
+	storeType := fs.String("store-type", "bolt", "type of store, bolt or file")
+	logLevel := fs.String("log-level", "info", "minimum level of the logs written to stderr")
+	baselinePath := fs.String("baseline", "", "path of a baseline file listing accepted failures, instead of the baseline of the config")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *configPath == "" {
+		fs.Usage()
+		return errors.New("missing -config")
+	}
+
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		return err
+	}
+	cfg, err := monitor.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if *baselinePath != "" {
+		if cfg.Baseline, err = baseline.Load(*baselinePath); err != nil {
+			return err
+		}
+	}
+	s, err := openStore(*storeType, *storePath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	text := logging.NewTextLogger(os.Stderr)
+	logger := logging.LoggerFunc(func(ctx context.Context, l logging.Level, msg string, fields ...logging.Field) {
+		if l >= level {
+			text.Log(ctx, l, msg, fields...)
+		}
+	})
+	cfg.Logger = logger
+	c, err := cf.client()
+	if err != nil {
+		return err
+	}
+	m, err := monitor.New(c, s, *cfg, notify.NewLogNotifier(logger))
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Addr: *listen, Handler: m}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	runc := make(chan error, 1)
+	go func() {
+		runc <- m.Run(ctx)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case err := <-runc:
+		if ctx.Err() == nil {
+			return err
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+func openStore(typ, path string) (store.Store, error) {
+	switch typ {
+	case "bolt":
+		return store.NewBoltStore(path)
+	case "file":
+		return store.NewFileStore(path)
+	default:
+		return nil, fmt.Errorf("unknown store type %q", typ)
+	}
+}
@@ -0,0 +1,194 @@
+// Package diff compare two scans of the same host, which allows to find out which tests, headers, score and grade
+// changed between them.
+package diff
+
+import (
+	"github.com/tigerwill90/observatory/baseline"
+	"github.com/tigerwill90/observatory/grader"
+	"github.com/tigerwill90/observatory/types"
+	"sort"
+	"strings"
+)
+
+const (
+	HeaderAdded    = "added"
+	HeaderRemoved  = "removed"
+	HeaderModified = "modified"
+)
+
+// Report hold the differences between an old and a new scan.
+type Report struct {
+	// unique ID of the old scan, if known
+	OldScanID types.ScanID `json:"old_scan_id,omitempty"`
+	// unique ID of the new scan, if known
+	NewScanID types.ScanID `json:"new_scan_id,omitempty"`
+	// final score of the old scan
+	OldScore int `json:"old_score"`
+	// final score of the new scan
+	NewScore int `json:"new_score"`
+	// final grade of the old scan
+	OldGrade string `json:"old_grade"`
+	// final grade of the new scan
+	NewGrade string `json:"new_grade"`
+	// tests whose outcome changed, ordered by name
+	Tests []TestChange `json:"tests"`
+	// response headers that changed, ordered by name, only compared by Scans
+	Headers []HeaderChange `json:"headers,omitempty"`
+}
+
+// TestChange describe a test whose outcome changed between two scans.
+type TestChange struct {
+	Name string            `json:"name"`
+	Old  types.TestSummary `json:"old"`
+	New  types.TestSummary `json:"new"`
+	// waiver accepting the failure of the new test, if any, set by Report.Waive
+	Waiver *baseline.Waiver `json:"waiver,omitempty"`
+}
+
+// HeaderChange describe a response header that changed between two scans.
+type HeaderChange struct {
+	// lower case name of the header
+	Name string `json:"name"`
+	// one of HeaderAdded, HeaderRemoved or HeaderModified
+	Kind string `json:"kind"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+// Diff compare the detailed test results of two scans. Since test results do not carry the final score,
+// the score and grade of each scan are recomputed with the grader package. The response headers are not
+// part of the test results, use Scans to compare them.
+func Diff(old, new *types.ScannerTestResult) *Report {
+	oldTests, newTests := old.Summaries(), new.Summaries()
+	oldScore, newScore := grader.Score(oldTests), grader.Score(newTests)
+	oldGrade, _ := grader.Grade(oldScore)
+	newGrade, _ := grader.Grade(newScore)
+
+	return &Report{
+		OldScore: oldScore,
+		NewScore: newScore,
+		OldGrade: oldGrade,
+		NewGrade: newGrade,
+		Tests:    diffTests(oldTests, newTests),
+	}
+}
+
+// Scans compare two complete scans. Unlike Diff, the score and grade are taken from the scan result,
+// and the response headers are compared as well.
+func Scans(old, new *types.Scan) *Report {
+	report := Diff(old.Tests, new.Tests)
+	report.OldScanID = old.Result.ScanID
+	report.NewScanID = new.Result.ScanID
+	report.OldScore = old.Result.Score
+	report.NewScore = new.Result.Score
+	report.OldGrade = old.Result.Grade
+	report.NewGrade = new.Result.Grade
+	report.Headers = Headers(old.Result.ResponseHeaders, new.Result.ResponseHeaders)
+	return report
+}
+
+// Headers compare two sets of response headers. Header names are compared case-insensitively.
+func Headers(old, new map[string]string) []HeaderChange {
+	oldHeaders, newHeaders := lowerKeys(old), lowerKeys(new)
+
+	changes := make([]HeaderChange, 0)
+	for name, oldValue := range oldHeaders {
+		newValue, ok := newHeaders[name]
+		if !ok {
+			changes = append(changes, HeaderChange{Name: name, Kind: HeaderRemoved, Old: oldValue})
+			continue
+		}
+		if oldValue != newValue {
+			changes = append(changes, HeaderChange{Name: name, Kind: HeaderModified, Old: oldValue, New: newValue})
+		}
+	}
+	for name, newValue := range newHeaders {
+		if _, ok := oldHeaders[name]; !ok {
+			changes = append(changes, HeaderChange{Name: name, Kind: HeaderAdded, New: newValue})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// ScoreDelta return the score difference between the new and the old scan.
+func (r *Report) ScoreDelta() int {
+	return r.NewScore - r.OldScore
+}
+
+// GradeChanged return true if the grade differ between the two scans.
+func (r *Report) GradeChanged() bool {
+	return r.OldGrade != r.NewGrade
+}
+
+// Regressions return the tests that got worse, either because they no longer pass or because
+// their score modifier decreased.
+func (r *Report) Regressions() []TestChange {
+	regressions := make([]TestChange, 0)
+	for _, change := range r.Tests {
+		if change.Regressed() {
+			regressions = append(regressions, change)
+		}
+	}
+	return regressions
+}
+
+// Waive attach to the tests that changed the waiver accepting their new failure, as found in the baseline
+// report of the new scan. A waived test is not a regression.
+func (r *Report) Waive(b *baseline.Report) {
+	for i, change := range r.Tests {
+		if o, ok := b.Outcome(change.Name); ok && o.Status == baseline.StatusWaived {
+			r.Tests[i].Waiver = o.Waiver
+		}
+	}
+}
+
+// Empty return true if nothing changed between the two scans.
+func (r *Report) Empty() bool {
+	return len(r.Tests) == 0 && len(r.Headers) == 0 && r.OldScore == r.NewScore && !r.GradeChanged()
+}
+
+// Flipped return true if the test changed from pass to fail or from fail to pass.
+func (c TestChange) Flipped() bool {
+	return c.Old.Pass != c.New.Pass
+}
+
+// ModifierDelta return the score modifier difference between the new and the old test.
+func (c TestChange) ModifierDelta() int {
+	return c.New.ScoreModifier - c.Old.ScoreModifier
+}
+
+// Regressed return true if the test no longer pass or if its score modifier decreased, unless the failure
+// of the new test is waived.
+func (c TestChange) Regressed() bool {
+	if c.Waived() {
+		return false
+	}
+	return (c.Old.Pass && !c.New.Pass) || c.ModifierDelta() < 0
+}
+
+// Waived return true if the failure of the new test is waived.
+func (c TestChange) Waived() bool {
+	return c.Waiver != nil
+}
+
+func diffTests(old, new []types.TestSummary) []TestChange {
+	changes := make([]TestChange, 0)
+	for i := range old {
+		if old[i].Pass != new[i].Pass || old[i].Result != new[i].Result || old[i].ScoreModifier != new[i].ScoreModifier {
+			changes = append(changes, TestChange{Name: old[i].Name, Old: old[i], New: new[i]})
+		}
+	}
+	return changes
+}
+
+func lowerKeys(headers map[string]string) map[string]string {
+	lower := make(map[string]string, len(headers))
+	for name, value := range headers {
+		lower[strings.ToLower(name)] = value
+	}
+	return lower
+}
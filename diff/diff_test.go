@@ -0,0 +1,106 @@
+package diff
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory/baseline"
+	"github.com/tigerwill90/observatory/types"
+	"testing"
+	"time"
+)
+
+func newScan(id types.ScanID, score int, grade string, headers map[string]string) *types.Scan {
+	tests := new(types.ScannerTestResult)
+	tests.ContentSecurityPolicy.Result = "csp-implemented-with-no-unsafe"
+	tests.ContentSecurityPolicy.ScoreModifier = 5
+	tests.ContentSecurityPolicy.Pass = true
+	tests.StrictTransportSecurity.Result = "hsts-preloaded"
+	tests.StrictTransportSecurity.ScoreModifier = 5
+	tests.StrictTransportSecurity.Pass = true
+	tests.XFrameOptions.Result = "x-frame-options-sameorigin-or-deny"
+	tests.XFrameOptions.Pass = true
+	return &types.Scan{
+		Result: &types.ScannerResult{
+			ScanID:          id,
+			Score:           score,
+			Grade:           grade,
+			ResponseHeaders: headers,
+		},
+		Tests: tests,
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := newScan(1, 110, "A+", nil)
+	new := newScan(2, 75, "B", nil)
+	new.Tests.StrictTransportSecurity.Result = "hsts-implemented-max-age-at-least-six-months"
+	new.Tests.StrictTransportSecurity.ScoreModifier = 0
+	new.Tests.XFrameOptions.Result = "x-frame-options-not-implemented"
+	new.Tests.XFrameOptions.ScoreModifier = -20
+	new.Tests.XFrameOptions.Pass = false
+
+	report := Diff(old.Tests, new.Tests)
+	assert.Equal(t, 110, report.OldScore)
+	assert.Equal(t, 80, report.NewScore)
+	assert.Equal(t, -30, report.ScoreDelta())
+	assert.Equal(t, "A+", report.OldGrade)
+	assert.Equal(t, "B+", report.NewGrade)
+	assert.True(t, report.GradeChanged())
+	assert.Nil(t, report.Headers)
+	require.Len(t, report.Tests, 2)
+
+	hsts, xfo := report.Tests[0], report.Tests[1]
+	assert.Equal(t, types.TestStrictTransportSecurity, hsts.Name)
+	assert.False(t, hsts.Flipped())
+	assert.Equal(t, -5, hsts.ModifierDelta())
+	assert.Equal(t, types.TestXFrameOptions, xfo.Name)
+	assert.True(t, xfo.Flipped())
+	assert.Equal(t, -20, xfo.ModifierDelta())
+	assert.Len(t, report.Regressions(), 2)
+
+	b := &baseline.Baseline{Waivers: []*baseline.Waiver{{
+		Host:          "www.example.com",
+		Test:          types.TestXFrameOptions,
+		Result:        "x-frame-options-not-implemented",
+		Expires:       "2021-06-30",
+		Justification: "legacy iframe integration",
+	}}}
+	require.Nil(t, b.Validate())
+	report.Waive(b.Evaluate("www.example.com", new.Tests, time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, report.Tests[1].Waived())
+	assert.Len(t, report.Regressions(), 1)
+}
+
+func TestDiffUnchanged(t *testing.T) {
+	old := newScan(1, 110, "A+", nil)
+	new := newScan(2, 110, "A+", nil)
+	assert.True(t, Diff(old.Tests, new.Tests).Empty())
+}
+
+func TestScans(t *testing.T) {
+	old := newScan(1, 110, "A+", map[string]string{
+		"Content-Type":            "text/html",
+		"X-Frame-Options":         "DENY",
+		"Content-Security-Policy": "default-src 'self'",
+	})
+	new := newScan(2, 115, "A+", map[string]string{
+		"content-type":              "text/html",
+		"x-frame-options":           "SAMEORIGIN",
+		"strict-transport-security": "max-age=63072000",
+	})
+	new.Tests.XFrameOptions.Result = "x-frame-options-implemented-via-csp"
+	new.Tests.XFrameOptions.ScoreModifier = 5
+
+	report := Scans(old, new)
+	assert.Equal(t, types.ScanID(1), report.OldScanID)
+	assert.Equal(t, types.ScanID(2), report.NewScanID)
+	assert.Equal(t, 5, report.ScoreDelta())
+	assert.False(t, report.GradeChanged())
+	assert.Empty(t, report.Regressions())
+	require.Len(t, report.Tests, 1)
+	assert.Equal(t, []HeaderChange{
+		{Name: "content-security-policy", Kind: HeaderRemoved, Old: "default-src 'self'"},
+		{Name: "strict-transport-security", Kind: HeaderAdded, New: "max-age=63072000"},
+		{Name: "x-frame-options", Kind: HeaderModified, Old: "DENY", New: "SAMEORIGIN"},
+	}, report.Headers)
+}
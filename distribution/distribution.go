@@ -0,0 +1,156 @@
+// Package distribution track the grade distribution of HTTP Observatory over time. Snapshots of the distribution
+// are recorded in a store.SnapshotStore, from which the share of each grade, its trend between two snapshots and
+// the standing of a grade against every scanned site, e.g. better than 87% of the scanned sites, are computed.
+package distribution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/grader"
+	"github.com/tigerwill90/observatory/store"
+	"github.com/tigerwill90/observatory/types"
+	"time"
+)
+
+var (
+	ErrNoSnapshot   = errors.New("no snapshot")
+	ErrUnknownGrade = errors.New("unknown grade")
+)
+
+// Share is the number of sites with a grade, and their percentage of every scanned site.
+type Share struct {
+	Grade   string  `json:"grade"`
+	Count   int     `json:"count"`
+	Percent float64 `json:"percent"`
+}
+
+// Shares return the share of each grade, from the best to the worst.
+func Shares(d *types.ScannerGradeDistribution) []Share {
+	total := d.Total()
+	shares := make([]Share, 0, len(grader.Grades))
+	for _, grade := range grader.Grades {
+		count := d.Count(grade)
+		shares = append(shares, Share{Grade: grade, Count: count, Percent: percent(count, total)})
+	}
+	return shares
+}
+
+// Delta is the change of the share of a grade between two snapshots.
+type Delta struct {
+	Grade string `json:"grade"`
+	// share of the grade in the old and in the new snapshot
+	Old Share `json:"old"`
+	New Share `json:"new"`
+	// change of the number of sites
+	Count int `json:"count"`
+	// change of the percentage, in percentage points
+	Points float64 `json:"points"`
+}
+
+// Trend is the change of the distribution between two snapshots.
+type Trend struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// change of the number of scanned sites
+	Total  int     `json:"total"`
+	Deltas []Delta `json:"deltas"`
+}
+
+// Compare return the change of the distribution from the old snapshot to the new one, for each grade from the
+// best to the worst.
+func Compare(old, new *store.Snapshot) *Trend {
+	oldShares, newShares := Shares(&old.Distribution), Shares(&new.Distribution)
+	trend := &Trend{
+		From:   old.Time,
+		To:     new.Time,
+		Total:  new.Distribution.Total() - old.Distribution.Total(),
+		Deltas: make([]Delta, 0, len(oldShares)),
+	}
+	for i := range oldShares {
+		trend.Deltas = append(trend.Deltas, Delta{
+			Grade:  oldShares[i].Grade,
+			Old:    oldShares[i],
+			New:    newShares[i],
+			Count:  newShares[i].Count - oldShares[i].Count,
+			Points: newShares[i].Percent - oldShares[i].Percent,
+		})
+	}
+	return trend
+}
+
+// Standing is the position of a grade against every scanned site.
+type Standing struct {
+	Grade string `json:"grade"`
+	// percentage of the sites with a lower grade
+	BetterThan float64 `json:"better_than"`
+	// percentage of the sites with the same grade
+	Same float64 `json:"same"`
+	// percentage of the sites with a higher grade
+	WorseThan float64 `json:"worse_than"`
+}
+
+// String describe the standing, e.g. "better than 87.0% of scanned sites".
+func (s *Standing) String() string {
+	return fmt.Sprintf("better than %.1f%% of scanned sites", s.BetterThan)
+}
+
+// StandingOf return the standing of the grade in the distribution.
+func StandingOf(d *types.ScannerGradeDistribution, grade string) (*Standing, error) {
+	rank := grader.Rank(grade)
+	if rank == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownGrade, grade)
+	}
+
+	var lower, same, higher int
+	for _, g := range grader.Grades {
+		switch r := grader.Rank(g); {
+		case r < rank:
+			lower += d.Count(g)
+		case r == rank:
+			same += d.Count(g)
+		default:
+			higher += d.Count(g)
+		}
+	}
+	total := d.Total()
+	return &Standing{
+		Grade:      grade,
+		BetterThan: percent(lower, total),
+		Same:       percent(same, total),
+		WorseThan:  percent(higher, total),
+	}, nil
+}
+
+// Record retrieve the grade distribution with c and save it as a snapshot taken at now.
+func Record(ctx context.Context, c *observatory.Client, s store.SnapshotStore, now time.Time) (*store.Snapshot, error) {
+	d, err := c.GetGradeDistribution(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snap := &store.Snapshot{Time: now.UTC(), Distribution: *d}
+	if err := s.SaveSnapshot(ctx, snap); err != nil {
+		return nil, fmt.Errorf("save snapshot failed: %w", err)
+	}
+	return snap, nil
+}
+
+// At return the most recent snapshot taken at or before t, or ErrNoSnapshot.
+func At(ctx context.Context, s store.SnapshotStore, t time.Time) (*store.Snapshot, error) {
+	snapshots, err := s.Snapshots(ctx, time.Time{}, t.Add(time.Nanosecond))
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, fmt.Errorf("%w: taken before %s", ErrNoSnapshot, t.Format(time.RFC3339))
+	}
+	return snapshots[len(snapshots)-1], nil
+}
+
+func percent(count, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(count) / float64(total)
+}
@@ -0,0 +1,111 @@
+package distribution
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/store"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestShares(t *testing.T) {
+	d := &types.ScannerGradeDistribution{A: 10, A1: 30, F: 60}
+	shares := Shares(d)
+	require.Len(t, shares, 13)
+	assert.Equal(t, Share{Grade: "A+", Count: 10, Percent: 10}, shares[0])
+	assert.Equal(t, Share{Grade: "A", Count: 30, Percent: 30}, shares[1])
+	assert.Equal(t, Share{Grade: "B+", Count: 0, Percent: 0}, shares[3])
+	assert.Equal(t, Share{Grade: "F", Count: 60, Percent: 60}, shares[12])
+
+	for _, share := range Shares(new(types.ScannerGradeDistribution)) {
+		assert.Zero(t, share.Percent)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	from := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 3, 0)
+	trend := Compare(
+		&store.Snapshot{Time: from, Distribution: types.ScannerGradeDistribution{A: 10, F: 90}},
+		&store.Snapshot{Time: to, Distribution: types.ScannerGradeDistribution{A: 50, F: 150}},
+	)
+	assert.Equal(t, from, trend.From)
+	assert.Equal(t, to, trend.To)
+	assert.Equal(t, 100, trend.Total)
+	require.Len(t, trend.Deltas, 13)
+	assert.Equal(t, Delta{
+		Grade:  "A+",
+		Old:    Share{Grade: "A+", Count: 10, Percent: 10},
+		New:    Share{Grade: "A+", Count: 50, Percent: 25},
+		Count:  40,
+		Points: 15,
+	}, trend.Deltas[0])
+	assert.Equal(t, 60, trend.Deltas[12].Count)
+	assert.Equal(t, float64(-15), trend.Deltas[12].Points)
+}
+
+func TestStandingOf(t *testing.T) {
+	d := &types.ScannerGradeDistribution{A: 3, A1: 5, B2: 5, F: 87}
+
+	cases := []struct {
+		grade string
+		want  *Standing
+	}{
+		{grade: "A", want: &Standing{Grade: "A", BetterThan: 92, Same: 5, WorseThan: 3}},
+		{grade: "A+", want: &Standing{Grade: "A+", BetterThan: 97, Same: 3, WorseThan: 0}},
+		{grade: "C", want: &Standing{Grade: "C", BetterThan: 87, Same: 0, WorseThan: 13}},
+		{grade: "F", want: &Standing{Grade: "F", BetterThan: 0, Same: 87, WorseThan: 13}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.grade, func(t *testing.T) {
+			got, err := StandingOf(d, tc.grade)
+			require.Nil(t, err)
+			assert.InDelta(t, tc.want.BetterThan, got.BetterThan, 1e-9)
+			assert.InDelta(t, tc.want.Same, got.Same, 1e-9)
+			assert.InDelta(t, tc.want.WorseThan, got.WorseThan, 1e-9)
+		})
+	}
+
+	standing, err := StandingOf(d, "C")
+	require.Nil(t, err)
+	assert.Equal(t, "better than 87.0% of scanned sites", standing.String())
+
+	_, err = StandingOf(d, "E")
+	assert.ErrorIs(t, err, ErrUnknownGrade)
+}
+
+func TestRecord(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewEncoder(w).Encode(&types.ScannerGradeDistribution{A: 42, F: 58}); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer srv.Close()
+	c := observatory.NewCustomClient(srv.Client(), srv.URL)
+	s, err := store.NewFileStore(t.TempDir())
+	require.Nil(t, err)
+	ctx := context.Background()
+
+	_, err = At(ctx, s, time.Now())
+	assert.ErrorIs(t, err, ErrNoSnapshot)
+
+	now := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+	snap, err := Record(ctx, c, s, now)
+	require.Nil(t, err)
+	assert.Equal(t, 42, snap.Distribution.A)
+
+	got, err := At(ctx, s, now)
+	require.Nil(t, err)
+	assert.Equal(t, snap, got)
+	got, err = At(ctx, s, now.AddDate(0, 3, 0))
+	require.Nil(t, err)
+	assert.Equal(t, snap, got)
+	_, err = At(ctx, s, now.Add(-time.Second))
+	assert.ErrorIs(t, err, ErrNoSnapshot)
+}
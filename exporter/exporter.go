@@ -0,0 +1,289 @@
+// Package exporter periodically scan a list of hosts and expose their HTTP Observatory score, grade and test
+// results as Prometheus metrics.
+package exporter
+
+import (
+	"context"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/baseline"
+	"github.com/tigerwill90/observatory/grader"
+	"github.com/tigerwill90/observatory/internal/option"
+	publicoption "github.com/tigerwill90/observatory/option"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultInterval    = time.Hour
+	DefaultConcurrency = 4
+)
+
+// Config configure which hosts are scanned by an Exporter and how.
+type Config struct {
+	// hosts to scan
+	Hosts []string
+	// options of a host, passed to Client.Analyze after the options given to New
+	HostOptions map[string][]option.Option
+	// delay between two scans of all hosts, default to DefaultInterval
+	Interval time.Duration
+	// maximum number of hosts scanned at the same time, default to DefaultConcurrency
+	Concurrency int
+	// accepted test failures, which enable the observatory_test_waived and observatory_waivers_unused metrics
+	Baseline *baseline.Baseline
+}
+
+type hostState struct {
+	result *types.ScannerResult
+	tests  *types.ScannerTestResult
+	errors uint64
+}
+
+// Exporter scan hosts on a schedule with Client.Analyze and serve the last result of each host as
+// Prometheus metrics. An Exporter is an http.Handler.
+type Exporter struct {
+	client             *observatory.Client
+	cfg                Config
+	opts               []option.Option
+	mu                 sync.RWMutex
+	hosts              map[string]*hostState
+	distribution       *types.ScannerGradeDistribution
+	distributionErrors uint64
+	now                func() time.Time
+}
+
+var _ http.Handler = (*Exporter)(nil)
+
+// New return an Exporter that scan the configured hosts with c. The options are passed to Client.Analyze,
+// which by default wait for the scan to be finished, polling every 10 seconds.
+func New(c *observatory.Client, cfg Config, opts ...option.Option) *Exporter {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultConcurrency
+	}
+
+	hosts := make(map[string]*hostState, len(cfg.Hosts))
+	for _, host := range cfg.Hosts {
+		hosts[host] = new(hostState)
+	}
+	return &Exporter{
+		client: c,
+		cfg:    cfg,
+		opts:   append([]option.Option{publicoption.WaitFinished(true, 10*time.Second)}, opts...),
+		hosts:  hosts,
+		now:    time.Now,
+	}
+}
+
+// Run collect the metrics immediately, then at every configured interval, until the context is canceled.
+func (e *Exporter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		e.Collect(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect scan every host and retrieve the grade distribution once. Failures are counted in the
+// error metrics, and the previous result of a host is kept until a scan succeed.
+func (e *Exporter) Collect(ctx context.Context) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, e.cfg.Concurrency)
+	for host := range e.hosts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(host string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			e.scan(ctx, host)
+		}(host)
+	}
+
+	distribution, err := e.client.GetGradeDistribution(ctx)
+	e.mu.Lock()
+	if err != nil {
+		e.distributionErrors++
+	} else {
+		e.distribution = distribution
+	}
+	e.mu.Unlock()
+
+	wg.Wait()
+}
+
+func (e *Exporter) scan(ctx context.Context, host string) {
+	opts := e.opts
+	if hostOpts := e.cfg.HostOptions[host]; len(hostOpts) > 0 {
+		opts = append(append(make([]option.Option, 0, len(opts)+len(hostOpts)), opts...), hostOpts...)
+	}
+	result, err := e.client.Analyze(ctx, host, opts...)
+
+	var tests *types.ScannerTestResult
+	if err == nil {
+		e.mu.RLock()
+		previous := e.hosts[host]
+		if previous.result != nil && previous.result.ScanID == result.ScanID {
+			tests = previous.tests
+		}
+		e.mu.RUnlock()
+		if tests == nil {
+			tests, err = e.client.GetTestResults(ctx, result.ScanID)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	state := e.hosts[host]
+	if err != nil {
+		state.errors++
+		return
+	}
+	state.result = result
+	state.tests = tests
+}
+
+// ServeHTTP write the metrics in the Prometheus text exposition format.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	_ = e.write(newMetricWriter(w))
+}
+
+func (e *Exporter) write(m *metricWriter) error {
+	hosts := make([]string, 0, len(e.hosts))
+	for host := range e.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	scanned := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if e.hosts[host].result != nil {
+			scanned = append(scanned, host)
+		}
+	}
+
+	m.family("observatory_score", typeGauge, "Final score of the last scan.")
+	for _, host := range scanned {
+		m.sample("observatory_score", float64(e.hosts[host].result.Score), "host", host)
+	}
+
+	m.family("observatory_grade", typeGauge, "Rank of the final grade of the last scan, from 13 for A+ down to 1 for F.")
+	for _, host := range scanned {
+		m.sample("observatory_grade", float64(grader.Rank(e.hosts[host].result.Grade)), "host", host)
+	}
+
+	m.family("observatory_grade_info", typeGauge, "Final grade and likelihood indicator of the last scan.")
+	for _, host := range scanned {
+		result := e.hosts[host].result
+		m.sample("observatory_grade_info", 1, "host", host, "grade", result.Grade, "likelihood_indicator", result.LikelihoodIndicator)
+	}
+
+	m.family("observatory_test_pass", typeGauge, "Whether a test of the last scan passed.")
+	for _, host := range scanned {
+		if tests := e.hosts[host].tests; tests != nil {
+			for _, test := range tests.Summaries() {
+				if test.Result != "" {
+					m.sample("observatory_test_pass", boolToFloat(test.Pass), "host", host, "test", test.Name)
+				}
+			}
+		}
+	}
+
+	if e.cfg.Baseline != nil {
+		reports := make(map[string]*baseline.Report, len(scanned))
+		for _, host := range scanned {
+			if tests := e.hosts[host].tests; tests != nil {
+				reports[host] = e.cfg.Baseline.Evaluate(host, tests, e.now())
+			}
+		}
+
+		m.family("observatory_test_waived", typeGauge, "Whether the failure of a test of the last scan is accepted by a waiver that did not expire.")
+		for _, host := range scanned {
+			if report, ok := reports[host]; ok {
+				for _, o := range report.Tests {
+					if o.Status != baseline.StatusPass {
+						m.sample("observatory_test_waived", boolToFloat(o.Status == baseline.StatusWaived), "host", host, "test", o.Name)
+					}
+				}
+			}
+		}
+
+		m.family("observatory_waivers_unused", typeGauge, "Number of waivers of a host that match none of the failures of the last scan.")
+		for _, host := range scanned {
+			if report, ok := reports[host]; ok {
+				m.sample("observatory_waivers_unused", float64(len(report.Unused)), "host", host)
+			}
+		}
+	}
+
+	m.family("observatory_tests_passed", typeGauge, "Number of tests that passed in the last scan.")
+	for _, host := range scanned {
+		m.sample("observatory_tests_passed", float64(e.hosts[host].result.TestsPassed), "host", host)
+	}
+
+	m.family("observatory_tests_failed", typeGauge, "Number of tests that failed in the last scan.")
+	for _, host := range scanned {
+		m.sample("observatory_tests_failed", float64(e.hosts[host].result.TestsFailed), "host", host)
+	}
+
+	now := e.now()
+	m.family("observatory_scan_age_seconds", typeGauge, "Time elapsed since the last scan completed.")
+	for _, host := range scanned {
+		if end, err := http.ParseTime(e.hosts[host].result.EndTime); err == nil {
+			m.sample("observatory_scan_age_seconds", now.Sub(end).Seconds(), "host", host)
+		}
+	}
+
+	m.family("observatory_scan_duration_seconds", typeGauge, "Time taken by HTTP Observatory to complete the last scan.")
+	for _, host := range scanned {
+		result := e.hosts[host].result
+		start, startErr := http.ParseTime(result.StartTime)
+		end, endErr := http.ParseTime(result.EndTime)
+		if startErr == nil && endErr == nil {
+			m.sample("observatory_scan_duration_seconds", end.Sub(start).Seconds(), "host", host)
+		}
+	}
+
+	m.family("observatory_scan_errors_total", typeCounter, "Number of failed scans.")
+	for _, host := range hosts {
+		m.sample("observatory_scan_errors_total", float64(e.hosts[host].errors), "host", host)
+	}
+
+	if e.distribution != nil {
+		m.family("observatory_grade_distribution", typeGauge, "Number of scanned sites per grade, across every public scan.")
+		for _, g := range gradeDistribution(e.distribution) {
+			m.sample("observatory_grade_distribution", float64(g.count), "grade", g.grade)
+		}
+	}
+
+	m.family("observatory_grade_distribution_errors_total", typeCounter, "Number of failed grade distribution retrievals.")
+	m.sample("observatory_grade_distribution_errors_total", float64(e.distributionErrors))
+
+	return m.flush()
+}
+
+type gradeCount struct {
+	grade string
+	count int
+}
+
+func gradeDistribution(d *types.ScannerGradeDistribution) []gradeCount {
+	return []gradeCount{
+		{"A+", d.A}, {"A", d.A1}, {"A-", d.A2},
+		{"B+", d.B}, {"B", d.B1}, {"B-", d.B2},
+		{"C+", d.C}, {"C", d.C1}, {"C-", d.C2},
+		{"D+", d.D}, {"D", d.D1}, {"D-", d.D2},
+		{"F", d.F},
+	}
+}
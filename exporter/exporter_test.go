@@ -0,0 +1,109 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/baseline"
+	"github.com/tigerwill90/observatory/internal/option"
+	publicoption "github.com/tigerwill90/observatory/option"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExporter(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	rescans := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{}
+		switch r.URL.Path {
+		case fmt.Sprintf("/%s", observatory.ApiCallAnalyze):
+			if r.Method == http.MethodPost {
+				mu.Lock()
+				rescans[r.URL.Query().Get("host")] = r.PostFormValue("rescan")
+				mu.Unlock()
+			}
+			if r.URL.Query().Get("host") == "down.example.com" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			resp = &types.ScannerResult{
+				StartTime:           start.Format(http.TimeFormat),
+				EndTime:             start.Add(5 * time.Second).Format(http.TimeFormat),
+				Grade:               "B+",
+				LikelihoodIndicator: "MEDIUM",
+				ScanID:              42,
+				Score:               80,
+				State:               observatory.Finished,
+				TestsFailed:         1,
+				TestsPassed:         10,
+			}
+		case fmt.Sprintf("/%s", observatory.ApiCallGetScanResults):
+			tests := new(types.ScannerTestResult)
+			tests.XFrameOptions.Result = "x-frame-options-not-implemented"
+			tests.XContentTypeOptions.Result = "x-content-type-options-nosniff"
+			tests.XContentTypeOptions.Pass = true
+			resp = tests
+		case fmt.Sprintf("/%s", observatory.ApiCallGetGradeDistribution):
+			resp = &types.ScannerGradeDistribution{A: 3, F: 46770}
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer srv.Close()
+
+	b := &baseline.Baseline{Waivers: []*baseline.Waiver{
+		{Host: "*.mozilla.org", Test: types.TestXFrameOptions, Result: "x-frame-options-not-implemented", Expires: "2021-06-30", Justification: "legacy iframe integration"},
+		{Host: "*.mozilla.org", Test: types.TestCookies, Result: "cookies-without-secure-flag", Expires: "2021-06-30", Justification: "legacy session cookie"},
+	}}
+	assert.Nil(t, b.Validate())
+	e := New(observatory.NewCustomClient(srv.Client(), srv.URL), Config{
+		Hosts:    []string{"observatory.mozilla.org", "down.example.com"},
+		Baseline: b,
+		HostOptions: map[string][]option.Option{
+			"observatory.mozilla.org": {publicoption.ForceRescan(true)},
+		},
+	})
+	e.now = func() time.Time { return start.Add(time.Hour) }
+	e.Collect(context.Background())
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"# TYPE observatory_score gauge\n",
+		`observatory_score{host="observatory.mozilla.org"} 80`,
+		`observatory_grade{host="observatory.mozilla.org"} 10`,
+		`observatory_grade_info{host="observatory.mozilla.org",grade="B+",likelihood_indicator="MEDIUM"} 1`,
+		`observatory_test_pass{host="observatory.mozilla.org",test="x-content-type-options"} 1`,
+		`observatory_test_pass{host="observatory.mozilla.org",test="x-frame-options"} 0`,
+		`observatory_test_waived{host="observatory.mozilla.org",test="x-frame-options"} 1`,
+		`observatory_waivers_unused{host="observatory.mozilla.org"} 1`,
+		`observatory_tests_passed{host="observatory.mozilla.org"} 10`,
+		`observatory_tests_failed{host="observatory.mozilla.org"} 1`,
+		`observatory_scan_age_seconds{host="observatory.mozilla.org"} 3595`,
+		`observatory_scan_duration_seconds{host="observatory.mozilla.org"} 5`,
+		`observatory_scan_errors_total{host="down.example.com"} 1`,
+		`observatory_scan_errors_total{host="observatory.mozilla.org"} 0`,
+		`observatory_grade_distribution{grade="A+"} 3`,
+		`observatory_grade_distribution{grade="F"} 46770`,
+		"observatory_grade_distribution_errors_total 0",
+	} {
+		assert.Contains(t, body, want)
+	}
+	assert.NotContains(t, body, `observatory_score{host="down.example.com"}`)
+	assert.Equal(t, "true", rescans["observatory.mozilla.org"])
+}
+
+func TestEscapeLabel(t *testing.T) {
+	assert.Equal(t, `a\"b\\c\nd`, escapeLabel("a\"b\\c\nd"))
+}
@@ -0,0 +1,81 @@
+package exporter
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	typeGauge   = "gauge"
+	typeCounter = "counter"
+)
+
+// metricWriter write metrics in the Prometheus text exposition format.
+// https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format
+type metricWriter struct {
+	w *bufio.Writer
+}
+
+func newMetricWriter(w io.Writer) *metricWriter {
+	return &metricWriter{w: bufio.NewWriter(w)}
+}
+
+// family write the HELP and TYPE lines of a metric family.
+func (m *metricWriter) family(name, typ, help string) {
+	m.w.WriteString("# HELP ")
+	m.w.WriteString(name)
+	m.w.WriteByte(' ')
+	m.w.WriteString(escapeHelp(help))
+	m.w.WriteString("\n# TYPE ")
+	m.w.WriteString(name)
+	m.w.WriteByte(' ')
+	m.w.WriteString(typ)
+	m.w.WriteByte('\n')
+}
+
+// sample write a single sample. Labels are given as name and value pairs.
+func (m *metricWriter) sample(name string, value float64, labels ...string) {
+	m.w.WriteString(name)
+	if len(labels) > 0 {
+		m.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.w.WriteByte(',')
+			}
+			m.w.WriteString(labels[i])
+			m.w.WriteString(`="`)
+			m.w.WriteString(escapeLabel(labels[i+1]))
+			m.w.WriteByte('"')
+		}
+		m.w.WriteByte('}')
+	}
+	m.w.WriteByte(' ')
+	m.w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	m.w.WriteByte('\n')
+}
+
+func (m *metricWriter) flush() error {
+	return m.w.Flush()
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,272 @@
+package observatory
+
+import (
+	"context"
+	"fmt"
+	"github.com/tigerwill90/observatory/internal/option"
+	"github.com/tigerwill90/observatory/logging"
+	"github.com/tigerwill90/observatory/middleware"
+	"github.com/tigerwill90/observatory/telemetry"
+	"github.com/tigerwill90/observatory/types"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNoEndpointAvailable is returned when the circuit breaker of every endpoint is open. It wraps ErrCircuitOpen.
+var ErrNoEndpointAvailable = fmt.Errorf("no endpoint available: %w", ErrCircuitOpen)
+
+const (
+	// maxStickyHosts bound the number of hosts whose endpoint is remembered.
+	maxStickyHosts = 4096
+	// maxStickyScans bound the number of scans whose endpoint is remembered.
+	maxStickyScans = 4096
+)
+
+// endpoint is an instance of the api.
+type endpoint struct {
+	rawURL  string
+	base    *url.URL
+	baseErr error
+	// whether the credentials of the client are sent, only to the host of the primary endpoint
+	credentials bool
+	// nil with a single endpoint
+	breaker *breaker
+}
+
+func newEndpoint(rawURL string) *endpoint {
+	e := &endpoint{rawURL: rawURL}
+	e.base, e.baseErr = parseBaseURL(rawURL)
+	return e
+}
+
+// name return the url of the endpoint, without password.
+func (e *endpoint) name() string {
+	if e.base == nil {
+		return e.rawURL
+	}
+	return e.base.Redacted()
+}
+
+// url return the url of an api call: the api call joined to the path of the base url, with the query
+// parameters of the base url and of the call, the latter taking precedence. The heartbeat is served next to the
+// api, so the /api/v1 or /api/v2 suffix of the base path is removed for it.
+func (e *endpoint) url(apiCall string, query url.Values) (string, error) {
+	if e.baseErr != nil {
+		return "", e.baseErr
+	}
+
+	u := *e.base
+	basePath := strings.TrimSuffix(u.Path, "/")
+	if apiCall == ApiCallHeartbeat {
+		basePath = strings.TrimSuffix(strings.TrimSuffix(basePath, "/api/v1"), "/api/v2")
+	}
+	u.Path = basePath + "/" + apiCall
+	u.RawPath = ""
+
+	params := u.Query()
+	for key, values := range query {
+		params[key] = values
+	}
+	u.RawQuery = params.Encode()
+	return u.String(), nil
+}
+
+// newEndpoints return the primary endpoint followed by the fallback ones, each with a breaker if there are
+// several or if the circuit breaker is enabled. The credentials of the client are only sent to the endpoints on
+// the host of the primary one.
+func newEndpoints(primary string, fallbacks []string, cb *option.CircuitBreaker) []*endpoint {
+	endpoints := make([]*endpoint, 0, len(fallbacks)+1)
+	for _, rawURL := range append([]string{primary}, fallbacks...) {
+		endpoints = append(endpoints, newEndpoint(rawURL))
+	}
+	for _, e := range endpoints {
+		e.credentials = e.base != nil && endpoints[0].base != nil && e.base.Host == endpoints[0].base.Host
+		switch {
+		case cb != nil:
+			e.breaker = newBreaker(cb.Threshold, cb.Cooldown)
+		case len(endpoints) > 1:
+			e.breaker = newBreaker(defaultBreakerThreshold, defaultBreakerCooldown)
+		}
+	}
+	return endpoints
+}
+
+// sticky remember which endpoint own the scans of each host and each scan, since scan IDs are only known to
+// the instance that made the scan.
+type sticky struct {
+	mu    sync.Mutex
+	hosts map[string]*endpoint
+	scans map[types.ScanID]*endpoint
+	// hosts and scan IDs in insertion order, to evict the oldest ones
+	hostOrder []string
+	order     []types.ScanID
+}
+
+func newSticky() *sticky {
+	return &sticky{
+		hosts: make(map[string]*endpoint),
+		scans: make(map[types.ScanID]*endpoint),
+	}
+}
+
+func (s *sticky) host(host string) *endpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hosts[host]
+}
+
+func (s *sticky) scan(scanID types.ScanID) *endpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scans[scanID]
+}
+
+func (s *sticky) set(host string, e *endpoint, scanIDs ...types.ScanID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if host != "" {
+		if _, ok := s.hosts[host]; !ok {
+			s.hostOrder = append(s.hostOrder, host)
+		}
+		s.hosts[host] = e
+	}
+	for len(s.hostOrder) > maxStickyHosts {
+		delete(s.hosts, s.hostOrder[0])
+		s.hostOrder = s.hostOrder[1:]
+	}
+	for _, id := range scanIDs {
+		if id == 0 {
+			continue
+		}
+		if _, ok := s.scans[id]; !ok {
+			s.order = append(s.order, id)
+		}
+		s.scans[id] = e
+	}
+	for len(s.order) > maxStickyScans {
+		delete(s.scans, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// route send the call to the endpoint that own its scan, if any, or to the first endpoint whose breaker is
+// closed, failing over to the next ones on 5xx responses, timeouts and connection errors. A call about a known
+// scan never fail over, since no other endpoint know the scan.
+func (c *Client) route(ctx context.Context, call *middleware.Call) (*middleware.Response, error) {
+	if len(c.endpoints) == 1 && c.endpoints[0].breaker == nil {
+		resp, _, _, err := c.attempt(ctx, c.endpoints[0], call)
+		return resp, err
+	}
+
+	host := call.Query.Get("host")
+	var owner *endpoint
+	switch {
+	case call.ApiCall == ApiCallGetScanResults:
+		if id, err := strconv.Atoi(call.Query.Get("scan")); err == nil {
+			owner = c.sticky.scan(types.ScanID(id))
+		}
+	case call.Method == "GET" && (call.ApiCall == ApiCallAnalyze || call.ApiCall == ApiCallGetHostHistory):
+		owner = c.sticky.host(host)
+	}
+
+	candidates := c.endpoints
+	if owner != nil {
+		candidates = []*endpoint{owner}
+	}
+
+	var lastErr error
+	for _, e := range candidates {
+		resp, o, sent, err := c.attempt(ctx, e, call)
+		if !sent {
+			continue
+		}
+		if o != outcomeFailure {
+			if err == nil && len(c.endpoints) > 1 {
+				c.sticky.set(stickyHost(call, host), e, scanIDs(call.Result)...)
+			}
+			return resp, err
+		}
+		lastErr = err
+		if len(candidates) > 1 && c.logEnabled(logging.LevelWarn) {
+			c.log(ctx, logging.LevelWarn, "endpoint failed", logging.String("endpoint", e.name()), logging.Error(err))
+		}
+	}
+	switch {
+	case lastErr != nil:
+		return nil, lastErr
+	case len(c.endpoints) == 1:
+		return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, c.endpoints[0].name())
+	case owner != nil:
+		return nil, fmt.Errorf("%w: the endpoint of the scan %s is unavailable", ErrNoEndpointAvailable, owner.name())
+	default:
+		return nil, ErrNoEndpointAvailable
+	}
+}
+
+// attempt send the call to the endpoint, unless its breaker is open, in a child span of the call recording the
+// endpoint, the status code and the outcome. It returns false if the endpoint was skipped by its breaker.
+func (c *Client) attempt(ctx context.Context, e *endpoint, call *middleware.Call) (*middleware.Response, outcome, bool, error) {
+	ctx, span := c.startSpan(ctx, "observatory.attempt", call.ApiCall, "", 0)
+	if span != nil {
+		span.SetAttributes(telemetry.String(telemetry.KeyEndpoint, e.name()))
+	}
+	if !e.breaker.allow(ctx) {
+		if span != nil {
+			span.SetAttributes(telemetry.String(telemetry.KeyOutcome, "skipped"))
+			span.End()
+		}
+		return nil, outcomeIgnored, false, nil
+	}
+
+	resp, o, err := c.send(ctx, e, call)
+	e.breaker.done(ctx, o)
+	if span != nil {
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		span.SetAttributes(
+			telemetry.Int(telemetry.KeyStatusCode, statusCode),
+			telemetry.String(telemetry.KeyOutcome, o.String()),
+		)
+		endSpan(span, nil, err)
+	}
+	return resp, o, true, err
+}
+
+// stickyHost return the host whose scans are owned by the endpoint that answered the call, or an empty string.
+func stickyHost(call *middleware.Call, host string) string {
+	switch call.ApiCall {
+	case ApiCallAnalyze, ApiCallScan, ApiCallGetHostHistory:
+		return host
+	default:
+		return ""
+	}
+}
+
+// scanIDs return the scan IDs of a decoded result.
+func scanIDs(result interface{}) []types.ScanID {
+	switch r := result.(type) {
+	case *types.ScannerResult:
+		return []types.ScanID{r.ScanID}
+	case *[]*types.ScannerHostHistory:
+		ids := make([]types.ScanID, 0, len(*r))
+		for _, h := range *r {
+			ids = append(ids, h.ScanId)
+		}
+		return ids
+	case *v2Scan:
+		return []types.ScanID{r.ID}
+	case *v2Analysis:
+		ids := make([]types.ScanID, 0, len(r.History)+1)
+		ids = append(ids, r.Scan.ID)
+		for _, h := range r.History {
+			ids = append(ids, h.ID)
+		}
+		return ids
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,353 @@
+package observatory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory/option"
+	"github.com/tigerwill90/observatory/telemetry"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeInstance is an api instance that can be taken down, and whose scans have IDs starting at a given offset.
+type fakeInstance struct {
+	*httptest.Server
+	mu   sync.Mutex
+	down bool
+	// whether the requests hang until canceled
+	hang   bool
+	calls  []string
+	auth   []string
+	scanID types.ScanID
+}
+
+func newFakeInstance(t *testing.T, scanID types.ScanID) *fakeInstance {
+	f := &fakeInstance{scanID: scanID}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.calls = append(f.calls, r.Method+" "+r.URL.Path)
+		f.auth = append(f.auth, r.Header.Get("Authorization"))
+		down, hang := f.down, f.hang
+		f.mu.Unlock()
+		if hang {
+			<-r.Context().Done()
+			return
+		}
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var resp interface{}
+		switch r.URL.Path {
+		case fmt.Sprintf("/%s", ApiCallAnalyze):
+			resp = &types.ScannerResult{ScanID: f.scanID, State: Finished, Grade: "A"}
+		case fmt.Sprintf("/%s", ApiCallGetScanResults):
+			if r.URL.Query().Get("scan") != fmt.Sprintf("%d", f.scanID) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			tests := new(types.ScannerTestResult)
+			tests.Cookies.Result = "cookies-not-found"
+			resp = tests
+		case fmt.Sprintf("/%s", ApiCallGetGradeDistribution):
+			resp = &types.ScannerGradeDistribution{A: int(f.scanID)}
+		case fmt.Sprintf("/%s", ApiCallGetHostHistory):
+			resp = []*types.ScannerHostHistory{{ScanId: f.scanID - 1}, {ScanId: f.scanID}}
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	return f
+}
+
+func (f *fakeInstance) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+func (f *fakeInstance) setHang(hang bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hang = hang
+}
+
+// received return the number of calls received since the last reset.
+func (f *fakeInstance) received() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.calls)
+}
+
+// reset return the calls received since the last reset.
+func (f *fakeInstance) reset() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := f.calls
+	f.calls = nil
+	return calls
+}
+
+func TestClientFailover(t *testing.T) {
+	primary := newFakeInstance(t, 100)
+	defer primary.Close()
+	fallback := newFakeInstance(t, 200)
+	defer fallback.Close()
+
+	c := NewCustomClient(primary.Client(), primary.URL, option.WithFallbackEndpoints(fallback.URL), option.WithBearerToken("t0k3n"))
+	ctx := context.Background()
+
+	distribution, err := c.GetGradeDistribution(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, 100, distribution.A)
+	assert.Len(t, primary.reset(), 1)
+	assert.Empty(t, fallback.reset())
+
+	// The scan is made by the fallback while the primary is down...
+	primary.setDown(true)
+	result, err := c.Analyze(ctx, "observatory.mozilla.org", option.ForceRescan(true))
+	require.Nil(t, err)
+	assert.Equal(t, types.ScanID(200), result.ScanID)
+	assert.Equal(t, []string{"POST /analyze"}, primary.reset())
+	assert.Equal(t, []string{"POST /analyze"}, fallback.reset())
+
+	// ...so its assessment and test results are retrieved from the fallback, even once the primary is back.
+	primary.setDown(false)
+	_, err = c.GetAssessment(ctx, "observatory.mozilla.org")
+	require.Nil(t, err)
+	tests, err := c.GetTestResults(ctx, result.ScanID)
+	require.Nil(t, err)
+	assert.Equal(t, "cookies-not-found", tests.Cookies.Result)
+	histories, err := c.GetScanHistory(ctx, "observatory.mozilla.org")
+	require.Nil(t, err)
+	require.Len(t, histories, 2)
+	_, err = c.GetTestResults(ctx, histories[0].ScanId)
+	assert.NotNil(t, err) // the fake only know its latest scan, but the request reached the fallback
+	assert.Empty(t, primary.reset())
+	assert.Equal(t, []string{"GET /analyze", "GET /getScanResults", "GET /getHostHistory", "GET /getScanResults"}, fallback.reset())
+
+	// A call about a scan never fail over.
+	fallback.setDown(true)
+	_, err = c.GetAssessment(ctx, "observatory.mozilla.org")
+	assert.NotNil(t, err)
+	assert.Empty(t, primary.reset())
+
+	// The credentials are only sent to the primary host.
+	primary.mu.Lock()
+	assert.Equal(t, "Bearer t0k3n", primary.auth[0])
+	primary.mu.Unlock()
+	fallback.mu.Lock()
+	for _, auth := range fallback.auth {
+		assert.Empty(t, auth)
+	}
+	fallback.mu.Unlock()
+}
+
+func TestClientFailoverBreaker(t *testing.T) {
+	primary := newFakeInstance(t, 100)
+	defer primary.Close()
+	fallback := newFakeInstance(t, 200)
+	defer fallback.Close()
+
+	c := NewCustomClient(primary.Client(), primary.URL, option.WithFallbackEndpoints(fallback.URL))
+	now := time.Now()
+	c.endpoints[0].breaker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	primary.setDown(true)
+	for i := 0; i < defaultBreakerThreshold+2; i++ {
+		distribution, err := c.GetGradeDistribution(ctx)
+		require.Nil(t, err)
+		assert.Equal(t, 200, distribution.A)
+	}
+	// The primary is skipped once its breaker is open.
+	assert.Len(t, primary.reset(), defaultBreakerThreshold)
+
+	// After the cooldown, a probe is sent to the primary, which close the breaker once back.
+	primary.setDown(false)
+	now = now.Add(defaultBreakerCooldown)
+	distribution, err := c.GetGradeDistribution(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, 100, distribution.A)
+	assert.Len(t, primary.reset(), 1)
+
+	// Every endpoint is down.
+	primary.setDown(true)
+	fallback.setDown(true)
+	_, err = c.GetGradeDistribution(ctx)
+	assert.NotNil(t, err)
+	for i := 0; i < defaultBreakerThreshold; i++ {
+		_, _ = c.GetGradeDistribution(ctx)
+	}
+	_, err = c.GetGradeDistribution(ctx)
+	assert.ErrorIs(t, err, ErrNoEndpointAvailable)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+}
+
+func TestClientFailoverTelemetry(t *testing.T) {
+	primary := newFakeInstance(t, 100)
+	defer primary.Close()
+	fallback := newFakeInstance(t, 200)
+	defer fallback.Close()
+
+	tracer := new(recordingTracer)
+	c := NewCustomClient(primary.Client(), primary.URL, option.WithFallbackEndpoints(fallback.URL), option.WithTracer(tracer))
+	now := time.Now()
+	c.endpoints[0].breaker.now = func() time.Time { return now }
+
+	// Each endpoint tried is recorded in its own span, child of the request.
+	primary.setDown(true)
+	_, err := c.GetGradeDistribution(context.Background())
+	require.Nil(t, err)
+	require.Len(t, tracer.spans, 4)
+	assert.Equal(t, "observatory.request", tracer.spans[1].name)
+	for i, want := range []struct {
+		endpoint   string
+		statusCode int
+		outcome    string
+	}{
+		{endpoint: primary.URL, statusCode: http.StatusServiceUnavailable, outcome: "failure"},
+		{endpoint: fallback.URL, statusCode: http.StatusOK, outcome: "success"},
+	} {
+		span := tracer.spans[i+2]
+		assert.Equal(t, "observatory.attempt", span.name)
+		assert.Equal(t, "observatory.request", span.parent)
+		assert.True(t, span.ended)
+		assert.Equal(t, want.endpoint, span.attrs[telemetry.KeyEndpoint])
+		assert.Equal(t, want.statusCode, span.attrs[telemetry.KeyStatusCode])
+		assert.Equal(t, want.outcome, span.attrs[telemetry.KeyOutcome])
+	}
+	assert.NotNil(t, tracer.spans[2].err)
+
+	// An endpoint skipped by its open breaker is recorded as well.
+	for i := 1; i < defaultBreakerThreshold; i++ {
+		_, err = c.GetGradeDistribution(context.Background())
+		require.Nil(t, err)
+	}
+	tracer.spans = nil
+	_, err = c.GetGradeDistribution(context.Background())
+	require.Nil(t, err)
+	require.Len(t, tracer.spans, 4)
+	assert.Equal(t, primary.URL, tracer.spans[2].attrs[telemetry.KeyEndpoint])
+	assert.Equal(t, "skipped", tracer.spans[2].attrs[telemetry.KeyOutcome])
+	assert.Equal(t, "success", tracer.spans[3].attrs[telemetry.KeyOutcome])
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	srv := newFakeInstance(t, 100)
+	defer srv.Close()
+
+	var changes []string
+	c := NewCustomClient(srv.Client(), srv.URL,
+		option.WithCircuitBreaker(2, time.Minute),
+		option.WithCircuitStateHook(func(endpoint, from, to string) {
+			assert.Equal(t, srv.URL, endpoint)
+			changes = append(changes, from+" -> "+to)
+		}),
+	)
+	now := time.Now()
+	c.endpoints[0].breaker.now = func() time.Time { return now }
+
+	srv.setDown(true)
+	for i := 0; i < 2; i++ {
+		_, err := c.GetGradeDistribution(context.Background())
+		require.NotNil(t, err)
+		assert.NotErrorIs(t, err, ErrCircuitOpen)
+	}
+	_, err := c.GetGradeDistribution(context.Background())
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Len(t, srv.reset(), 2)
+	assert.Equal(t, []string{"closed -> open"}, changes)
+
+	// A call canceled by the caller while the probe is in flight is not a failure of the endpoint.
+	srv.setDown(false)
+	srv.setHang(true)
+	now = now.Add(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.GetGradeDistribution(ctx)
+		errc <- err
+	}()
+	require.Eventually(t, func() bool { return srv.received() == 1 }, time.Second, time.Millisecond)
+	cancel()
+	err = <-errc
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, ErrCircuitOpen)
+	b := c.endpoints[0].breaker
+	require.Eventually(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return !b.probing
+	}, time.Second, time.Millisecond)
+	b.mu.Lock()
+	assert.Equal(t, breakerHalfOpen, b.state)
+	assert.Equal(t, 2, b.failures)
+	b.mu.Unlock()
+
+	srv.setHang(false)
+	distribution, err := c.GetGradeDistribution(context.Background())
+	require.Nil(t, err)
+	assert.Equal(t, 100, distribution.A)
+	assert.Equal(t, []string{"closed -> open", "open -> half-open", "half-open -> closed"}, changes)
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(2, time.Minute)
+	ctx := context.Background()
+	b.now = func() time.Time { return now }
+
+	require.True(t, b.allow(ctx))
+	b.done(ctx, outcomeFailure)
+	require.True(t, b.allow(ctx))
+	b.done(ctx, outcomeIgnored)
+	require.True(t, b.allow(ctx))
+	b.done(ctx, outcomeFailure)
+	assert.Equal(t, breakerOpen, b.state)
+	assert.False(t, b.allow(ctx))
+
+	// A single probe is allowed once the cooldown elapsed.
+	now = now.Add(time.Minute)
+	require.True(t, b.allow(ctx))
+	assert.False(t, b.allow(ctx))
+	b.done(ctx, outcomeFailure)
+	assert.Equal(t, breakerOpen, b.state)
+	assert.False(t, b.allow(ctx))
+
+	now = now.Add(time.Minute)
+	require.True(t, b.allow(ctx))
+	b.done(ctx, outcomeIgnored)
+	assert.Equal(t, breakerHalfOpen, b.state)
+	require.True(t, b.allow(ctx))
+	b.done(ctx, outcomeSuccess)
+	assert.Equal(t, breakerClosed, b.state)
+	assert.Equal(t, 0, b.failures)
+
+	var nilBreaker *breaker
+	assert.True(t, nilBreaker.allow(ctx))
+	nilBreaker.done(ctx, outcomeFailure)
+}
+
+func TestStickyBound(t *testing.T) {
+	s := newSticky()
+	e := new(endpoint)
+	for i := 0; i <= maxStickyHosts; i++ {
+		s.set(fmt.Sprintf("%d.example.com", i), e, types.ScanID(i+1))
+	}
+	assert.Len(t, s.hosts, maxStickyHosts)
+	assert.Len(t, s.scans, maxStickyScans)
+	assert.Nil(t, s.host("0.example.com"))
+	assert.Nil(t, s.scan(1))
+	assert.Equal(t, e, s.host("1.example.com"))
+}
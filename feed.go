@@ -0,0 +1,93 @@
+package observatory
+
+import (
+	"context"
+	"github.com/tigerwill90/observatory/internal/option"
+	"github.com/tigerwill90/observatory/types"
+	"time"
+)
+
+// maxFeedHosts bound the number of hosts remembered by a RecentScansFeed.
+const maxFeedHosts = 100000
+
+// RecentScansFeed stream the recent scans of HTTP Observatory, by polling GetRecentScans and skipping the hosts
+// already seen. The hosts are remembered until 100000 other hosts are seen. A RecentScansFeed is not safe for
+// concurrent use.
+type RecentScansFeed struct {
+	c        *Client
+	interval time.Duration
+	opts     []option.ScanOption
+	// scans not returned yet, oldest first
+	pending types.ScannerRecentScans
+	seen    map[string]struct{}
+	// seen hosts in insertion order, to forget the oldest ones
+	order []string
+	// time of the next poll, zero before the first one
+	next time.Time
+}
+
+// RecentScansFeed return a feed of the recent scans matching the options, see GetRecentScans, polled at the
+// interval. The api return the ten most recent scans, so scans are missed when more than ten are made between two
+// polls.
+func (c *Client) RecentScansFeed(interval time.Duration, opts ...option.ScanOption) *RecentScansFeed {
+	return &RecentScansFeed{
+		c:        c,
+		interval: interval,
+		opts:     opts,
+		seen:     make(map[string]struct{}),
+	}
+}
+
+// Next return the next recent scan of a host not seen before, oldest first, and wait for the next poll when
+// every scan was returned. It returns the error of a failed poll, after which Next can be called again to wait
+// for the next poll, or the error of ctx.
+func (f *RecentScansFeed) Next(ctx context.Context) (types.RecentScan, error) {
+	for len(f.pending) == 0 {
+		if err := f.wait(ctx); err != nil {
+			return types.RecentScan{}, err
+		}
+		f.next = time.Now().Add(f.interval)
+		scans, err := f.c.GetRecentScans(ctx, f.opts...)
+		if err != nil {
+			return types.RecentScan{}, err
+		}
+		for i := len(scans) - 1; i >= 0; i-- {
+			if f.see(scans[i].Host) {
+				f.pending = append(f.pending, scans[i])
+			}
+		}
+	}
+
+	scan := f.pending[0]
+	f.pending = f.pending[1:]
+	return scan, nil
+}
+
+// wait until the next poll.
+func (f *RecentScansFeed) wait(ctx context.Context) error {
+	if f.next.IsZero() {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(time.Until(f.next))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// see remember the host, and report whether it was not seen before.
+func (f *RecentScansFeed) see(host string) bool {
+	if _, ok := f.seen[host]; ok {
+		return false
+	}
+	f.seen[host] = struct{}{}
+	f.order = append(f.order, host)
+	if len(f.order) > maxFeedHosts {
+		delete(f.seen, f.order[0])
+		f.order = f.order[1:]
+	}
+	return true
+}
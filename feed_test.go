@@ -0,0 +1,78 @@
+package observatory
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory/option"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRecentScansFeed(t *testing.T) {
+	// Each poll return the most recent scans first.
+	polls := []string{
+		`{"c.example.com": "A", "b.example.com": "B", "a.example.com": "F"}`,
+		`{"d.example.com": "A+", "c.example.com": "A", "b.example.com": "B"}`,
+		"",
+		`{"e.example.com": "C", "d.example.com": "A+"}`,
+	}
+	var calls uint32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "50", r.URL.Query().Get("min"))
+		i := int(atomic.AddUint32(&calls, 1)) - 1
+		if i >= len(polls) {
+			fmt.Fprint(w, `{}`)
+			return
+		}
+		if polls[i] == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, polls[i])
+	}))
+	defer srv.Close()
+
+	c := NewCustomClient(srv.Client(), srv.URL)
+	feed := c.RecentScansFeed(time.Millisecond, option.WithMinScore(50))
+	ctx := context.Background()
+
+	want := []types.RecentScan{
+		{Host: "a.example.com", Grade: "F"},
+		{Host: "b.example.com", Grade: "B"},
+		{Host: "c.example.com", Grade: "A"},
+		{Host: "d.example.com", Grade: "A+"},
+	}
+	for _, w := range want {
+		scan, err := feed.Next(ctx)
+		require.Nil(t, err)
+		assert.Equal(t, w, scan)
+	}
+
+	// A failed poll is reported, and the feed resume with the next poll.
+	_, err := feed.Next(ctx)
+	assert.NotNil(t, err)
+	scan, err := feed.Next(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, types.RecentScan{Host: "e.example.com", Grade: "C"}, scan)
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = feed.Next(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRecentScansFeedForget(t *testing.T) {
+	feed := NewClient().RecentScansFeed(time.Minute)
+	for i := 0; i <= maxFeedHosts; i++ {
+		assert.True(t, feed.see(fmt.Sprintf("%d.example.com", i)))
+	}
+	assert.False(t, feed.see(fmt.Sprintf("%d.example.com", maxFeedHosts)))
+	assert.True(t, feed.see("0.example.com"))
+	assert.Len(t, feed.seen, maxFeedHosts)
+}
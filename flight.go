@@ -0,0 +1,116 @@
+package observatory
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// flightGroup coalesce identical in-flight calls into a single execution whose result is shared by the callers.
+// The execution does not depend on the context of any caller: a caller leaving, e.g. on cancellation, does not
+// affect the others, and the execution is only canceled once every caller left.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+type flight struct {
+	done   chan struct{}
+	val    interface{}
+	err    error
+	cancel context.CancelFunc
+	// number of callers still waiting for the result
+	waiters int
+	// number of callers that joined the flight, final once done is closed
+	callers int
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{flights: make(map[string]*flight)}
+}
+
+// do run fn, or join the execution of fn in progress for the same key, and wait for its result. The values of
+// the context of the first caller are visible to fn. It returns whether the result is shared with other
+// callers, in which case it must not be modified, or the error of ctx if the caller left before the result.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	g.mu.Lock()
+	f, ok := g.flights[key]
+	if !ok {
+		fctx, cancel := context.WithCancel(detachedContext{ctx})
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.flights[key] = f
+		go func() {
+			f.val, f.err = fn(fctx)
+			g.mu.Lock()
+			g.forget(key, f)
+			g.mu.Unlock()
+			cancel()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	f.callers++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.val, f.callers > 1, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancel()
+			// the next callers start a new flight rather than joining a canceled one
+			g.forget(key, f)
+		}
+		g.mu.Unlock()
+		return nil, false, ctx.Err()
+	}
+}
+
+// forget remove the flight of the key, if it is still f. The lock must be held.
+func (g *flightGroup) forget(key string, f *flight) {
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+}
+
+// detachedContext carry the values of its parent, but neither its deadline nor its cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
+
+// copyResult copy the result of a flight into dst, a pointer to a value of the same type. A shared result is
+// deep copied, so that callers can not see each other modifications.
+func copyResult(dst, src interface{}, shared bool) error {
+	if !shared {
+		reflect.ValueOf(dst).Elem().Set(reflect.ValueOf(src).Elem())
+		return nil
+	}
+	buf, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, dst)
+}
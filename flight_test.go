@@ -0,0 +1,181 @@
+package observatory
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory/option"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitCallers wait until n callers joined the flight of the key.
+func waitCallers(t *testing.T, g *flightGroup, key string, n int) {
+	require.Eventually(t, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		f := g.flights[key]
+		return f != nil && f.callers == n
+	}, time.Second, time.Millisecond)
+}
+
+func assessmentKey(host string) string {
+	return request{method: "GET", apiCall: ApiCallAnalyze, queryParams: url.Values{"host": {host}}}.key()
+}
+
+func newBlockingServer(t *testing.T, calls *uint32, release <-chan struct{}, state func() string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddUint32(calls, 1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		resp := &types.ScannerResult{ScanID: 42, State: state(), ResponseHeaders: map[string]string{"Server": "nginx"}}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Fatal(err)
+		}
+	}))
+}
+
+func finished() string {
+	return Finished
+}
+
+func TestClientDeduplication(t *testing.T) {
+	var calls uint32
+	release := make(chan struct{})
+	srv := newBlockingServer(t, &calls, release, finished)
+	defer srv.Close()
+	c := NewCustomClient(srv.Client(), srv.URL)
+
+	const callers = 5
+	results := make([]*types.ScannerResult, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := c.GetAssessment(context.Background(), "observatory.mozilla.org")
+			assert.Nil(t, err)
+			results[i] = result
+		}(i)
+	}
+	waitCallers(t, c.flights, assessmentKey("observatory.mozilla.org"), callers)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, uint32(1), atomic.LoadUint32(&calls))
+	for _, result := range results[1:] {
+		assert.Equal(t, results[0], result)
+	}
+	// Every caller get its own copy.
+	results[0].ResponseHeaders["Server"] = "apache"
+	assert.Equal(t, "nginx", results[1].ResponseHeaders["Server"])
+
+	// Calls in sequence are not coalesced.
+	_, err := c.GetAssessment(context.Background(), "observatory.mozilla.org")
+	require.Nil(t, err)
+	assert.Equal(t, uint32(2), atomic.LoadUint32(&calls))
+}
+
+func TestClientDeduplicationCancel(t *testing.T) {
+	var calls uint32
+	release := make(chan struct{})
+	srv := newBlockingServer(t, &calls, release, finished)
+	defer srv.Close()
+	c := NewCustomClient(srv.Client(), srv.URL)
+	key := assessmentKey("observatory.mozilla.org")
+
+	// The first caller leaving does not affect the second one.
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error)
+	go func() {
+		_, err := c.GetAssessment(ctx, "observatory.mozilla.org")
+		canceled <- err
+	}()
+	waitCallers(t, c.flights, key, 1)
+	done := make(chan error)
+	go func() {
+		_, err := c.GetAssessment(context.Background(), "observatory.mozilla.org")
+		done <- err
+	}()
+	waitCallers(t, c.flights, key, 2)
+	cancel()
+	assert.ErrorIs(t, <-canceled, context.Canceled)
+	close(release)
+	assert.Nil(t, <-done)
+	assert.Equal(t, uint32(1), atomic.LoadUint32(&calls))
+
+	// The request is canceled once every caller left, and the next caller start a new one.
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hung.Close()
+	c = NewCustomClient(hung.Client(), hung.URL)
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := c.GetAssessment(ctx, "observatory.mozilla.org")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Eventually(t, func() bool {
+		c.flights.mu.Lock()
+		defer c.flights.mu.Unlock()
+		return len(c.flights.flights) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestClientAnalyzeSharedPolling(t *testing.T) {
+	var calls uint32
+	release := make(chan struct{})
+	var state atomic.Value
+	state.Store(Running)
+	srv := newBlockingServer(t, &calls, release, func() string { return state.Load().(string) })
+	defer srv.Close()
+	c := NewCustomClient(srv.Client(), srv.URL)
+	close(release)
+
+	const callers = 3
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := c.Analyze(context.Background(), "observatory.mozilla.org", option.WaitFinished(true, time.Millisecond))
+			assert.Nil(t, err)
+			assert.Equal(t, Finished, result.State)
+		}()
+	}
+	waitCallers(t, c.flights, "poll observatory.mozilla.org", callers)
+	state.Store(Finished)
+	wg.Wait()
+}
+
+func TestClientWithoutDeduplication(t *testing.T) {
+	var calls uint32
+	release := make(chan struct{})
+	srv := newBlockingServer(t, &calls, release, finished)
+	defer srv.Close()
+	c := NewCustomClient(srv.Client(), srv.URL, option.WithDeduplication(false))
+	require.Nil(t, c.flights)
+
+	const callers = 3
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.GetAssessment(context.Background(), "observatory.mozilla.org")
+			assert.Nil(t, err)
+		}()
+	}
+	require.Eventually(t, func() bool { return atomic.LoadUint32(&calls) == callers }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+}
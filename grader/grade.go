@@ -0,0 +1,209 @@
+// Package grader reproduce the HTTP Observatory scoring algorithm, which allows to compute the score and grade
+// of a scan from the outcome of its tests, and to simulate how a change in the outcome would affect them.
+// https://github.com/mozilla/http-observatory/blob/master/httpobs/docs/scoring.md
+package grader
+
+import "github.com/tigerwill90/observatory/types"
+
+const (
+	// StartingScore is the score of a site before any test modifier is applied.
+	StartingScore = 100
+	// MinimumScoreForExtraCredit is the minimum score a site must reach with penalties only
+	// before bonuses are applied.
+	MinimumScoreForExtraCredit = 90
+)
+
+const (
+	LikelihoodLow    = "LOW"
+	LikelihoodMedium = "MEDIUM"
+	LikelihoodHigh   = "HIGH"
+)
+
+// scoreTable hold the score modifier of every known test result.
+var scoreTable = map[string]int{
+	// content-security-policy
+	"csp-implemented-with-no-unsafe-default-src-none":              10,
+	"csp-implemented-with-no-unsafe":                               5,
+	"csp-implemented-with-unsafe-inline-in-style-src-only":         0,
+	"csp-implemented-with-insecure-scheme-in-passive-content-only": -10,
+	"csp-implemented-with-unsafe-eval":                             -10,
+	"csp-implemented-with-unsafe-inline":                           -20,
+	"csp-implemented-with-insecure-scheme":                         -20,
+	"csp-header-invalid":                                           -25,
+	"csp-not-implemented":                                          -25,
+
+	// contribute
+	"contribute-json-with-required-keys":                  0,
+	"contribute-json-only-required-on-mozilla-properties": 0,
+	"contribute-json-missing-required-keys":               -5,
+	"contribute-json-not-implemented":                     -5,
+	"contribute-json-invalid-json":                        -10,
+
+	// cookies
+	"cookies-secure-with-httponly-sessions-and-samesite":        5,
+	"cookies-secure-with-httponly-sessions":                     0,
+	"cookies-not-found":                                         0,
+	"cookies-without-secure-flag-but-protected-by-hsts":         -5,
+	"cookies-session-without-secure-flag-but-protected-by-hsts": -10,
+	"cookies-samesite-flag-invalid":                             -20,
+	"cookies-anticsrf-without-samesite-flag":                    -20,
+	"cookies-without-secure-flag":                               -20,
+	"cookies-session-without-httponly-flag":                     -30,
+	"cookies-session-without-secure-flag":                       -40,
+
+	// cross-origin-resource-sharing
+	"cross-origin-resource-sharing-not-implemented":                    0,
+	"cross-origin-resource-sharing-implemented-with-public-access":     0,
+	"cross-origin-resource-sharing-implemented-with-restricted-access": 0,
+	"cross-origin-resource-sharing-implemented-with-universal-access":  -50,
+	"xml-not-parsable": -20,
+
+	// public-key-pinning
+	"hpkp-preloaded": 0,
+	"hpkp-implemented-max-age-at-least-fifteen-days":  0,
+	"hpkp-implemented-max-age-less-than-fifteen-days": 0,
+	"hpkp-not-implemented":                            0,
+	"hpkp-not-implemented-no-https":                   0,
+	"hpkp-invalid-cert":                               0,
+	"hpkp-header-invalid":                             -5,
+
+	// redirection
+	"redirection-all-redirects-preloaded":             0,
+	"redirection-to-https":                            0,
+	"redirection-not-needed-no-http":                  0,
+	"redirection-off-host-from-http":                  -5,
+	"redirection-not-to-https-on-initial-redirection": -10,
+	"redirection-not-to-https":                        -20,
+	"redirection-missing":                             -20,
+	"redirection-invalid-cert":                        -20,
+
+	// strict-transport-security
+	"hsts-preloaded": 5,
+	"hsts-implemented-max-age-at-least-six-months":  0,
+	"hsts-implemented-max-age-less-than-six-months": -10,
+	"hsts-not-implemented":                          -20,
+	"hsts-header-invalid":                           -20,
+	"hsts-not-implemented-no-https":                 -20,
+	"hsts-invalid-cert":                             -20,
+
+	// subresource-integrity
+	"sri-implemented-and-all-scripts-loaded-securely":               5,
+	"sri-implemented-and-external-scripts-loaded-securely":          5,
+	"sri-not-implemented-response-not-html":                         0,
+	"sri-not-implemented-but-no-scripts-loaded":                     0,
+	"sri-not-implemented-but-all-scripts-loaded-from-secure-origin": 0,
+	"sri-not-implemented-but-external-scripts-loaded-securely":      -5,
+	"sri-implemented-but-external-scripts-not-loaded-securely":      -20,
+	"sri-not-implemented-and-external-scripts-not-loaded-securely":  -50,
+
+	// x-content-type-options
+	"x-content-type-options-nosniff":         0,
+	"x-content-type-options-not-implemented": -5,
+	"x-content-type-options-header-invalid":  -5,
+
+	// x-frame-options
+	"x-frame-options-implemented-via-csp": 5,
+	"x-frame-options-sameorigin-or-deny":  0,
+	"x-frame-options-allow-from-origin":   0,
+	"x-frame-options-not-implemented":     -20,
+	"x-frame-options-header-invalid":      -20,
+
+	// x-xss-protection
+	"x-xss-protection-enabled-mode-block":    0,
+	"x-xss-protection-enabled":               0,
+	"x-xss-protection-not-needed-due-to-csp": 0,
+	"x-xss-protection-disabled":              0,
+	"x-xss-protection-not-implemented":       -10,
+	"x-xss-protection-header-invalid":        -10,
+}
+
+// Modifier return the score modifier of a test result and whether the result is known.
+func Modifier(result string) (int, bool) {
+	modifier, ok := scoreTable[result]
+	return modifier, ok
+}
+
+// Score compute the final score of a scan from the outcome of its tests. Penalties are always
+// applied, but bonuses only count when the score with penalties alone is at least
+// MinimumScoreForExtraCredit. The score can not go below 0.
+func Score(tests []types.TestSummary) int {
+	uncurved, withExtraCredit := StartingScore, StartingScore
+	for _, test := range tests {
+		withExtraCredit += test.ScoreModifier
+		if test.ScoreModifier < 0 {
+			uncurved += test.ScoreModifier
+		}
+	}
+
+	score := uncurved
+	if uncurved >= MinimumScoreForExtraCredit {
+		score = withExtraCredit
+	}
+	if score < 0 {
+		return 0
+	}
+	return score
+}
+
+// Grade return the grade and the Mozilla risk likelihood indicator that match a score.
+func Grade(score int) (grade, likelihood string) {
+	switch {
+	case score >= 100:
+		grade = "A+"
+	case score >= 90:
+		grade = "A"
+	case score >= 85:
+		grade = "A-"
+	case score >= 80:
+		grade = "B+"
+	case score >= 70:
+		grade = "B"
+	case score >= 65:
+		grade = "B-"
+	case score >= 60:
+		grade = "C+"
+	case score >= 50:
+		grade = "C"
+	case score >= 45:
+		grade = "C-"
+	case score >= 40:
+		grade = "D+"
+	case score >= 30:
+		grade = "D"
+	case score >= 25:
+		grade = "D-"
+	default:
+		grade = "F"
+	}
+
+	return grade, Likelihood(grade)
+}
+
+// Likelihood return the Mozilla risk likelihood indicator that match a grade, or an empty string for an
+// empty grade.
+func Likelihood(grade string) string {
+	switch {
+	case grade == "":
+		return ""
+	case grade[0] == 'A':
+		return LikelihoodLow
+	case grade[0] == 'F':
+		return LikelihoodHigh
+	default:
+		return LikelihoodMedium
+	}
+}
+
+// Grades list every grade from the best to the worst.
+var Grades = []string{"A+", "A", "A-", "B+", "B", "B-", "C+", "C", "C-", "D+", "D", "D-", "F"}
+
+// Rank return the rank of a grade, from len(Grades) for the best grade down to 1 for the worst, which allows
+// to compare grades. Unknown grades have a rank of 0.
+func Rank(grade string) int {
+	for i, g := range Grades {
+		if g == grade {
+			return len(Grades) - i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,156 @@
+package grader
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory/types"
+	"testing"
+)
+
+func TestGrade(t *testing.T) {
+	cases := []struct {
+		score          int
+		wantGrade      string
+		wantLikelihood string
+	}{
+		{score: 135, wantGrade: "A+", wantLikelihood: LikelihoodLow},
+		{score: 100, wantGrade: "A+", wantLikelihood: LikelihoodLow},
+		{score: 90, wantGrade: "A", wantLikelihood: LikelihoodLow},
+		{score: 89, wantGrade: "A-", wantLikelihood: LikelihoodLow},
+		{score: 80, wantGrade: "B+", wantLikelihood: LikelihoodMedium},
+		{score: 75, wantGrade: "B", wantLikelihood: LikelihoodMedium},
+		{score: 65, wantGrade: "B-", wantLikelihood: LikelihoodMedium},
+		{score: 50, wantGrade: "C", wantLikelihood: LikelihoodMedium},
+		{score: 25, wantGrade: "D-", wantLikelihood: LikelihoodMedium},
+		{score: 24, wantGrade: "F", wantLikelihood: LikelihoodHigh},
+		{score: 0, wantGrade: "F", wantLikelihood: LikelihoodHigh},
+	}
+
+	for _, tc := range cases {
+		grade, likelihood := Grade(tc.score)
+		assert.Equal(t, tc.wantGrade, grade, "score %d", tc.score)
+		assert.Equal(t, tc.wantLikelihood, likelihood, "score %d", tc.score)
+	}
+}
+
+func TestScore(t *testing.T) {
+	cases := []struct {
+		name      string
+		modifiers []int
+		want      int
+	}{
+		{name: "no modifier", want: 100},
+		{name: "bonus applied", modifiers: []int{5, -10, 10}, want: 105},
+		{name: "bonus ignored below 90", modifiers: []int{5, -20, 10}, want: 80},
+		{name: "never negative", modifiers: []int{-50, -40, -25, -20}, want: 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tests := make([]types.TestSummary, 0, len(tc.modifiers))
+			for _, modifier := range tc.modifiers {
+				tests = append(tests, types.TestSummary{ScoreModifier: modifier})
+			}
+			assert.Equal(t, tc.want, Score(tests))
+		})
+	}
+}
+
+func newTestResult() *types.ScannerTestResult {
+	result := new(types.ScannerTestResult)
+	result.ContentSecurityPolicy.Result = "csp-implemented-with-no-unsafe"
+	result.ContentSecurityPolicy.ScoreModifier = 5
+	result.ContentSecurityPolicy.Pass = true
+	result.StrictTransportSecurity.Result = "hsts-implemented-max-age-at-least-six-months"
+	result.StrictTransportSecurity.Pass = true
+	result.XFrameOptions.Result = "x-frame-options-not-implemented"
+	result.XFrameOptions.ScoreModifier = -20
+	return result
+}
+
+func TestSimulate(t *testing.T) {
+	sim, err := Simulate(
+		newTestResult(),
+		WithHeader("X-Frame-Options", "DENY"),
+		WithResult(types.TestStrictTransportSecurity, "hsts-preloaded"),
+	)
+	require.Nil(t, err)
+	assert.Equal(t, Outcome{Score: 80, Grade: "B+", LikelihoodIndicator: LikelihoodMedium}, sim.Before)
+	assert.Equal(t, Outcome{Score: 110, Grade: "A+", LikelihoodIndicator: LikelihoodLow}, sim.After)
+	require.Len(t, sim.Changes, 2)
+	assert.Equal(t, types.TestSummary{
+		Name:          types.TestStrictTransportSecurity,
+		Pass:          true,
+		Result:        "hsts-preloaded",
+		ScoreModifier: 5,
+	}, sim.Changes[0].After)
+	assert.Equal(t, types.TestSummary{
+		Name:   types.TestXFrameOptions,
+		Pass:   true,
+		Result: "x-frame-options-sameorigin-or-deny",
+	}, sim.Changes[1].After)
+}
+
+func TestSimulateHeader(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+		value  string
+		test   string
+		want   string
+	}{
+		{name: "hsts long max-age", header: "Strict-Transport-Security", value: "max-age=63072000; includeSubDomains; preload", test: types.TestStrictTransportSecurity, want: "hsts-implemented-max-age-at-least-six-months"},
+		{name: "hsts short max-age", header: "Strict-Transport-Security", value: "max-age=300", test: types.TestStrictTransportSecurity, want: "hsts-implemented-max-age-less-than-six-months"},
+		{name: "hsts missing max-age", header: "Strict-Transport-Security", value: "includeSubDomains", test: types.TestStrictTransportSecurity, want: "hsts-header-invalid"},
+		{name: "hsts removed", header: "Strict-Transport-Security", test: types.TestStrictTransportSecurity, want: "hsts-not-implemented"},
+		{name: "xcto nosniff", header: "X-Content-Type-Options", value: "nosniff", test: types.TestXContentTypeOptions, want: "x-content-type-options-nosniff"},
+		{name: "xcto invalid", header: "X-Content-Type-Options", value: "sniff", test: types.TestXContentTypeOptions, want: "x-content-type-options-header-invalid"},
+		{name: "xfo allow from", header: "X-Frame-Options", value: "ALLOW-FROM https://example.com", test: types.TestXFrameOptions, want: "x-frame-options-allow-from-origin"},
+		{name: "xfo invalid", header: "X-Frame-Options", value: "ALLOWALL", test: types.TestXFrameOptions, want: "x-frame-options-header-invalid"},
+		{name: "xxss mode block", header: "X-XSS-Protection", value: "1; mode=block", test: types.TestXXssProtection, want: "x-xss-protection-enabled-mode-block"},
+		{name: "xxss enabled", header: "X-XSS-Protection", value: "1", test: types.TestXXssProtection, want: "x-xss-protection-enabled"},
+		{name: "xxss disabled", header: "X-XSS-Protection", value: "0", test: types.TestXXssProtection, want: "x-xss-protection-disabled"},
+		{name: "xxss invalid", header: "X-XSS-Protection", value: "1; mode=allow", test: types.TestXXssProtection, want: "x-xss-protection-header-invalid"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sim, err := Simulate(newTestResult(), WithHeader(tc.header, tc.value))
+			require.Nil(t, err)
+			got := ""
+			for _, test := range sim.Tests {
+				if test.Name == tc.test {
+					got = test.Result
+				}
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestSimulateError(t *testing.T) {
+	cases := []struct {
+		name     string
+		override Override
+		wantErr  error
+	}{
+		{name: "unknown test", override: WithResult("referrer-policy", "hsts-preloaded"), wantErr: ErrUnknownTest},
+		{name: "unknown result", override: WithResult(types.TestStrictTransportSecurity, "hsts-everywhere"), wantErr: ErrUnknownResult},
+		{name: "unsupported header", override: WithHeader("Content-Security-Policy", "default-src 'none'"), wantErr: ErrUnsupportedHeader},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Simulate(newTestResult(), tc.override)
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestRank(t *testing.T) {
+	assert.Equal(t, 13, Rank("A+"))
+	assert.Equal(t, 11, Rank("A-"))
+	assert.Equal(t, 1, Rank("F"))
+	assert.Equal(t, 0, Rank("Z"))
+	assert.Greater(t, Rank("B-"), Rank("C+"))
+}
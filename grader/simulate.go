@@ -0,0 +1,220 @@
+package grader
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tigerwill90/observatory/types"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownTest       = errors.New("unknown test")
+	ErrUnknownResult     = errors.New("unknown test result")
+	ErrUnsupportedHeader = errors.New("unsupported header")
+)
+
+// sixMonths is the minimum HSTS max-age, in seconds, to not be penalized.
+const sixMonths = 15768000
+
+// Outcome is the score, grade and likelihood indicator of a scan.
+type Outcome struct {
+	Score               int    `json:"score"`
+	Grade               string `json:"grade"`
+	LikelihoodIndicator string `json:"likelihood_indicator"`
+}
+
+// Change describe a test whose outcome differ from the original scan.
+type Change struct {
+	Before types.TestSummary `json:"before"`
+	After  types.TestSummary `json:"after"`
+}
+
+// Simulation is the result of applying overrides to a scan.
+type Simulation struct {
+	// the outcome recomputed from the original tests
+	Before Outcome `json:"before"`
+	// the outcome computed from the overridden tests
+	After Outcome `json:"after"`
+	// the summary of every test, with overrides applied
+	Tests []types.TestSummary `json:"tests"`
+	// the tests affected by an override
+	Changes []Change `json:"changes"`
+}
+
+// Override change the outcome of a test during a simulation.
+type Override interface {
+	apply(tests []types.TestSummary) error
+}
+
+type overrideFunc func(tests []types.TestSummary) error
+
+func (f overrideFunc) apply(tests []types.TestSummary) error {
+	return f(tests)
+}
+
+// WithResult override the result of a test. The score modifier is looked up from the Observatory
+// score table, and the test is considered as passing if the modifier is not a penalty.
+func WithResult(test, result string) Override {
+	return overrideFunc(func(tests []types.TestSummary) error {
+		return setResult(tests, test, result)
+	})
+}
+
+// WithHeader simulate the outcome of a test after setting a response header to the given value. An empty
+// value simulate a missing header. Only headers that are evaluated on their own are supported:
+// Strict-Transport-Security, X-Content-Type-Options, X-Frame-Options and X-XSS-Protection. Tests that depend
+// on the page content or on other headers, such as Content-Security-Policy, must be overridden with WithResult.
+func WithHeader(name, value string) Override {
+	return overrideFunc(func(tests []types.TestSummary) error {
+		v := strings.TrimSpace(value)
+		switch strings.ToLower(name) {
+		case types.TestStrictTransportSecurity:
+			return setResult(tests, types.TestStrictTransportSecurity, evalStrictTransportSecurity(v))
+		case types.TestXContentTypeOptions:
+			return setResult(tests, types.TestXContentTypeOptions, evalXContentTypeOptions(v))
+		case types.TestXFrameOptions:
+			return setResult(tests, types.TestXFrameOptions, evalXFrameOptions(v))
+		case types.TestXXssProtection:
+			return setResult(tests, types.TestXXssProtection, evalXXssProtection(v))
+		default:
+			return fmt.Errorf("%w: %s", ErrUnsupportedHeader, name)
+		}
+	})
+}
+
+// Simulate recompute the score and grade of a scan after applying the overrides, in order, to its tests.
+func Simulate(result *types.ScannerTestResult, overrides ...Override) (*Simulation, error) {
+	before := result.Summaries()
+	after := result.Summaries()
+	for _, override := range overrides {
+		if err := override.apply(after); err != nil {
+			return nil, fmt.Errorf("simulation failed: %w", err)
+		}
+	}
+
+	changes := make([]Change, 0)
+	for i := range before {
+		if before[i] != after[i] {
+			changes = append(changes, Change{Before: before[i], After: after[i]})
+		}
+	}
+
+	return &Simulation{
+		Before:  outcome(before),
+		After:   outcome(after),
+		Tests:   after,
+		Changes: changes,
+	}, nil
+}
+
+func outcome(tests []types.TestSummary) Outcome {
+	score := Score(tests)
+	grade, likelihood := Grade(score)
+	return Outcome{
+		Score:               score,
+		Grade:               grade,
+		LikelihoodIndicator: likelihood,
+	}
+}
+
+func setResult(tests []types.TestSummary, test, result string) error {
+	modifier, ok := Modifier(result)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownResult, result)
+	}
+
+	for i := range tests {
+		if tests[i].Name != test {
+			continue
+		}
+		if tests[i].Result != result {
+			tests[i].Result = result
+			tests[i].ScoreModifier = modifier
+			tests[i].Pass = modifier >= 0
+			tests[i].ScoreDescription = ""
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownTest, test)
+}
+
+func evalStrictTransportSecurity(value string) string {
+	if value == "" {
+		return "hsts-not-implemented"
+	}
+
+	maxAge := -1
+	for _, directive := range strings.Split(value, ";") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		age, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(directive, "max-age="), `"`))
+		if err != nil || age < 0 {
+			return "hsts-header-invalid"
+		}
+		maxAge = age
+	}
+
+	switch {
+	case maxAge < 0:
+		return "hsts-header-invalid"
+	case maxAge >= sixMonths:
+		return "hsts-implemented-max-age-at-least-six-months"
+	default:
+		return "hsts-implemented-max-age-less-than-six-months"
+	}
+}
+
+func evalXContentTypeOptions(value string) string {
+	switch {
+	case value == "":
+		return "x-content-type-options-not-implemented"
+	case strings.EqualFold(value, "nosniff"):
+		return "x-content-type-options-nosniff"
+	default:
+		return "x-content-type-options-header-invalid"
+	}
+}
+
+func evalXFrameOptions(value string) string {
+	value = strings.ToUpper(value)
+	switch {
+	case value == "":
+		return "x-frame-options-not-implemented"
+	case value == "DENY" || value == "SAMEORIGIN":
+		return "x-frame-options-sameorigin-or-deny"
+	case strings.HasPrefix(value, "ALLOW-FROM "):
+		return "x-frame-options-allow-from-origin"
+	default:
+		return "x-frame-options-header-invalid"
+	}
+}
+
+func evalXXssProtection(value string) string {
+	if value == "" {
+		return "x-xss-protection-not-implemented"
+	}
+
+	directives := strings.Split(value, ";")
+	switch strings.TrimSpace(directives[0]) {
+	case "0":
+		return "x-xss-protection-disabled"
+	case "1":
+	default:
+		return "x-xss-protection-header-invalid"
+	}
+
+	for _, directive := range directives[1:] {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "mode=block":
+			return "x-xss-protection-enabled-mode-block"
+		case directive == "", strings.HasPrefix(directive, "report="):
+		default:
+			return "x-xss-protection-header-invalid"
+		}
+	}
+	return "x-xss-protection-enabled"
+}
@@ -0,0 +1,90 @@
+package history
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// columnWidth is the width of the column of each scan in a chart, enough for a grade and a space.
+const columnWidth = 3
+
+// Chart render the score of the scans as an ASCII chart of height rows, with the grade of each scan under the
+// x-axis and the date of the first and last scans. Only the most recent scans fitting in width characters are
+// rendered.
+func Chart(scans []Scan, width, height int) string {
+	if len(scans) == 0 {
+		return "no scan\n"
+	}
+	if height < 2 {
+		height = 2
+	}
+
+	lo, hi, labelWidth := bounds(scans)
+	if columns := (width - labelWidth - 2) / columnWidth; columns > 0 && len(scans) > columns {
+		scans = scans[len(scans)-columns:]
+		lo, hi, labelWidth = bounds(scans)
+	}
+
+	// row of each scan, from 0 at the top to height-1 at the bottom
+	rows := make([]int, len(scans))
+	for i, scan := range scans {
+		rows[i] = int(math.Round(float64(hi-scan.Score) * float64(height-1) / float64(hi-lo)))
+	}
+
+	var b strings.Builder
+	for r := 0; r < height; r++ {
+		value := float64(hi) - float64(r)*float64(hi-lo)/float64(height-1)
+		line := fmt.Sprintf("%*d |", labelWidth, int(math.Round(value)))
+		for i := range scans {
+			if rows[i] == r {
+				line += " * "
+			} else {
+				line += "   "
+			}
+		}
+		b.WriteString(strings.TrimRight(line, " "))
+		b.WriteByte('\n')
+	}
+
+	padding := strings.Repeat(" ", labelWidth+1)
+	b.WriteString(padding + "+" + strings.Repeat("-", len(scans)*columnWidth) + "\n")
+	grades := padding + " "
+	for _, scan := range scans {
+		grades += fmt.Sprintf(" %-2s", scan.Grade)
+	}
+	b.WriteString(strings.TrimRight(grades, " ") + "\n")
+
+	first, last := scans[0].Time.Format("2006-01-02"), scans[len(scans)-1].Time.Format("2006-01-02")
+	dates := padding + "  " + first
+	if len(scans) > 1 {
+		gap := len(scans)*columnWidth - len(first) - len(last)
+		if gap < 1 {
+			gap = 1
+		}
+		dates += strings.Repeat(" ", gap) + last
+	}
+	b.WriteString(dates + "\n")
+	return b.String()
+}
+
+// bounds return the range of the score axis of the scans and the width of its labels.
+func bounds(scans []Scan) (lo, hi, labelWidth int) {
+	lo, hi = scans[0].Score, scans[0].Score
+	for _, scan := range scans {
+		if scan.Score < lo {
+			lo = scan.Score
+		}
+		if scan.Score > hi {
+			hi = scan.Score
+		}
+	}
+	if lo == hi {
+		lo, hi = lo-5, hi+5
+	}
+	labelWidth = len(fmt.Sprint(hi))
+	if l := len(fmt.Sprint(lo)); l > labelWidth {
+		labelWidth = l
+	}
+	return lo, hi, labelWidth
+}
@@ -0,0 +1,160 @@
+// Package history analyze the scan history of a host: score time series, grade changes, regressions and
+// flapping grades. The api only return the last scans of a host, so its history is merged with the records
+// persisted in a store.Store, e.g. by a monitor.
+package history
+
+import (
+	"context"
+	"fmt"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/grader"
+	"github.com/tigerwill90/observatory/store"
+	"github.com/tigerwill90/observatory/types"
+	"sort"
+	"time"
+)
+
+const (
+	// number of most recent scans in which flapping is detected
+	flapWindow = 10
+	// number of grade changes reverting the previous change, within the window, for a grade to flap
+	flapThreshold = 2
+)
+
+// Scan is a finished scan of a host.
+type Scan struct {
+	ScanID types.ScanID `json:"scan_id"`
+	Time   time.Time    `json:"time"`
+	Grade  string       `json:"grade"`
+	Score  int          `json:"score"`
+}
+
+// Merge return the scans of the host history returned by the api and of the records of the host, deduplicated by
+// scan ID and ordered by time. Records without grade, such as unfinished scans, are skipped.
+func Merge(histories []*types.ScannerHostHistory, records []*store.Record) []Scan {
+	seen := make(map[types.ScanID]bool, len(histories)+len(records))
+	scans := make([]Scan, 0, len(histories)+len(records))
+	for _, h := range histories {
+		if seen[h.ScanId] {
+			continue
+		}
+		seen[h.ScanId] = true
+		scans = append(scans, Scan{
+			ScanID: h.ScanId,
+			Time:   time.Unix(int64(h.EndTimeUnixTimestamp), 0).UTC(),
+			Grade:  h.Grade,
+			Score:  h.Score,
+		})
+	}
+	for _, rec := range records {
+		if seen[rec.ScanID] || rec.Result == nil || rec.Result.Grade == "" {
+			continue
+		}
+		seen[rec.ScanID] = true
+		scans = append(scans, Scan{ScanID: rec.ScanID, Time: rec.Time.UTC(), Grade: rec.Result.Grade, Score: rec.Result.Score})
+	}
+	sort.SliceStable(scans, func(i, j int) bool {
+		if scans[i].Time.Equal(scans[j].Time) {
+			return scans[i].ScanID < scans[j].ScanID
+		}
+		return scans[i].Time.Before(scans[j].Time)
+	})
+	return scans
+}
+
+// Load retrieve the history of the host with c and merge it with the records of the host in s, if s is not nil.
+// The host is normalized by the client first, since the records are saved under the host it scanned.
+func Load(ctx context.Context, c *observatory.Client, s store.Store, host string) ([]Scan, error) {
+	host, err := c.NormalizeHost(host)
+	if err != nil {
+		return nil, err
+	}
+	histories, err := c.GetScanHistory(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var records []*store.Record
+	if s != nil {
+		if records, err = s.Query(ctx, store.Query{Host: host}); err != nil {
+			return nil, fmt.Errorf("load history failed: %w", err)
+		}
+	}
+	return Merge(histories, records), nil
+}
+
+// GradeChange is a change of grade between two consecutive scans.
+type GradeChange struct {
+	From Scan `json:"from"`
+	To   Scan `json:"to"`
+}
+
+// Regression return true if the grade is lower after the change.
+func (c GradeChange) Regression() bool {
+	return grader.Rank(c.To.Grade) < grader.Rank(c.From.Grade)
+}
+
+// Analysis is the analysis of the scan history of a host.
+type Analysis struct {
+	Host string `json:"host"`
+	// scans ordered by time
+	Scans []Scan `json:"scans"`
+	// grade changes ordered by time
+	Changes []GradeChange `json:"changes"`
+	// number of changes to a lower grade
+	Regressions int `json:"regressions"`
+	// mean time between two regressions, zero with less than two regressions
+	MeanTimeBetweenRegressions time.Duration `json:"mean_time_between_regressions"`
+	// time elapsed since the last scan, zero without scan
+	SinceLastScan time.Duration `json:"since_last_scan"`
+	// number of grade changes reverting the previous change, e.g. from B back to A after a change from A to B
+	Flaps int `json:"flaps"`
+	// whether the grade changed back at least twice within the last ten scans
+	Flapping bool `json:"flapping"`
+}
+
+// Analyze analyze the scans of the host, ordered by time, at now.
+func Analyze(host string, scans []Scan, now time.Time) *Analysis {
+	a := &Analysis{Host: host, Scans: scans, Changes: make([]GradeChange, 0)}
+	if len(scans) > 0 {
+		a.SinceLastScan = now.Sub(scans[len(scans)-1].Time)
+	}
+
+	var regressions []time.Time
+	// index of the scan before the previous change
+	prevFrom := -1
+	recentFlaps := 0
+	for i := 1; i < len(scans); i++ {
+		if scans[i].Grade == scans[i-1].Grade {
+			continue
+		}
+		change := GradeChange{From: scans[i-1], To: scans[i]}
+		if change.Regression() {
+			regressions = append(regressions, change.To.Time)
+		}
+		if prevFrom >= 0 && scans[prevFrom].Grade == change.To.Grade {
+			a.Flaps++
+			// the flap must fit within the window
+			if prevFrom >= len(scans)-flapWindow {
+				recentFlaps++
+			}
+		}
+		a.Changes = append(a.Changes, change)
+		prevFrom = i - 1
+	}
+
+	a.Regressions = len(regressions)
+	if len(regressions) > 1 {
+		a.MeanTimeBetweenRegressions = regressions[len(regressions)-1].Sub(regressions[0]) / time.Duration(len(regressions)-1)
+	}
+	a.Flapping = recentFlaps >= flapThreshold
+	return a
+}
+
+// Scores return the score of each scan.
+func (a *Analysis) Scores() []int {
+	scores := make([]int, 0, len(a.Scans))
+	for _, scan := range a.Scans {
+		scores = append(scores, scan.Score)
+	}
+	return scores
+}
@@ -0,0 +1,144 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/store"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var day0 = time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+func scansOf(grades ...string) []Scan {
+	scans := make([]Scan, 0, len(grades))
+	for i, grade := range grades {
+		scans = append(scans, Scan{ScanID: types.ScanID(i + 1), Time: day0.AddDate(0, 0, i), Grade: grade, Score: 100 - 10*i})
+	}
+	return scans
+}
+
+func TestMerge(t *testing.T) {
+	histories := []*types.ScannerHostHistory{
+		{ScanId: 3, EndTimeUnixTimestamp: int(day0.AddDate(0, 0, 2).Unix()), Grade: "B", Score: 70},
+		{ScanId: 4, EndTimeUnixTimestamp: int(day0.AddDate(0, 0, 3).Unix()), Grade: "A", Score: 90},
+	}
+	records := []*store.Record{
+		{ScanID: 4, Time: day0.AddDate(0, 0, 3), Result: &types.ScannerResult{Grade: "A", Score: 90}},
+		{ScanID: 1, Time: day0, Result: &types.ScannerResult{Grade: "A+", Score: 110}},
+		{ScanID: 2, Time: day0.AddDate(0, 0, 1), Result: &types.ScannerResult{State: observatory.Running}},
+	}
+
+	scans := Merge(histories, records)
+	assert.Equal(t, []Scan{
+		{ScanID: 1, Time: day0, Grade: "A+", Score: 110},
+		{ScanID: 3, Time: day0.AddDate(0, 0, 2), Grade: "B", Score: 70},
+		{ScanID: 4, Time: day0.AddDate(0, 0, 3), Grade: "A", Score: 90},
+	}, scans)
+	assert.Empty(t, Merge(nil, nil))
+}
+
+func TestLoad(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := []*types.ScannerHostHistory{{ScanId: 2, EndTimeUnixTimestamp: int(day0.AddDate(0, 0, 1).Unix()), Grade: "B", Score: 70}}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer srv.Close()
+	c := observatory.NewCustomClient(srv.Client(), srv.URL)
+	s, err := store.NewFileStore(t.TempDir())
+	require.Nil(t, err)
+	ctx := context.Background()
+	require.Nil(t, s.Save(ctx, &store.Record{Host: "observatory.mozilla.org", ScanID: 1, Time: day0, Result: &types.ScannerResult{Grade: "A", Score: 90}}))
+
+	scans, err := Load(ctx, c, nil, "observatory.mozilla.org")
+	require.Nil(t, err)
+	assert.Len(t, scans, 1)
+
+	scans, err = Load(ctx, c, s, "https://Observatory.Mozilla.org/")
+	require.Nil(t, err)
+	require.Len(t, scans, 2)
+	assert.Equal(t, "A", scans[0].Grade)
+	assert.Equal(t, "B", scans[1].Grade)
+}
+
+func TestAnalyze(t *testing.T) {
+	cases := []struct {
+		name        string
+		scans       []Scan
+		changes     int
+		regressions int
+		mtbr        time.Duration
+		flaps       int
+		flapping    bool
+	}{
+		{name: "no scan", scans: nil},
+		{name: "steady", scans: scansOf("A", "A", "A")},
+		{name: "progression", scans: scansOf("C", "B", "A", "A+"), changes: 3},
+		{name: "regressions", scans: scansOf("A", "B", "B", "C", "C", "D"), changes: 3, regressions: 3, mtbr: 48 * time.Hour},
+		{name: "single flap", scans: scansOf("A", "B", "A"), changes: 2, regressions: 1, flaps: 1},
+		{name: "flapping", scans: scansOf("A", "B", "A", "B"), changes: 3, regressions: 2, mtbr: 48 * time.Hour, flaps: 2, flapping: true},
+		{
+			name:        "old flaps",
+			scans:       scansOf("A", "B", "A", "B", "B", "B", "B", "B", "B", "B", "B", "B", "B"),
+			changes:     3,
+			regressions: 2,
+			mtbr:        48 * time.Hour,
+			flaps:       2,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := day0.AddDate(0, 1, 0)
+			a := Analyze("observatory.mozilla.org", tc.scans, now)
+			assert.Len(t, a.Changes, tc.changes)
+			assert.Equal(t, tc.regressions, a.Regressions)
+			assert.Equal(t, tc.mtbr, a.MeanTimeBetweenRegressions)
+			assert.Equal(t, tc.flaps, a.Flaps)
+			assert.Equal(t, tc.flapping, a.Flapping)
+			if len(tc.scans) > 0 {
+				assert.Equal(t, now.Sub(tc.scans[len(tc.scans)-1].Time), a.SinceLastScan)
+			} else {
+				assert.Zero(t, a.SinceLastScan)
+			}
+			assert.Len(t, a.Scores(), len(tc.scans))
+		})
+	}
+
+	a := Analyze("observatory.mozilla.org", scansOf("A", "B"), day0)
+	require.Len(t, a.Changes, 1)
+	assert.True(t, a.Changes[0].Regression())
+	assert.Equal(t, types.ScanID(2), a.Changes[0].To.ScanID)
+}
+
+func TestChart(t *testing.T) {
+	scans := []Scan{
+		{Time: day0, Grade: "B", Score: 60},
+		{Time: day0.AddDate(0, 0, 1), Grade: "A", Score: 90},
+		{Time: day0.AddDate(0, 0, 2), Grade: "A+", Score: 120},
+	}
+	want := "120 |       *\n" +
+		" 90 |    *\n" +
+		" 60 | *\n" +
+		"    +---------\n" +
+		"      B  A  A+\n" +
+		"      2021-03-01 2021-03-03\n"
+	assert.Equal(t, want, Chart(scans, 80, 3))
+
+	// only the most recent scans fitting in the width are rendered
+	want = "120 |    *\n" +
+		" 90 | *\n" +
+		"    +------\n" +
+		"      A  A+\n" +
+		"      2021-03-02 2021-03-03\n"
+	assert.Equal(t, want, Chart(scans, 12, 2))
+
+	assert.Equal(t, "no scan\n", Chart(nil, 80, 10))
+}
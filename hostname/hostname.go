@@ -0,0 +1,103 @@
+// Package hostname parse and validate the hosts given to HTTP Observatory. Hosts are often copied from a browser
+// or a configuration file, so Normalize accept a URL or a host:port and return the bare hostname, lower case and
+// with internationalized labels converted to punycode. Hosts that HTTP Observatory refuse to scan, such as IP
+// addresses, localhost and private or reserved names, are rejected with an error wrapping ErrInvalidHost.
+package hostname
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/net/idna"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidHost is wrapped by every error returned by Normalize.
+	ErrInvalidHost     = errors.New("invalid host")
+	ErrEmptyHost       = fmt.Errorf("%w: empty hostname", ErrInvalidHost)
+	ErrInvalidPort     = fmt.Errorf("%w: bad port", ErrInvalidHost)
+	ErrInvalidHostname = fmt.Errorf("%w: malformed hostname", ErrInvalidHost)
+	ErrIPAddress       = fmt.Errorf("%w: IP addresses are not supported", ErrInvalidHost)
+	ErrReservedHost    = fmt.Errorf("%w: private or reserved hostname", ErrInvalidHost)
+)
+
+// reserved is the special-use top level domains, which are never publicly resolvable.
+var reserved = []string{
+	"localhost",
+	"local",
+	"localdomain",
+	"internal",
+	"test",
+	"example",
+	"invalid",
+	"onion",
+	"arpa",
+}
+
+// profile convert hostnames to punycode, and reject labels that are not valid in a DNS name.
+var profile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.VerifyDNSLength(true),
+)
+
+// Normalize return the hostname of a host, URL or host:port, lower case and with internationalized labels
+// converted to punycode. The scheme, user info, port, path, query and trailing dot are removed.
+func Normalize(host string) (string, error) {
+	h := strings.TrimSpace(host)
+	if i := strings.Index(h, "://"); i >= 0 {
+		h = h[i+3:]
+	}
+	if i := strings.IndexAny(h, "/?#"); i >= 0 {
+		h = h[:i]
+	}
+	if i := strings.LastIndex(h, "@"); i >= 0 {
+		h = h[i+1:]
+	}
+	if strings.HasPrefix(h, "[") {
+		return "", fmt.Errorf("%q: %w", host, ErrIPAddress)
+	}
+	if i := strings.LastIndex(h, ":"); i >= 0 {
+		if net.ParseIP(h) != nil {
+			return "", fmt.Errorf("%q: %w", host, ErrIPAddress)
+		}
+		if _, err := strconv.ParseUint(h[i+1:], 10, 16); err != nil {
+			return "", fmt.Errorf("%q: %w", host, ErrInvalidPort)
+		}
+		h = h[:i]
+	}
+	h = strings.TrimSuffix(h, ".")
+	if h == "" {
+		return "", fmt.Errorf("%q: %w", host, ErrEmptyHost)
+	}
+	if net.ParseIP(h) != nil {
+		return "", fmt.Errorf("%q: %w", host, ErrIPAddress)
+	}
+
+	ascii, err := profile.ToASCII(h)
+	if err != nil {
+		return "", fmt.Errorf("%q: %w: %s", host, ErrInvalidHostname, err)
+	}
+	if isReserved(ascii) {
+		return "", fmt.Errorf("%q: %w", host, ErrReservedHost)
+	}
+	return ascii, nil
+}
+
+// isReserved return true if the hostname is a single label, such as an intranet name, or is within a reserved
+// domain.
+func isReserved(host string) bool {
+	i := strings.LastIndex(host, ".")
+	if i < 0 {
+		return true
+	}
+	tld := host[i+1:]
+	for _, name := range reserved {
+		if tld == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package hostname
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		name    string
+		host    string
+		want    string
+		wantErr error
+	}{
+		{name: "hostname", host: "observatory.mozilla.org", want: "observatory.mozilla.org"},
+		{name: "upper case", host: " Observatory.Mozilla.ORG ", want: "observatory.mozilla.org"},
+		{name: "url", host: "https://user@observatory.mozilla.org:443/analyze?host=x#top", want: "observatory.mozilla.org"},
+		{name: "url without path", host: "https://observatory.mozilla.org/", want: "observatory.mozilla.org"},
+		{name: "port", host: "observatory.mozilla.org:8443", want: "observatory.mozilla.org"},
+		{name: "trailing dot", host: "observatory.mozilla.org.", want: "observatory.mozilla.org"},
+		{name: "idn", host: "Bücher.de", want: "xn--bcher-kva.de"},
+		{name: "punycode", host: "xn--bcher-kva.de", want: "xn--bcher-kva.de"},
+		{name: "empty", host: "https://", wantErr: ErrEmptyHost},
+		{name: "blank", host: "  ", wantErr: ErrEmptyHost},
+		{name: "bad port", host: "observatory.mozilla.org:https", wantErr: ErrInvalidPort},
+		{name: "ipv4", host: "192.0.2.1", wantErr: ErrIPAddress},
+		{name: "ipv4 url", host: "http://192.0.2.1:8080/", wantErr: ErrIPAddress},
+		{name: "ipv6", host: "[2001:db8::1]:443", wantErr: ErrIPAddress},
+		{name: "bare ipv6", host: "2001:db8::1", wantErr: ErrIPAddress},
+		{name: "space", host: "exa mple.com", wantErr: ErrInvalidHostname},
+		{name: "empty label", host: "observatory..mozilla.org", wantErr: ErrInvalidHostname},
+		{name: "localhost", host: "http://localhost:8080", wantErr: ErrReservedHost},
+		{name: "localhost subdomain", host: "app.localhost", wantErr: ErrReservedHost},
+		{name: "single label", host: "intranet", wantErr: ErrReservedHost},
+		{name: "mdns", host: "printer.local", wantErr: ErrReservedHost},
+		{name: "internal", host: "grafana.corp.internal", wantErr: ErrReservedHost},
+		{name: "home network", host: "nas.home.arpa", wantErr: ErrReservedHost},
+		{name: "test", host: "www.example.test", wantErr: ErrReservedHost},
+		{name: "onion", host: "duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczad.onion", wantErr: ErrReservedHost},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Normalize(tc.host)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				assert.ErrorIs(t, err, ErrInvalidHost)
+				return
+			}
+			require.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -1,6 +1,13 @@
 package option
 
-import "time"
+import (
+	"crypto/tls"
+	"github.com/tigerwill90/observatory/cache"
+	"github.com/tigerwill90/observatory/logging"
+	"github.com/tigerwill90/observatory/middleware"
+	"github.com/tigerwill90/observatory/telemetry"
+	"time"
+)
 
 func DefaultOption() *AnalyzeOption {
 	return &AnalyzeOption{
@@ -28,6 +35,72 @@ type ScanOption interface {
 }
 
 type RecentScanOption struct {
-	Min uint
-	Max uint
+	Min    uint
+	Max    uint
+	Grades []string
+}
+
+func DefaultStatsOption() *ScannerStatsOption {
+	return &ScannerStatsOption{}
+}
+
+type StatsOption interface {
+	Apply(*ScannerStatsOption)
+}
+
+type ScannerStatsOption struct {
+	Verbose bool
+}
+
+// APIVersion is a version of the HTTP Observatory api.
+type APIVersion int
+
+const (
+	APIv1 APIVersion = 1
+	APIv2 APIVersion = 2
+)
+
+func DefaultClientConfig() *ClientConfig {
+	return &ClientConfig{
+		APIVersion:           APIv1,
+		AssessmentTTL:        24 * time.Hour,
+		GradeDistributionTTL: time.Hour,
+		LogLevel:             logging.LevelInfo,
+		Deduplication:        true,
+		HostValidation:       true,
+	}
+}
+
+type ClientOption interface {
+	Apply(*ClientConfig)
+}
+
+type ClientConfig struct {
+	APIVersion           APIVersion
+	Cache                cache.Cache
+	AssessmentTTL        time.Duration
+	GradeDistributionTTL time.Duration
+	Tracer               telemetry.Tracer
+	Meter                telemetry.Meter
+	Logger               logging.Logger
+	LogLevel             logging.Level
+	Middlewares          []middleware.Middleware
+	BearerToken          string
+	BasicAuth            *BasicAuth
+	TLSConfig            *tls.Config
+	FallbackEndpoints    []string
+	CircuitBreaker       *CircuitBreaker
+	CircuitStateHook     func(endpoint, from, to string)
+	Deduplication        bool
+	HostValidation       bool
+}
+
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+}
+
+type BasicAuth struct {
+	Username string
+	Password string
 }
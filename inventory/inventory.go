@@ -0,0 +1,228 @@
+// Package inventory load the hosts to scan from files: a YAML or JSON inventory, a plain list with one host per
+// line, a CSV file or a DNS zone file. Each entry can override how its host is scanned, with the rescan, hidden,
+// poll interval and policy settings. Hostnames are normalized, so that "https://Bücher.de:443/path" and
+// "xn--bcher-kva.de" are the same host, and duplicates are merged. Hosts that HTTP Observatory refuse to scan are
+// rejected, see hostname.Normalize.
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tigerwill90/observatory/hostname"
+	"github.com/tigerwill90/observatory/internal/option"
+	publicoption "github.com/tigerwill90/observatory/option"
+	"github.com/tigerwill90/observatory/policy"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrInvalidInventory = errors.New("invalid inventory")
+
+// Format is an inventory file format.
+type Format string
+
+const (
+	// FormatYAML is a YAML or JSON document with a list of hosts and their overrides, and defaults for every host.
+	FormatYAML Format = "yaml"
+	// FormatList is a plain list with one host per line. Blank lines and lines starting with # are ignored.
+	FormatList Format = "list"
+	// FormatCSV is a CSV file with the host, rescan, hidden, poll_interval and policy columns, in this order unless
+	// the first row is a header naming them. Only the host column is required.
+	FormatCSV Format = "csv"
+	// FormatZone is a DNS zone file, in the RFC 1035 master file format. The owner names of the A, AAAA and CNAME
+	// records are the hosts, wildcards excepted.
+	FormatZone Format = "zone"
+)
+
+// FormatOf return the format of a file given its extension: .yaml, .yml and .json are FormatYAML, .csv is
+// FormatCSV, .zone and .db are FormatZone, and anything else is FormatList.
+func FormatOf(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return FormatYAML
+	case ".csv":
+		return FormatCSV
+	case ".zone", ".db":
+		return FormatZone
+	default:
+		return FormatList
+	}
+}
+
+// Entry is a host of the inventory and how it should be scanned. Unset overrides let the consumer decide.
+type Entry struct {
+	Host string `yaml:"host" json:"host"`
+	// ask for a new scan instead of reusing a recent one
+	Rescan *bool `yaml:"rescan" json:"rescan,omitempty"`
+	// hide the scans from the public results
+	Hidden *bool `yaml:"hidden" json:"hidden,omitempty"`
+	// delay between two retrievals of an ongoing scan
+	PollInterval time.Duration `yaml:"poll_interval" json:"poll_interval,omitempty"`
+	// path of the policy file the host is checked against, relative to the inventory file
+	Policy string `yaml:"policy" json:"policy,omitempty"`
+	// where the entry come from, such as file:line, if known
+	Source string `yaml:"-" json:"source,omitempty"`
+}
+
+// Options return the Client.Analyze options matching the overrides of the entry. They should be passed after
+// the options of the consumer, so that they take precedence.
+func (e *Entry) Options() []option.Option {
+	opts := make([]option.Option, 0, 3)
+	if e.Rescan != nil {
+		opts = append(opts, publicoption.ForceRescan(*e.Rescan))
+	}
+	if e.Hidden != nil {
+		opts = append(opts, publicoption.HideResult(*e.Hidden))
+	}
+	if e.PollInterval > 0 {
+		opts = append(opts, publicoption.WaitFinished(true, e.PollInterval))
+	}
+	return opts
+}
+
+// merge override the settings of the entry with the ones set in other.
+func (e *Entry) merge(other *Entry) {
+	if other.Rescan != nil {
+		e.Rescan = other.Rescan
+	}
+	if other.Hidden != nil {
+		e.Hidden = other.Hidden
+	}
+	if other.PollInterval > 0 {
+		e.PollInterval = other.PollInterval
+	}
+	if other.Policy != "" {
+		e.Policy = other.Policy
+	}
+}
+
+// Inventory is an ordered set of hosts.
+type Inventory struct {
+	entries []*Entry
+	index   map[string]*Entry
+}
+
+// New return an inventory with the given entries.
+func New(entries ...Entry) (*Inventory, error) {
+	inv := &Inventory{index: make(map[string]*Entry)}
+	if err := inv.Add(entries...); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// Load load and merge the inventory files, whose format is given by FormatOf.
+func Load(paths ...string) (*Inventory, error) {
+	inv, _ := New()
+	for _, path := range paths {
+		if err := inv.LoadFile(path, FormatOf(path)); err != nil {
+			return nil, err
+		}
+	}
+	return inv, nil
+}
+
+// LoadFile add the entries of an inventory file. Relative policy paths are resolved against the directory of
+// the file.
+func (inv *Inventory) LoadFile(path string, format Format) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to read inventory: %w", err)
+	}
+	defer f.Close()
+
+	entries, err := parse(f, path, format)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	for i := range entries {
+		if p := entries[i].Policy; p != "" && !filepath.IsAbs(p) {
+			entries[i].Policy = filepath.Join(dir, p)
+		}
+	}
+	return inv.Add(entries...)
+}
+
+// Add normalize the hosts of the entries and add them to the inventory. An entry whose host is already in the
+// inventory override its settings, but keep its position.
+func (inv *Inventory) Add(entries ...Entry) error {
+	if inv.index == nil {
+		inv.index = make(map[string]*Entry)
+	}
+	for i := range entries {
+		e := entries[i]
+		host, err := hostname.Normalize(e.Host)
+		if err != nil {
+			if e.Source != "" {
+				return fmt.Errorf("%w: %s: %s", ErrInvalidInventory, e.Source, err)
+			}
+			return fmt.Errorf("%w: %s", ErrInvalidInventory, err)
+		}
+		e.Host = host
+		if existing, ok := inv.index[host]; ok {
+			existing.merge(&e)
+			continue
+		}
+		inv.index[host] = &e
+		inv.entries = append(inv.entries, &e)
+	}
+	return nil
+}
+
+// Entries return a copy of the entries, in the order their host was first added.
+func (inv *Inventory) Entries() []Entry {
+	entries := make([]Entry, 0, len(inv.entries))
+	for _, e := range inv.entries {
+		entries = append(entries, *e)
+	}
+	return entries
+}
+
+// Hosts return the normalized hosts, in the order they were first added.
+func (inv *Inventory) Hosts() []string {
+	hosts := make([]string, 0, len(inv.entries))
+	for _, e := range inv.entries {
+		hosts = append(hosts, e.Host)
+	}
+	return hosts
+}
+
+// Lookup return the entry of a host, which is normalized first.
+func (inv *Inventory) Lookup(host string) (Entry, bool) {
+	host, err := hostname.Normalize(host)
+	if err != nil {
+		return Entry{}, false
+	}
+	e, ok := inv.index[host]
+	if !ok {
+		return Entry{}, false
+	}
+	return *e, true
+}
+
+// Len return the number of hosts.
+func (inv *Inventory) Len() int {
+	return len(inv.entries)
+}
+
+// Policies load the policy files referenced by the entries, each file once, and return them by path.
+func (inv *Inventory) Policies() (map[string]*policy.Policy, error) {
+	policies := make(map[string]*policy.Policy)
+	for _, e := range inv.entries {
+		if e.Policy == "" {
+			continue
+		}
+		if _, ok := policies[e.Policy]; ok {
+			continue
+		}
+		p, err := policy.Load(e.Policy)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Host, err)
+		}
+		policies[e.Policy] = p
+	}
+	return policies, nil
+}
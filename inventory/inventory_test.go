@@ -0,0 +1,176 @@
+package inventory
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory/internal/option"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name   string
+		format Format
+		input  string
+		want   []string
+	}{
+		{
+			name:   "list",
+			format: FormatList,
+			input:  "# web\nobservatory.mozilla.org\n\n  developer.mozilla.org  \n",
+			want:   []string{"observatory.mozilla.org", "developer.mozilla.org"},
+		},
+		{
+			name:   "yaml",
+			format: FormatYAML,
+			input:  "hosts:\n  - observatory.mozilla.org\n  - host: developer.mozilla.org\n",
+			want:   []string{"observatory.mozilla.org", "developer.mozilla.org"},
+		},
+		{
+			name:   "json",
+			format: FormatYAML,
+			input:  `{"hosts": ["observatory.mozilla.org", {"host": "developer.mozilla.org"}]}`,
+			want:   []string{"observatory.mozilla.org", "developer.mozilla.org"},
+		},
+		{
+			name:   "csv without header",
+			format: FormatCSV,
+			input:  "observatory.mozilla.org,true\n# comment\ndeveloper.mozilla.org\n",
+			want:   []string{"observatory.mozilla.org", "developer.mozilla.org"},
+		},
+		{
+			name:   "zone",
+			format: FormatZone,
+			input: `$ORIGIN example.com.
+$TTL 3600
+@       IN  SOA ns1 hostmaster (
+                2021030101 ; serial
+                7200 3600 1209600 3600 )
+        IN  NS  ns1
+        IN  A   192.0.2.1
+www     IN  CNAME @
+api 300 IN  AAAA 2001:db8::1
+        IN  A   192.0.2.2 ; same owner
+mail    IN  MX  10 mx.example.net.
+*.dev   IN  A   192.0.2.3
+_dmarc  IN  TXT "v=DMARC1; p=none"
+static.example.org. A 192.0.2.4
+`,
+			want: []string{"example.com", "www.example.com", "api.example.com", "api.example.com", "static.example.org"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := Parse(strings.NewReader(tc.input), "hosts", tc.format)
+			require.Nil(t, err)
+			hosts := make([]string, 0, len(entries))
+			for _, e := range entries {
+				hosts = append(hosts, e.Host)
+			}
+			assert.Equal(t, tc.want, hosts)
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	cases := []struct {
+		name   string
+		format Format
+		input  string
+	}{
+		{name: "unknown format", format: "xml", input: ""},
+		{name: "yaml", format: FormatYAML, input: "hosts: 1"},
+		{name: "csv unknown column", format: FormatCSV, input: "host,owner\nexample.com,me\n"},
+		{name: "csv bad bool", format: FormatCSV, input: "example.com,maybe\n"},
+		{name: "csv bad duration", format: FormatCSV, input: "host,poll_interval\nexample.com,10\n"},
+		{name: "zone relative name", format: FormatZone, input: "www IN A 192.0.2.1\n"},
+		{name: "zone parentheses", format: FormatZone, input: "$ORIGIN example.com.\n@ IN SOA ns1 hostmaster ( 1 2 3\n"},
+		{name: "zone include", format: FormatZone, input: "$INCLUDE other.zone\n"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tc.input), "hosts", tc.format)
+			assert.ErrorIs(t, err, ErrInvalidInventory)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "hosts.yaml")
+	require.Nil(t, ioutil.WriteFile(yamlPath, []byte(`
+defaults:
+  hidden: true
+  poll_interval: 5s
+  policy: policies/default.yaml
+hosts:
+  - https://Observatory.Mozilla.org/
+  - host: developer.mozilla.org
+    hidden: false
+    rescan: true
+    policy: /etc/observatory/strict.yaml
+`), 0o644))
+	csvPath := filepath.Join(dir, "hosts.csv")
+	require.Nil(t, ioutil.WriteFile(csvPath, []byte("host,rescan,poll_interval\nobservatory.mozilla.org,true,1s\nBücher.de,,\n"), 0o644))
+	listPath := filepath.Join(dir, "hosts.txt")
+	require.Nil(t, ioutil.WriteFile(listPath, []byte("not a host\n"), 0o644))
+
+	inv, err := Load(yamlPath, csvPath)
+	require.Nil(t, err)
+	assert.Equal(t, 3, inv.Len())
+	assert.Equal(t, []string{"observatory.mozilla.org", "developer.mozilla.org", "xn--bcher-kva.de"}, inv.Hosts())
+
+	e, ok := inv.Lookup("OBSERVATORY.mozilla.org")
+	require.True(t, ok)
+	assert.True(t, *e.Hidden)
+	assert.True(t, *e.Rescan)
+	assert.Equal(t, time.Second, e.PollInterval)
+	assert.Equal(t, filepath.Join(dir, "policies", "default.yaml"), e.Policy)
+	assert.Len(t, e.Options(), 3)
+
+	e, ok = inv.Lookup("developer.mozilla.org")
+	require.True(t, ok)
+	assert.False(t, *e.Hidden)
+	assert.Equal(t, "/etc/observatory/strict.yaml", e.Policy)
+
+	e, ok = inv.Lookup("bücher.de")
+	require.True(t, ok)
+	assert.Empty(t, e.Options())
+
+	opts := &option.AnalyzeOption{}
+	for _, opt := range inv.Entries()[1].Options() {
+		opt.Apply(opts)
+	}
+	assert.Equal(t, option.AnalyzeOption{Hidden: false, Rescan: true, WaitFinished: true, PullInterval: 5 * time.Second}, *opts)
+
+	_, err = Load(listPath)
+	assert.ErrorIs(t, err, ErrInvalidInventory)
+	assert.Contains(t, err.Error(), "hosts.txt:1")
+	assert.ErrorIs(t, inv.Add(Entry{Host: "http://localhost:8080"}), ErrInvalidInventory)
+
+	_, err = Load(filepath.Join(dir, "missing.txt"))
+	assert.NotNil(t, err)
+}
+
+func TestPolicies(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "policy.yaml"), []byte("rules:\n  - expr: grade >= A\n"), 0o644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "hosts.csv"), []byte("host,policy\na.example.com,policy.yaml\nb.example.com,policy.yaml\nc.example.com,\n"), 0o644))
+
+	inv, err := Load(filepath.Join(dir, "hosts.csv"))
+	require.Nil(t, err)
+	policies, err := inv.Policies()
+	require.Nil(t, err)
+	require.Len(t, policies, 1)
+	assert.Len(t, policies[filepath.Join(dir, "policy.yaml")].Rules, 1)
+
+	require.Nil(t, inv.Add(Entry{Host: "d.example.com", Policy: filepath.Join(dir, "missing.yaml")}))
+	_, err = inv.Policies()
+	assert.NotNil(t, err)
+}
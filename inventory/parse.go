@@ -0,0 +1,176 @@
+package inventory
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parse parse the entries of an inventory. The name identify the inventory in errors and entry sources.
+func Parse(r io.Reader, name string, format Format) ([]Entry, error) {
+	return parse(r, name, format)
+}
+
+func parse(r io.Reader, name string, format Format) ([]Entry, error) {
+	switch format {
+	case FormatYAML:
+		return parseYAML(r, name)
+	case FormatList:
+		return parseList(r, name)
+	case FormatCSV:
+		return parseCSV(r, name)
+	case FormatZone:
+		return parseZone(r, name)
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidInventory, format)
+	}
+}
+
+// yamlEntry is an entry of a YAML inventory, which is either a host or a mapping.
+type yamlEntry struct {
+	Entry
+}
+
+func (e *yamlEntry) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		e.Host = value.Value
+	} else if err := value.Decode(&e.Entry); err != nil {
+		return err
+	}
+	e.Source = fmt.Sprintf(":%d", value.Line)
+	return nil
+}
+
+type yamlInventory struct {
+	// settings of the hosts that do not override them
+	Defaults Entry       `yaml:"defaults"`
+	Hosts    []yamlEntry `yaml:"hosts"`
+}
+
+func parseYAML(r io.Reader, name string) ([]Entry, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	doc := new(yamlInventory)
+	if err := yaml.Unmarshal(buf, doc); err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrInvalidInventory, name, err)
+	}
+
+	entries := make([]Entry, 0, len(doc.Hosts))
+	for _, ye := range doc.Hosts {
+		e := doc.Defaults
+		e.Host = ye.Host
+		e.Source = name + ye.Source
+		e.merge(&ye.Entry)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func parseList(r io.Reader, name string) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		entries = append(entries, Entry{Host: text, Source: fmt.Sprintf("%s:%d", name, line)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+var csvColumns = []string{"host", "rescan", "hidden", "poll_interval", "policy"}
+
+func parseCSV(r io.Reader, name string) ([]Entry, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	columns := csvColumns
+	entries := make([]Entry, 0)
+	for i := 0; ; i++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrInvalidInventory, name, err)
+		}
+		source := fmt.Sprintf("%s: row %d", name, i+1)
+
+		if i == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "host") {
+			columns = make([]string, len(record))
+			for j, column := range record {
+				columns[j] = strings.ToLower(strings.TrimSpace(column))
+				if err := setField(new(Entry), columns[j], ""); err != nil {
+					return nil, fmt.Errorf("%w: %s: %s", ErrInvalidInventory, source, err)
+				}
+			}
+			continue
+		}
+
+		e := Entry{Source: source}
+		for j, value := range record {
+			value = strings.TrimSpace(value)
+			if j >= len(columns) || value == "" {
+				continue
+			}
+			if err := setField(&e, columns[j], value); err != nil {
+				return nil, fmt.Errorf("%w: %s: %s", ErrInvalidInventory, source, err)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// setField set the field of the column to the value. An empty value only check that the column exist.
+func setField(e *Entry, column, value string) error {
+	if value == "" {
+		for _, c := range csvColumns {
+			if c == column {
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown column %q", column)
+	}
+	switch column {
+	case "host":
+		e.Host = value
+	case "rescan", "hidden":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false", column)
+		}
+		if column == "rescan" {
+			e.Rescan = &b
+		} else {
+			e.Hidden = &b
+		}
+	case "poll_interval":
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("poll_interval must be a duration, such as 10s")
+		}
+		e.PollInterval = d
+	case "policy":
+		e.Policy = value
+	default:
+		return fmt.Errorf("unknown column %q", column)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package inventory
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// zoneTypes are the record types whose owner name is a host.
+var zoneTypes = map[string]bool{
+	"A":     true,
+	"AAAA":  true,
+	"CNAME": true,
+}
+
+var zoneClasses = map[string]bool{
+	"IN": true,
+	"CH": true,
+	"HS": true,
+	"CS": true,
+}
+
+// parseZone extract the hosts of a zone file. Only the subset of the master file format needed to find the
+// owner names is parsed: comments, parentheses, the $ORIGIN and $TTL directives, relative names, @ and
+// omitted owner names.
+func parseZone(r io.Reader, name string) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	var origin, owner string
+	var buf strings.Builder
+	depth, start := 0, 0
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text, open := stripZoneComment(scanner.Text())
+		if depth == 0 {
+			start = line
+			buf.Reset()
+		} else {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(text)
+		depth += open
+		if depth > 0 {
+			continue
+		}
+		if depth < 0 {
+			return nil, fmt.Errorf("%w: %s:%d: unbalanced parentheses", ErrInvalidInventory, name, line)
+		}
+
+		record := buf.String()
+		source := fmt.Sprintf("%s:%d", name, start)
+		fields := strings.Fields(record)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "$ORIGIN":
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("%w: %s: $ORIGIN without name", ErrInvalidInventory, source)
+			}
+			o, err := absoluteName(fields[1], origin)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %s", ErrInvalidInventory, source, err)
+			}
+			origin = o
+			continue
+		case "$TTL":
+			continue
+		case "$INCLUDE", "$GENERATE":
+			return nil, fmt.Errorf("%w: %s: %s is not supported", ErrInvalidInventory, source, fields[0])
+		}
+
+		// A record starting with a blank reuse the owner of the previous record.
+		if !unicode.IsSpace(rune(record[0])) {
+			o, err := absoluteName(fields[0], origin)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %s", ErrInvalidInventory, source, err)
+			}
+			owner = o
+			fields = fields[1:]
+		}
+		if owner == "" {
+			return nil, fmt.Errorf("%w: %s: record without owner", ErrInvalidInventory, source)
+		}
+
+		typ := recordType(fields)
+		if !zoneTypes[typ] || strings.HasPrefix(owner, "*") {
+			continue
+		}
+		entries = append(entries, Entry{Host: owner, Source: source})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("%w: %s: unbalanced parentheses", ErrInvalidInventory, name)
+	}
+	return entries, nil
+}
+
+// stripZoneComment remove the comment of a line, and the parentheses, which only group lines. It returns the
+// number of opened minus closed parentheses.
+func stripZoneComment(line string) (string, int) {
+	var b strings.Builder
+	open := 0
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == ';':
+			return b.String(), open
+		case c == '(':
+			open++
+			c = ' '
+		case c == ')':
+			open--
+			c = ' '
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), open
+}
+
+// recordType return the type of a record, given its fields after the owner name. The TTL and class, both
+// optional, can come in any order before the type.
+func recordType(fields []string) string {
+	for _, f := range fields {
+		upper := strings.ToUpper(f)
+		if zoneClasses[upper] || isTTL(f) {
+			continue
+		}
+		return upper
+	}
+	return ""
+}
+
+// isTTL return true for a TTL such as 3600 or 1h30m.
+func isTTL(s string) bool {
+	if s == "" || !unicode.IsDigit(rune(s[0])) {
+		return false
+	}
+	for _, c := range strings.ToLower(s) {
+		if !unicode.IsDigit(c) && !strings.ContainsRune("smhdw", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// absoluteName return the name without trailing dot, relative to the origin unless it is absolute.
+func absoluteName(name, origin string) (string, error) {
+	switch {
+	case name == "@":
+		if origin == "" {
+			return "", fmt.Errorf("@ without $ORIGIN")
+		}
+		return origin, nil
+	case strings.HasSuffix(name, "."):
+		return strings.TrimSuffix(name, "."), nil
+	case origin == "":
+		return "", fmt.Errorf("relative name %s without $ORIGIN", name)
+	default:
+		return name + "." + origin, nil
+	}
+}
@@ -0,0 +1,68 @@
+package observatory
+
+import (
+	"context"
+	"github.com/tigerwill90/observatory/logging"
+	"github.com/tigerwill90/observatory/types"
+)
+
+type logAttrsKey struct{}
+
+// logAttrs hold the host and scan ID of the current call, attached to every record logged during the call.
+type logAttrs struct {
+	host   string
+	scanID types.ScanID
+}
+
+// withLogAttrs return a context carrying the host and scan ID for log records, if logging is enabled.
+func (c *Client) withLogAttrs(ctx context.Context, host string, scanID types.ScanID) context.Context {
+	if c.logger == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, logAttrsKey{}, &logAttrs{host: host, scanID: scanID})
+}
+
+// setLogScanID set the scan ID of the current call once it is known.
+func setLogScanID(ctx context.Context, scanID types.ScanID) {
+	if attrs, ok := ctx.Value(logAttrsKey{}).(*logAttrs); ok && attrs.scanID == 0 {
+		attrs.scanID = scanID
+	}
+}
+
+// copyLogAttrs return a context carrying a copy of the log attributes of ctx, for work that may outlive the call.
+func copyLogAttrs(ctx context.Context) context.Context {
+	if attrs, ok := ctx.Value(logAttrsKey{}).(*logAttrs); ok {
+		attrs := *attrs
+		return context.WithValue(ctx, logAttrsKey{}, &attrs)
+	}
+	return ctx
+}
+
+// logEnabled report whether a record at this level would be logged. Callers check it before
+// building the record fields, so a client without logger does not pay for them.
+func (c *Client) logEnabled(level logging.Level) bool {
+	return c.logger != nil && level >= c.logLevel
+}
+
+func (c *Client) log(ctx context.Context, level logging.Level, msg string, fields ...logging.Field) {
+	if !c.logEnabled(level) {
+		return
+	}
+
+	if attrs, ok := ctx.Value(logAttrsKey{}).(*logAttrs); ok {
+		if attrs.host != "" {
+			fields = append(fields, logging.String("host", attrs.host))
+		}
+		if attrs.scanID != 0 {
+			fields = append(fields, logging.Int("scan_id", int(attrs.scanID)))
+		}
+	}
+	c.logger.Log(ctx, level, msg, fields...)
+}
+
+// logFinished log the outcome of a finished assessment.
+func (c *Client) logFinished(ctx context.Context, result *types.ScannerResult) {
+	if result.State == Finished && c.logEnabled(logging.LevelInfo) {
+		c.log(ctx, logging.LevelInfo, "assessment finished", logging.String("grade", result.Grade), logging.Int("score", result.Score))
+	}
+}
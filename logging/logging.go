@@ -0,0 +1,164 @@
+// Package logging define the structured logger used by the HTTP Observatory client to report what it does, such
+// as requests sent, responses received, polling iterations and cache hits. Any logging library can be plugged in
+// by implementing Logger, and NewTextLogger and NewJSONLogger provide ready to use implementations.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log record.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String return the upper case name of the level.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+	}
+}
+
+// ParseLevel return the level matching a case-insensitive name, such as "debug" or "WARN".
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToUpper(name) {
+	case "DEBUG":
+		return LevelDebug, nil
+	case "INFO":
+		return LevelInfo, nil
+	case "WARN", "WARNING":
+		return LevelWarn, nil
+	case "ERROR":
+		return LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+}
+
+// Field is a key-value pair attached to a log record.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// String return a string field.
+func String(key, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Int return an int field.
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Duration return a duration field.
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Error return a field holding the error message under the "error" key.
+func Error(err error) Field {
+	return Field{Key: "error", Value: err.Error()}
+}
+
+// Logger record structured log events. Implementations must be safe for concurrent use.
+type Logger interface {
+	Log(ctx context.Context, level Level, msg string, fields ...Field)
+}
+
+// LoggerFunc is an adapter to use an ordinary function as a Logger.
+type LoggerFunc func(ctx context.Context, level Level, msg string, fields ...Field)
+
+// Log call f(ctx, level, msg, fields...).
+func (f LoggerFunc) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	f(ctx, level, msg, fields...)
+}
+
+type textLogger struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+// NewTextLogger return a Logger that write each record on a single line of logfmt style key=value pairs.
+func NewTextLogger(w io.Writer) Logger {
+	return &textLogger{w: w, now: time.Now}
+}
+
+func (l *textLogger) Log(_ context.Context, level Level, msg string, fields ...Field) {
+	var sb strings.Builder
+	sb.WriteString("time=")
+	sb.WriteString(l.now().Format(time.RFC3339Nano))
+	sb.WriteString(" level=")
+	sb.WriteString(level.String())
+	sb.WriteString(" msg=")
+	sb.WriteString(quote(msg))
+	for _, f := range fields {
+		sb.WriteByte(' ')
+		sb.WriteString(f.Key)
+		sb.WriteByte('=')
+		sb.WriteString(quote(fmt.Sprint(f.Value)))
+	}
+	sb.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = io.WriteString(l.w, sb.String())
+}
+
+type jsonLogger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	now func() time.Time
+}
+
+// NewJSONLogger return a Logger that write each record as a JSON object on a single line.
+func NewJSONLogger(w io.Writer) Logger {
+	return &jsonLogger{enc: json.NewEncoder(w), now: time.Now}
+}
+
+func (l *jsonLogger) Log(_ context.Context, level Level, msg string, fields ...Field) {
+	record := make(map[string]interface{}, len(fields)+3)
+	for _, f := range fields {
+		if d, ok := f.Value.(time.Duration); ok {
+			record[f.Key] = d.String()
+			continue
+		}
+		record[f.Key] = f.Value
+	}
+	record["time"] = l.now().Format(time.RFC3339Nano)
+	record["level"] = level.String()
+	record["msg"] = msg
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_ = l.enc.Encode(record)
+}
+
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func fixedNow() time.Time {
+	return time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+}
+
+func TestTextLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := NewTextLogger(buf).(*textLogger)
+	l.now = fixedNow
+	l.Log(context.Background(), LevelWarn, "request failed", String("host", "observatory.mozilla.org"), Int("status", 502), Duration("duration", 1500*time.Millisecond), Error(errors.New("bad gateway")))
+	assert.Equal(t, "time=2021-03-01T12:00:00Z level=WARN msg=\"request failed\" host=observatory.mozilla.org status=502 duration=1.5s error=\"bad gateway\"\n", buf.String())
+}
+
+func TestJSONLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := NewJSONLogger(buf).(*jsonLogger)
+	l.now = fixedNow
+	l.Log(context.Background(), LevelDebug, "response received", Int("status", 200), Duration("duration", time.Second))
+	assert.JSONEq(t, `{"time":"2021-03-01T12:00:00Z","level":"DEBUG","msg":"response received","status":200,"duration":"1s"}`, buf.String())
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("warning")
+	require.Nil(t, err)
+	assert.Equal(t, LevelWarn, level)
+	level, err = ParseLevel("DEBUG")
+	require.Nil(t, err)
+	assert.Equal(t, LevelDebug, level)
+	_, err = ParseLevel("verbose")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,136 @@
+// Package middleware define the request pipeline of the HTTP Observatory client. Every api call go through a chain
+// of Middleware, registered with option.WithMiddleware, before reaching the Doer that build the HTTP request, send
+// it and decode the response. A middleware see the logical api call, such as observatory.ApiCallAnalyze, and the
+// decoded result, which make it suitable to add headers, audit requests or inject failures in tests.
+package middleware
+
+import (
+	"context"
+	"github.com/tigerwill90/observatory/logging"
+	"github.com/tigerwill90/observatory/telemetry"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Call describe an api call going through the middleware chain.
+type Call struct {
+	// api call name, such as "analyze" or "getScanResults"
+	ApiCall string
+	// HTTP method, GET or POST
+	Method string
+	// query string parameters
+	Query url.Values
+	// form data sent in the body of POST requests
+	Form url.Values
+	// headers added to the HTTP request
+	Header http.Header
+	// pointer to the value the response is decoded into. It hold the decoded result once the
+	// next Doer return without error. A middleware that does not call the next Doer may fill it.
+	Result interface{}
+}
+
+// Response describe the HTTP response of an api call.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+}
+
+// Doer execute an api call. The response is returned along with the error when the api answered with
+// an unexpected status code, and is nil if no response was received.
+type Doer interface {
+	Do(ctx context.Context, call *Call) (*Response, error)
+}
+
+// DoerFunc is an adapter to use an ordinary function as a Doer.
+type DoerFunc func(ctx context.Context, call *Call) (*Response, error)
+
+// Do call f(ctx, call).
+func (f DoerFunc) Do(ctx context.Context, call *Call) (*Response, error) {
+	return f(ctx, call)
+}
+
+// Middleware wrap a Doer with additional behavior.
+type Middleware func(next Doer) Doer
+
+// Chain return a Doer that run the middlewares in order, the first one being the outermost, before calling d.
+func Chain(d Doer, mws ...Middleware) Doer {
+	for i := len(mws) - 1; i >= 0; i-- {
+		d = mws[i](d)
+	}
+	return d
+}
+
+// Headers return a middleware that add the headers to every request, e.g. to authenticate against a proxy.
+func Headers(h http.Header) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(ctx context.Context, call *Call) (*Response, error) {
+			if call.Header == nil {
+				call.Header = make(http.Header, len(h))
+			}
+			for key, values := range h {
+				for _, value := range values {
+					call.Header.Add(key, value)
+				}
+			}
+			return next.Do(ctx, call)
+		})
+	}
+}
+
+// Logging return a middleware that log each request at debug level, and its outcome at debug level, or
+// at warn level if it failed. Records below the minimum level are discarded before being built.
+func Logging(l logging.Logger, level logging.Level) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(ctx context.Context, call *Call) (*Response, error) {
+			if level <= logging.LevelDebug {
+				l.Log(ctx, logging.LevelDebug, "request sent", logging.String("api_call", call.ApiCall), logging.String("method", call.Method))
+			}
+
+			start := time.Now()
+			resp, err := next.Do(ctx, call)
+			duration := time.Since(start)
+
+			if err != nil && level <= logging.LevelWarn {
+				l.Log(
+					ctx,
+					logging.LevelWarn,
+					"request failed",
+					logging.String("api_call", call.ApiCall),
+					logging.Int("status", statusCode(resp)),
+					logging.Duration("duration", duration),
+					logging.Error(err),
+				)
+			} else if err == nil && level <= logging.LevelDebug {
+				l.Log(
+					ctx,
+					logging.LevelDebug,
+					"response received",
+					logging.String("api_call", call.ApiCall),
+					logging.Int("status", statusCode(resp)),
+					logging.Duration("duration", duration),
+				)
+			}
+			return resp, err
+		})
+	}
+}
+
+// Metrics return a middleware that report each request to Meter.RecordRequest.
+func Metrics(m telemetry.Meter) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(ctx context.Context, call *Call) (*Response, error) {
+			start := time.Now()
+			resp, err := next.Do(ctx, call)
+			m.RecordRequest(ctx, call.ApiCall, call.Method, statusCode(resp), time.Since(start), err)
+			return resp, err
+		})
+	}
+}
+
+func statusCode(resp *Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
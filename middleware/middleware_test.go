@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory/logging"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type recordingMeter struct {
+	apiCall    string
+	method     string
+	statusCode int
+	err        error
+}
+
+func (m *recordingMeter) RecordRequest(_ context.Context, apiCall, method string, statusCode int, _ time.Duration, err error) {
+	m.apiCall, m.method, m.statusCode, m.err = apiCall, method, statusCode, err
+}
+
+func (m *recordingMeter) RecordScan(context.Context, string, string, time.Duration, error) {}
+
+func TestChain(t *testing.T) {
+	order := make([]string, 0)
+	named := func(name string) Middleware {
+		return func(next Doer) Doer {
+			return DoerFunc(func(ctx context.Context, call *Call) (*Response, error) {
+				order = append(order, name)
+				return next.Do(ctx, call)
+			})
+		}
+	}
+	d := Chain(DoerFunc(func(context.Context, *Call) (*Response, error) {
+		order = append(order, "doer")
+		return &Response{StatusCode: http.StatusOK}, nil
+	}), named("first"), named("second"))
+
+	_, err := d.Do(context.Background(), &Call{})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"first", "second", "doer"}, order)
+}
+
+func TestHeaders(t *testing.T) {
+	d := Chain(DoerFunc(func(_ context.Context, call *Call) (*Response, error) {
+		assert.Equal(t, "Bearer token", call.Header.Get("Authorization"))
+		assert.Equal(t, []string{"a", "b"}, call.Header.Values("X-Team"))
+		return &Response{StatusCode: http.StatusOK}, nil
+	}), Headers(http.Header{"Authorization": {"Bearer token"}, "X-Team": {"a", "b"}}))
+
+	_, err := d.Do(context.Background(), &Call{})
+	require.Nil(t, err)
+}
+
+func TestLogging(t *testing.T) {
+	failure := errors.New("http request failed: 502 Bad Gateway")
+	cases := []struct {
+		name  string
+		level logging.Level
+		err   error
+		want  []string
+	}{
+		{
+			name:  "debug success",
+			level: logging.LevelDebug,
+			want:  []string{"DEBUG request sent", "DEBUG response received"},
+		},
+		{
+			name:  "debug failure",
+			level: logging.LevelDebug,
+			err:   failure,
+			want:  []string{"DEBUG request sent", "WARN request failed"},
+		},
+		{
+			name:  "info success",
+			level: logging.LevelInfo,
+			want:  []string{},
+		},
+		{
+			name:  "info failure",
+			level: logging.LevelInfo,
+			err:   failure,
+			want:  []string{"WARN request failed"},
+		},
+		{
+			name:  "error failure",
+			level: logging.LevelError,
+			err:   failure,
+			want:  []string{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			records := make([]string, 0)
+			l := logging.LoggerFunc(func(_ context.Context, level logging.Level, msg string, _ ...logging.Field) {
+				records = append(records, level.String()+" "+msg)
+			})
+			d := Chain(DoerFunc(func(context.Context, *Call) (*Response, error) {
+				return &Response{StatusCode: http.StatusBadGateway}, tc.err
+			}), Logging(l, tc.level))
+
+			_, err := d.Do(context.Background(), &Call{ApiCall: "analyze", Method: "GET"})
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.want, records)
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := new(recordingMeter)
+	d := Chain(DoerFunc(func(context.Context, *Call) (*Response, error) {
+		return nil, context.DeadlineExceeded
+	}), Metrics(m))
+
+	_, err := d.Do(context.Background(), &Call{ApiCall: "getScanResults", Method: "GET"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, "getScanResults", m.apiCall)
+	assert.Equal(t, "GET", m.method)
+	assert.Equal(t, 0, m.statusCode)
+	assert.ErrorIs(t, m.err, context.DeadlineExceeded)
+}
@@ -0,0 +1,215 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tigerwill90/observatory/baseline"
+	"github.com/tigerwill90/observatory/inventory"
+	"github.com/tigerwill90/observatory/logging"
+	"github.com/tigerwill90/observatory/notify"
+	"github.com/tigerwill90/observatory/policy"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+const (
+	DefaultInterval     = 24 * time.Hour
+	DefaultJitter       = 0.1
+	DefaultConcurrency  = 4
+	DefaultPollInterval = 10 * time.Second
+)
+
+var ErrInvalidConfig = errors.New("invalid monitor config")
+
+// Config configure which hosts are monitored and how often. It can be loaded from a YAML or JSON file
+// with LoadConfig.
+type Config struct {
+	// delay between two scans of a host, default to DefaultInterval
+	Interval time.Duration `yaml:"interval"`
+	// fraction of the interval by which each delay is randomly shortened or lengthened, so scans of
+	// different hosts spread over time, default to DefaultJitter
+	Jitter *float64 `yaml:"jitter"`
+	// maximum number of hosts scanned at the same time, default to DefaultConcurrency
+	Concurrency int `yaml:"concurrency"`
+	// delay between two retrievals of an ongoing scan, default to DefaultPollInterval
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// ask for a new scan instead of reusing a scan made in the previous 24 hours, unless overridden per host
+	Rescan bool `yaml:"rescan"`
+	// hide the scans from the public results, unless overridden per host
+	Hidden bool `yaml:"hidden"`
+	// monitored hosts
+	Hosts []HostConfig `yaml:"hosts"`
+	// inventory files whose hosts are monitored in addition to Hosts, see the inventory package for the formats.
+	// A host of an inventory that is also in Hosts is configured by Hosts.
+	Inventory []string `yaml:"inventory"`
+	// accepted test failures, which do not raise events until their waiver expire
+	Baseline *baseline.Baseline `yaml:"baseline"`
+	// policy evaluated on each scan, a rule that start to fail raise a policy violation
+	Policy *policy.Policy `yaml:"policy"`
+	// notifiers created in addition to the ones given to New
+	Notifications notify.Config `yaml:"notifications"`
+	// logger for scan errors and notification failures, nothing is logged if nil
+	Logger logging.Logger `yaml:"-"`
+}
+
+// HostConfig configure the monitoring of a host. Zero values inherit from Config.
+type HostConfig struct {
+	Host         string        `yaml:"host"`
+	Interval     time.Duration `yaml:"interval"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	Rescan       *bool         `yaml:"rescan"`
+	Hidden       *bool         `yaml:"hidden"`
+	// path of a policy file evaluated instead of the policy of the config
+	Policy string `yaml:"policy"`
+	policy *policy.Policy
+}
+
+// LoadConfig read the config file at path. Since JSON is a subset of YAML, the file can be either. Relative
+// inventory and policy paths are resolved against the directory of the config file.
+func LoadConfig(path string) (*Config, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read monitor config: %w", err)
+	}
+	cfg := new(Config)
+	if err := yaml.Unmarshal(buf, cfg); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	dir := filepath.Dir(path)
+	for i, p := range cfg.Inventory {
+		if !filepath.IsAbs(p) {
+			cfg.Inventory[i] = filepath.Join(dir, p)
+		}
+	}
+	for i, hc := range cfg.Hosts {
+		if hc.Policy != "" && !filepath.IsAbs(hc.Policy) {
+			cfg.Hosts[i].Policy = filepath.Join(dir, hc.Policy)
+		}
+	}
+	return cfg, nil
+}
+
+// inventoryHosts return the hosts of the inventory files that are not configured by Hosts, the configured
+// hosts being compared once normalized by normalize.
+func (c *Config) inventoryHosts(normalize func(host string) (string, error)) ([]HostConfig, error) {
+	if len(c.Inventory) == 0 {
+		return nil, nil
+	}
+	inv, err := inventory.Load(c.Inventory...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	configured := make(map[string]bool, len(c.Hosts))
+	for _, hc := range c.Hosts {
+		host, err := normalize(hc.Host)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+		configured[host] = true
+	}
+	hosts := make([]HostConfig, 0, inv.Len())
+	for _, e := range inv.Entries() {
+		if configured[e.Host] {
+			continue
+		}
+		hosts = append(hosts, HostConfig{
+			Host:         e.Host,
+			PollInterval: e.PollInterval,
+			Rescan:       e.Rescan,
+			Hidden:       e.Hidden,
+			Policy:       e.Policy,
+		})
+	}
+	return hosts, nil
+}
+
+// host return the effective config of a host.
+func (c *Config) host(hc HostConfig) HostConfig {
+	if hc.Interval <= 0 {
+		hc.Interval = c.Interval
+	}
+	if hc.PollInterval <= 0 {
+		hc.PollInterval = c.PollInterval
+	}
+	if hc.Rescan == nil {
+		rescan := c.Rescan
+		hc.Rescan = &rescan
+	}
+	if hc.Hidden == nil {
+		hidden := c.Hidden
+		hc.Hidden = &hidden
+	}
+	return hc
+}
+
+// withDefaults return the config with its defaults applied and its hosts normalized by normalize, which is
+// Client.NormalizeHost of the client scanning them.
+func (c Config) withDefaults(normalize func(host string) (string, error)) (Config, error) {
+	fromInventory, err := c.inventoryHosts(normalize)
+	if err != nil {
+		return c, err
+	}
+	c.Hosts = append(append(make([]HostConfig, 0, len(c.Hosts)+len(fromInventory)), c.Hosts...), fromInventory...)
+	if len(c.Hosts) == 0 {
+		return c, fmt.Errorf("%w: no host to monitor", ErrInvalidConfig)
+	}
+	if c.Interval <= 0 {
+		c.Interval = DefaultInterval
+	}
+	if c.Jitter == nil {
+		jitter := DefaultJitter
+		c.Jitter = &jitter
+	}
+	if *c.Jitter < 0 || *c.Jitter >= 1 {
+		return c, fmt.Errorf("%w: jitter must be within [0, 1)", ErrInvalidConfig)
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = DefaultConcurrency
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = DefaultPollInterval
+	}
+	// the policy and baseline are evaluated concurrently by the hosts, so they must be compiled once before
+	if c.Policy != nil {
+		if err := c.Policy.Validate(); err != nil {
+			return c, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+	}
+	if c.Baseline != nil {
+		if err := c.Baseline.Validate(); err != nil {
+			return c, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+	}
+
+	seen := make(map[string]bool, len(c.Hosts))
+	policies := make(map[string]*policy.Policy)
+	hosts := make([]HostConfig, 0, len(c.Hosts))
+	for _, hc := range c.Hosts {
+		host, err := normalize(hc.Host)
+		if err != nil {
+			return c, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+		hc.Host = host
+		if seen[hc.Host] {
+			return c, fmt.Errorf("%w: duplicate host %s", ErrInvalidConfig, hc.Host)
+		}
+		seen[hc.Host] = true
+		if hc.Policy != "" {
+			p, ok := policies[hc.Policy]
+			if !ok {
+				if p, err = policy.Load(hc.Policy); err != nil {
+					return c, fmt.Errorf("%w: %s: %s", ErrInvalidConfig, hc.Host, err)
+				}
+				policies[hc.Policy] = p
+			}
+			hc.policy = p
+		}
+		hosts = append(hosts, c.host(hc))
+	}
+	c.Hosts = hosts
+	return c, nil
+}
@@ -0,0 +1,311 @@
+// Package monitor continuously scan a list of hosts on a schedule, persist every result in a store, and notify
+// when the security posture of a host degrade: a lower grade, tests that no longer pass, policy rules that
+// start to fail, or a scan failed or aborted by HTTP Observatory. Failures accepted by a baseline are
+// reported as waived until their waiver expire. A Monitor is an http.Handler serving the status of each host.
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/baseline"
+	"github.com/tigerwill90/observatory/logging"
+	"github.com/tigerwill90/observatory/notify"
+	"github.com/tigerwill90/observatory/option"
+	"github.com/tigerwill90/observatory/policy"
+	"github.com/tigerwill90/observatory/store"
+	"github.com/tigerwill90/observatory/types"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Monitor scan the configured hosts on schedule.
+type Monitor struct {
+	client    *observatory.Client
+	store     store.Store
+	recorder  *store.Recorder
+	cfg       Config
+	notifiers []notify.Notifier
+	sem       chan struct{}
+	mu        sync.RWMutex
+	hosts     map[string]*HostStatus
+	randMu    sync.Mutex
+	rand      *rand.Rand
+	now       func() time.Time
+}
+
+// New return a Monitor that scan the configured hosts with c, save the results in s and deliver the
+// events to every notifier, including the ones of the notifications config.
+func New(c *observatory.Client, s store.Store, cfg Config, notifiers ...notify.Notifier) (*Monitor, error) {
+	cfg, err := cfg.withDefaults(c.NormalizeHost)
+	if err != nil {
+		return nil, err
+	}
+	configured, err := cfg.Notifications.Notifiers()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+	notifiers = append(configured, notifiers...)
+
+	hosts := make(map[string]*HostStatus, len(cfg.Hosts))
+	for _, hc := range cfg.Hosts {
+		hosts[hc.Host] = &HostStatus{Host: hc.Host, Interval: hc.Interval.String()}
+	}
+	return &Monitor{
+		client:    c,
+		store:     s,
+		recorder:  store.NewRecorder(c, s),
+		cfg:       cfg,
+		notifiers: notifiers,
+		sem:       make(chan struct{}, cfg.Concurrency),
+		hosts:     hosts,
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		now:       time.Now,
+	}, nil
+}
+
+// Run restore the last result of each host from the store, then scan every host at its interval until
+// the context is canceled. The first scan of each host is randomly delayed by up to the jitter fraction
+// of its interval.
+func (m *Monitor) Run(ctx context.Context) error {
+	for _, hc := range m.cfg.Hosts {
+		prev, err := m.latest(ctx, hc.Host)
+		if err != nil {
+			return err
+		}
+		if prev != nil {
+			b, p := m.evaluate(hc.Host, &types.Scan{Result: prev.Result, Tests: prev.Tests}, m.now())
+			m.update(hc.Host, func(st *HostStatus) {
+				st.Result = prev.Result
+				st.Baseline = b
+				st.Policy = p
+			})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, hc := range m.cfg.Hosts {
+		wg.Add(1)
+		go func(hc HostConfig) {
+			defer wg.Done()
+			m.schedule(ctx, hc)
+		}(hc)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (m *Monitor) schedule(ctx context.Context, hc HostConfig) {
+	delay := time.Duration(m.random() * *m.cfg.Jitter * float64(hc.Interval))
+	for {
+		m.update(hc.Host, func(st *HostStatus) {
+			st.NextScan = m.now().Add(delay)
+		})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case m.sem <- struct{}{}:
+		}
+		_, err := m.Scan(ctx, hc.Host)
+		<-m.sem
+		if err != nil && ctx.Err() == nil {
+			m.log(ctx, logging.LevelError, "scan failed", logging.String("host", hc.Host), logging.Error(err))
+		}
+
+		jitter := (2*m.random() - 1) * *m.cfg.Jitter
+		delay = time.Duration((1 + jitter) * float64(hc.Interval))
+	}
+}
+
+// Scan scan a monitored host immediately, save the result, and compare it with the previous scan of the
+// host. It returns the event delivered to the notifiers, if any. A scan failed or aborted by HTTP Observatory
+// raise an event rather than an error.
+func (m *Monitor) Scan(ctx context.Context, host string) (*notify.Event, error) {
+	host, err := m.client.NormalizeHost(host)
+	if err != nil {
+		return nil, err
+	}
+	hc, ok := m.hostConfig(host)
+	if !ok {
+		return nil, fmt.Errorf("host %s is not monitored", host)
+	}
+
+	prev, err := m.latest(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	rec, err := m.recorder.Analyze(
+		ctx,
+		host,
+		option.WaitFinished(true, hc.PollInterval),
+		option.ForceRescan(*hc.Rescan),
+		option.HideResult(*hc.Hidden),
+	)
+	now := m.now()
+	if err != nil {
+		if !errors.Is(err, observatory.ErrScannerFailed) && !errors.Is(err, observatory.ErrScannerAborted) {
+			m.update(host, func(st *HostStatus) {
+				st.LastScan = now
+				st.LastError = err.Error()
+				st.Errors++
+			})
+			return nil, err
+		}
+
+		var old *types.ScannerResult
+		if prev != nil {
+			old = prev.Result
+		}
+		event := notify.ScanFailed(host, old, err)
+		event.Time = now
+		m.update(host, func(st *HostStatus) {
+			st.LastScan = now
+			st.LastError = err.Error()
+			st.Errors++
+		})
+		m.notify(ctx, event)
+		return event, nil
+	}
+
+	scan := &types.Scan{Result: rec.Result, Tests: rec.Tests}
+	var old *types.Scan
+	var oldBaseline *baseline.Report
+	var oldPolicy *policy.Report
+	if prev != nil {
+		old = &types.Scan{Result: prev.Result, Tests: prev.Tests}
+		// The reports of the previous evaluation, rather than a new evaluation of the previous scan, allow to
+		// detect waivers that expired since.
+		m.mu.RLock()
+		oldBaseline, oldPolicy = m.hosts[host].Baseline, m.hosts[host].Policy
+		m.mu.RUnlock()
+		if oldBaseline == nil && oldPolicy == nil {
+			oldBaseline, oldPolicy = m.evaluate(host, old, now)
+		}
+	}
+	newBaseline, newPolicy := m.evaluate(host, scan, now)
+
+	event := notify.CompareWithBaseline(host, old, scan, oldBaseline, newBaseline)
+	if violation := notify.ComparePolicy(host, old, scan, oldPolicy, newPolicy); violation != nil {
+		if event == nil {
+			event = violation
+		} else {
+			event.Triggers = append(event.Triggers, notify.TriggerPolicyViolation)
+			event.Violations = violation.Violations
+		}
+	}
+	m.update(host, func(st *HostStatus) {
+		st.LastScan = now
+		st.LastError = ""
+		st.Result = rec.Result
+		st.Baseline = newBaseline
+		st.Policy = newPolicy
+		st.Scans++
+	})
+	if event != nil {
+		event.Time = now
+		m.notify(ctx, event)
+	}
+	return event, nil
+}
+
+// evaluate return the baseline and policy reports of a scan, nil if the monitor has no baseline or the host no
+// policy. Policy rules about a waived test are waived as well.
+func (m *Monitor) evaluate(host string, scan *types.Scan, now time.Time) (*baseline.Report, *policy.Report) {
+	var b *baseline.Report
+	if m.cfg.Baseline != nil {
+		b = m.cfg.Baseline.Evaluate(host, scan.Tests, now)
+	}
+	hostPolicy := m.cfg.Policy
+	if hc, ok := m.hostConfig(host); ok && hc.policy != nil {
+		hostPolicy = hc.policy
+	}
+	var p *policy.Report
+	if hostPolicy != nil {
+		p = hostPolicy.Evaluate(host, scan.Result, scan.Tests)
+		p.Waive(b)
+	}
+	return b, p
+}
+
+// latest return the most recent record of a host, or nil if there is none.
+func (m *Monitor) latest(ctx context.Context, host string) (*store.Record, error) {
+	records, err := m.store.Query(ctx, store.Query{Host: host})
+	if err != nil {
+		return nil, fmt.Errorf("unable to load previous scan of %s: %w", host, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[len(records)-1], nil
+}
+
+func (m *Monitor) notify(ctx context.Context, event *notify.Event) {
+	for _, n := range m.notifiers {
+		err := n.Notify(ctx, event)
+		m.update(event.Host, func(st *HostStatus) {
+			st.LastEvent = event
+			if err != nil {
+				st.NotifyErrors++
+			} else {
+				st.Notifications++
+			}
+		})
+		if err != nil {
+			m.log(ctx, logging.LevelError, "notification failed", logging.String("host", event.Host), logging.Error(err))
+		}
+	}
+}
+
+func (m *Monitor) hostConfig(host string) (HostConfig, bool) {
+	for _, hc := range m.cfg.Hosts {
+		if hc.Host == host {
+			return hc, true
+		}
+	}
+	return HostConfig{}, false
+}
+
+func (m *Monitor) update(host string, f func(st *HostStatus)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f(m.hosts[host])
+}
+
+func (m *Monitor) random() float64 {
+	m.randMu.Lock()
+	defer m.randMu.Unlock()
+	return m.rand.Float64()
+}
+
+func (m *Monitor) log(ctx context.Context, level logging.Level, msg string, fields ...logging.Field) {
+	if m.cfg.Logger != nil {
+		m.cfg.Logger.Log(ctx, level, msg, fields...)
+	}
+}
+
+// Status return the status of every monitored host, ordered by host.
+func (m *Monitor) Status() []HostStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	statuses := make([]HostStatus, 0, len(m.hosts))
+	for _, st := range m.hosts {
+		statuses = append(statuses, *st)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Host < statuses[j].Host
+	})
+	return statuses
+}
@@ -0,0 +1,335 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/baseline"
+	"github.com/tigerwill90/observatory/hostname"
+	"github.com/tigerwill90/observatory/notify"
+	"github.com/tigerwill90/observatory/observatorytest"
+	"github.com/tigerwill90/observatory/option"
+	"github.com/tigerwill90/observatory/policy"
+	"github.com/tigerwill90/observatory/store"
+	"github.com/tigerwill90/observatory/types"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTests(xfo bool) *types.ScannerTestResult {
+	tests := new(types.ScannerTestResult)
+	tests.XContentTypeOptions.Result = "x-content-type-options-nosniff"
+	tests.XContentTypeOptions.Pass = true
+	tests.XFrameOptions.Result = "x-frame-options-sameorigin"
+	tests.XFrameOptions.Pass = true
+	if !xfo {
+		tests.XFrameOptions.Result = "x-frame-options-not-implemented"
+		tests.XFrameOptions.Pass = false
+		tests.XFrameOptions.ScoreModifier = -20
+	}
+	return tests
+}
+
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []*notify.Event
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, e *notify.Event) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, e)
+	return nil
+}
+
+func TestMonitorScan(t *testing.T) {
+	srv := observatorytest.NewServer()
+	defer srv.Close()
+	srv.AddHost(observatorytest.Host{Name: "observatory.mozilla.org", Tests: newTests(true)})
+	srv.AddHost(observatorytest.Host{Name: "failed.example.com", States: []string{observatory.Pending, observatory.Failed}})
+
+	s, err := store.NewFileStore(t.TempDir())
+	require.Nil(t, err)
+	n := new(recordingNotifier)
+	m, err := New(srv.NewClient(), s, Config{
+		PollInterval: time.Millisecond,
+		Rescan:       true,
+		Hosts:        []HostConfig{{Host: "observatory.mozilla.org"}, {Host: "failed.example.com"}},
+	}, n)
+	require.Nil(t, err)
+
+	ctx := context.Background()
+	event, err := m.Scan(ctx, "observatory.mozilla.org")
+	require.Nil(t, err)
+	assert.Nil(t, event)
+
+	srv.AddHost(observatorytest.Host{Name: "observatory.mozilla.org", Tests: newTests(false)})
+	event, err = m.Scan(ctx, "observatory.mozilla.org")
+	require.Nil(t, err)
+	require.NotNil(t, event)
+	assert.Equal(t, []notify.Trigger{notify.TriggerGradeDrop, notify.TriggerNewFailures}, event.Triggers)
+	assert.Equal(t, "A+", event.OldGrade)
+	assert.Equal(t, "B+", event.NewGrade)
+	assert.Equal(t, -20, event.ScoreDelta())
+	assert.Equal(t, []string{types.TestXFrameOptions}, event.NewFailures)
+	assert.Equal(t, []string{types.TestXFrameOptions}, event.FailingTests)
+
+	// The same failure does not raise a new event.
+	event, err = m.Scan(ctx, "observatory.mozilla.org")
+	require.Nil(t, err)
+	assert.Nil(t, event)
+
+	event, err = m.Scan(ctx, "failed.example.com")
+	require.Nil(t, err)
+	require.NotNil(t, event)
+	assert.True(t, event.Has(notify.TriggerScanFailed))
+	assert.Contains(t, event.Error, observatory.ErrScannerFailed.Error())
+
+	_, err = m.Scan(ctx, "unknown.example.com")
+	assert.NotNil(t, err)
+	assert.Len(t, n.events, 2)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hosts/observatory.mozilla.org", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	status := new(HostStatus)
+	require.Nil(t, json.NewDecoder(rec.Body).Decode(status))
+	assert.Equal(t, uint64(3), status.Scans)
+	assert.Equal(t, uint64(1), status.Notifications)
+	assert.Equal(t, "B+", status.Result.Grade)
+
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hosts", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	statuses := make(map[string][]HostStatus)
+	require.Nil(t, json.NewDecoder(rec.Body).Decode(&statuses))
+	require.Len(t, statuses["hosts"], 2)
+	assert.Equal(t, "failed.example.com", statuses["hosts"][0].Host)
+	assert.Equal(t, uint64(1), statuses["hosts"][0].Errors)
+
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hosts/unknown.example.com", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestMonitorPolicy(t *testing.T) {
+	srv := observatorytest.NewServer()
+	defer srv.Close()
+	srv.AddHost(observatorytest.Host{Name: "observatory.mozilla.org", Tests: newTests(true)})
+
+	p, err := policy.Parse([]byte("rules:\n  - name: x-frame-options\n    expr: x-frame-options.pass == true\n"))
+	require.Nil(t, err)
+	s, err := store.NewFileStore(t.TempDir())
+	require.Nil(t, err)
+	m, err := New(srv.NewClient(), s, Config{
+		PollInterval: time.Millisecond,
+		Rescan:       true,
+		Policy:       p,
+		Hosts:        []HostConfig{{Host: "observatory.mozilla.org"}},
+	})
+	require.Nil(t, err)
+
+	ctx := context.Background()
+	event, err := m.Scan(ctx, "observatory.mozilla.org")
+	require.Nil(t, err)
+	assert.Nil(t, event)
+	require.NotNil(t, m.Status()[0].Policy)
+	assert.True(t, m.Status()[0].Policy.Passed())
+
+	srv.AddHost(observatorytest.Host{Name: "observatory.mozilla.org", Tests: newTests(false)})
+	event, err = m.Scan(ctx, "observatory.mozilla.org")
+	require.Nil(t, err)
+	require.NotNil(t, event)
+	assert.Equal(t, []notify.Trigger{notify.TriggerGradeDrop, notify.TriggerNewFailures, notify.TriggerPolicyViolation}, event.Triggers)
+	assert.Equal(t, []string{"x-frame-options: x-frame-options.pass is false, want == true"}, event.Violations)
+	assert.False(t, m.Status()[0].Policy.Passed())
+}
+
+func TestMonitorBaseline(t *testing.T) {
+	srv := observatorytest.NewServer()
+	defer srv.Close()
+	srv.AddHost(observatorytest.Host{Name: "observatory.mozilla.org", Tests: newTests(false)})
+
+	b, err := baseline.Parse([]byte(`
+waivers:
+  - host: observatory.mozilla.org
+    test: x-frame-options
+    result: x-frame-options-not-implemented
+    expires: 2021-03-01
+    justification: legacy iframe integration
+  - host: "*.mozilla.org"
+    test: cookies
+    result: cookies-without-secure-flag
+    expires: 2021-03-01
+    justification: legacy session cookie
+`))
+	require.Nil(t, err)
+	s, err := store.NewFileStore(t.TempDir())
+	require.Nil(t, err)
+	m, err := New(srv.NewClient(), s, Config{
+		PollInterval: time.Millisecond,
+		Rescan:       true,
+		Baseline:     b,
+		Hosts:        []HostConfig{{Host: "observatory.mozilla.org"}},
+	})
+	require.Nil(t, err)
+	m.now = func() time.Time { return time.Date(2021, time.February, 1, 0, 0, 0, 0, time.UTC) }
+
+	ctx := context.Background()
+	_, err = m.Scan(ctx, "observatory.mozilla.org")
+	require.Nil(t, err)
+	event, err := m.Scan(ctx, "observatory.mozilla.org")
+	require.Nil(t, err)
+	assert.Nil(t, event)
+	status := m.Status()[0].Baseline
+	require.NotNil(t, status)
+	assert.Equal(t, baseline.StatusWaived, status.Status(types.TestXFrameOptions))
+	require.Len(t, status.Unused, 1)
+	assert.Equal(t, types.TestCookies, status.Unused[0].Test)
+
+	// The waiver expired, so the failure resurface.
+	m.now = func() time.Time { return time.Date(2021, time.March, 2, 0, 0, 0, 0, time.UTC) }
+	event, err = m.Scan(ctx, "observatory.mozilla.org")
+	require.Nil(t, err)
+	require.NotNil(t, event)
+	assert.Equal(t, []notify.Trigger{notify.TriggerNewFailures}, event.Triggers)
+	assert.Equal(t, []string{types.TestXFrameOptions}, event.NewFailures)
+	assert.Equal(t, baseline.StatusExpired, m.Status()[0].Baseline.Status(types.TestXFrameOptions))
+}
+
+func TestMonitorRun(t *testing.T) {
+	srv := observatorytest.NewServer()
+	defer srv.Close()
+	srv.AddHost(observatorytest.Host{Name: "observatory.mozilla.org", States: []string{observatory.Finished}})
+
+	s, err := store.NewFileStore(t.TempDir())
+	require.Nil(t, err)
+	m, err := New(srv.NewClient(), s, Config{
+		Interval: 20 * time.Millisecond,
+		Rescan:   true,
+		Hosts:    []HostConfig{{Host: "observatory.mozilla.org"}},
+	})
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, m.Run(ctx), context.DeadlineExceeded)
+
+	records, err := s.Query(context.Background(), store.Query{Host: "observatory.mozilla.org"})
+	require.Nil(t, err)
+	assert.GreaterOrEqual(t, len(records), 2)
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "monitor.yaml")
+	require.Nil(t, ioutil.WriteFile(path, []byte(`
+interval: 6h
+jitter: 0.2
+hidden: true
+hosts:
+  - host: observatory.mozilla.org
+  - host: developer.mozilla.org
+    interval: 1h
+    hidden: false
+baseline:
+  waivers:
+    - host: developer.mozilla.org
+      test: content-security-policy
+      result: csp-not-implemented
+      expires: 2021-06-30
+      justification: legacy pages
+policy:
+  rules:
+    - name: grade
+      expr: grade >= A-
+notifications:
+  webhooks:
+    - url: https://hooks.example.com/observatory
+      secret: s3cr3t
+`), 0o644))
+
+	cfg, err := LoadConfig(path)
+	require.Nil(t, err)
+	cfg2, err := cfg.withDefaults(hostname.Normalize)
+	require.Nil(t, err)
+	assert.Equal(t, 0.2, *cfg2.Jitter)
+	assert.Equal(t, 6*time.Hour, cfg2.Hosts[0].Interval)
+	assert.True(t, *cfg2.Hosts[0].Hidden)
+	assert.False(t, *cfg2.Hosts[0].Rescan)
+	assert.Equal(t, time.Hour, cfg2.Hosts[1].Interval)
+	assert.False(t, *cfg2.Hosts[1].Hidden)
+	require.Len(t, cfg2.Baseline.Waivers, 1)
+	require.Len(t, cfg2.Policy.Rules, 1)
+	assert.Equal(t, "grade", cfg2.Policy.Rules[0].Name)
+	require.Len(t, cfg2.Notifications.Webhooks, 1)
+	assert.Equal(t, "s3cr3t", cfg2.Notifications.Webhooks[0].Secret)
+
+	cases := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "no host", cfg: Config{}},
+		{name: "duplicate host", cfg: Config{Hosts: []HostConfig{{Host: "a.example.com"}, {Host: "a.example.com"}}}},
+		{name: "empty host", cfg: Config{Hosts: []HostConfig{{}}}},
+		{name: "invalid host", cfg: Config{Hosts: []HostConfig{{Host: "localhost"}}}},
+		{name: "invalid policy", cfg: Config{Hosts: []HostConfig{{Host: "a.example.com"}}, Policy: &policy.Policy{Rules: []*policy.Rule{{Expr: "grade >>> A"}}}}},
+		{name: "invalid baseline", cfg: Config{Hosts: []HostConfig{{Host: "a.example.com"}}, Baseline: &baseline.Baseline{Waivers: []*baseline.Waiver{{Host: "a.example.com"}}}}},
+		{name: "duplicate normalized host", cfg: Config{Hosts: []HostConfig{{Host: "A.example.com"}, {Host: "https://a.example.com/"}}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.cfg.withDefaults(hostname.Normalize)
+			assert.ErrorIs(t, err, ErrInvalidConfig)
+		})
+	}
+
+	// a client without host validation monitor the hosts as configured
+	c := observatory.NewClient(option.WithHostValidation(false))
+	cfg2, err = Config{Hosts: []HostConfig{{Host: "localhost"}}}.withDefaults(c.NormalizeHost)
+	require.Nil(t, err)
+	assert.Equal(t, "localhost", cfg2.Hosts[0].Host)
+}
+
+func TestLoadConfigInventory(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "strict.yaml"), []byte("rules:\n  - expr: grade >= A+\n"), 0o644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "hosts.csv"), []byte(
+		"host,rescan,poll_interval,policy\nhttps://Observatory.Mozilla.org/,true,1s,strict.yaml\nmdn.example.com,,2s,strict.yaml\n",
+	), 0o644))
+	path := filepath.Join(dir, "monitor.yaml")
+	require.Nil(t, ioutil.WriteFile(path, []byte(`
+poll_interval: 5s
+inventory:
+  - hosts.csv
+hosts:
+  - host: observatory.mozilla.org
+    hidden: true
+`), 0o644))
+
+	cfg, err := LoadConfig(path)
+	require.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "hosts.csv")}, cfg.Inventory)
+	cfg2, err := cfg.withDefaults(hostname.Normalize)
+	require.Nil(t, err)
+	require.Len(t, cfg2.Hosts, 2)
+	assert.Equal(t, "observatory.mozilla.org", cfg2.Hosts[0].Host)
+	assert.Equal(t, 5*time.Second, cfg2.Hosts[0].PollInterval)
+	assert.False(t, *cfg2.Hosts[0].Rescan)
+	assert.Nil(t, cfg2.Hosts[0].policy)
+	assert.Equal(t, "mdn.example.com", cfg2.Hosts[1].Host)
+	assert.Equal(t, 2*time.Second, cfg2.Hosts[1].PollInterval)
+	require.NotNil(t, cfg2.Hosts[1].policy)
+	assert.Len(t, cfg2.Hosts[1].policy.Rules, 1)
+
+	_, err = Config{Inventory: []string{filepath.Join(dir, "missing.csv")}}.withDefaults(hostname.Normalize)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = Config{Hosts: []HostConfig{{Host: "a.example.com", Policy: filepath.Join(dir, "missing.yaml")}}}.withDefaults(hostname.Normalize)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
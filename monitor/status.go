@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"encoding/json"
+	"github.com/tigerwill90/observatory/baseline"
+	"github.com/tigerwill90/observatory/notify"
+	"github.com/tigerwill90/observatory/policy"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HostStatus is the monitoring status of a host.
+type HostStatus struct {
+	Host string `json:"host"`
+	// delay between two scans
+	Interval string `json:"interval"`
+	// time of the last scan attempt
+	LastScan time.Time `json:"last_scan"`
+	// time of the next scheduled scan
+	NextScan time.Time `json:"next_scan"`
+	// result of the last successful scan, restored from the store on start
+	Result *types.ScannerResult `json:"result,omitempty"`
+	// evaluation of the baseline against the last successful scan, with the unused waivers of the host, if a
+	// baseline is configured
+	Baseline *baseline.Report `json:"baseline,omitempty"`
+	// evaluation of the policy against the last successful scan, if a policy is configured
+	Policy *policy.Report `json:"policy,omitempty"`
+	// error of the last scan attempt, if it failed
+	LastError string `json:"last_error,omitempty"`
+	// last event delivered to the notifiers
+	LastEvent *notify.Event `json:"last_event,omitempty"`
+	// number of successful scans since start
+	Scans uint64 `json:"scans"`
+	// number of failed scans since start
+	Errors uint64 `json:"errors"`
+	// number of notifications delivered since start
+	Notifications uint64 `json:"notifications"`
+	// number of notifications that could not be delivered since start
+	NotifyErrors uint64 `json:"notify_errors"`
+}
+
+var _ http.Handler = (*Monitor)(nil)
+
+// ServeHTTP serve the status API. GET /hosts return the status of every host, GET /hosts/{host} the
+// status of a single host, and GET /healthz answer 200 while the monitor is alive.
+func (m *Monitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, apiError("method not allowed"))
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/healthz":
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	case r.URL.Path == "/hosts":
+		writeJSON(w, http.StatusOK, map[string][]HostStatus{"hosts": m.Status()})
+	case strings.HasPrefix(r.URL.Path, "/hosts/"):
+		host := strings.TrimPrefix(r.URL.Path, "/hosts/")
+		m.mu.RLock()
+		st, ok := m.hosts[host]
+		var status HostStatus
+		if ok {
+			status = *st
+		}
+		m.mu.RUnlock()
+		if !ok {
+			writeJSON(w, http.StatusNotFound, apiError("host not monitored"))
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	default:
+		writeJSON(w, http.StatusNotFound, apiError("not found"))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func apiError(msg string) map[string]string {
+	return map[string]string{"error": msg}
+}
@@ -0,0 +1,43 @@
+package notify
+
+// Config list the notifiers to create, e.g. from the notifications section of a monitor config file.
+type Config struct {
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	Slack    []ChatConfig    `yaml:"slack"`
+	Teams    []ChatConfig    `yaml:"teams"`
+	Email    []EmailConfig   `yaml:"email"`
+}
+
+// Notifiers create every configured notifier.
+func (c Config) Notifiers() ([]Notifier, error) {
+	notifiers := make([]Notifier, 0, len(c.Webhooks)+len(c.Slack)+len(c.Teams)+len(c.Email))
+	for _, cfg := range c.Webhooks {
+		n, err := NewWebhook(cfg)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	for _, cfg := range c.Slack {
+		n, err := NewSlack(cfg)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	for _, cfg := range c.Teams {
+		n, err := NewTeams(cfg)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	for _, cfg := range c.Email {
+		n, err := NewEmail(cfg)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	return notifiers, nil
+}
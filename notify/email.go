@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// EmailConfig configure an email notifier.
+type EmailConfig struct {
+	// address of the SMTP server, as host:port
+	Addr string `yaml:"addr"`
+	// username for PLAIN authentication, no authentication if empty
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// sender address
+	From string `yaml:"from"`
+	// recipient addresses
+	To []string `yaml:"to"`
+	// subject template, default to DefaultSubjectTemplate
+	Subject string `yaml:"subject"`
+	// message template, default to DefaultTemplate
+	Template string `yaml:"template"`
+}
+
+// Email is a Notifier sending each event as a plain text email. The connection is upgraded with STARTTLS
+// whenever the server support it.
+type Email struct {
+	cfg     EmailConfig
+	subject *template.Template
+	tmpl    *template.Template
+}
+
+var _ Notifier = (*Email)(nil)
+
+// NewEmail return an Email notifier.
+func NewEmail(cfg EmailConfig) (*Email, error) {
+	if cfg.Addr == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, errors.New("email notifier require an address, a sender and at least one recipient")
+	}
+	subjectText := cfg.Subject
+	if subjectText == "" {
+		subjectText = DefaultSubjectTemplate
+	}
+	subject, err := ParseTemplate(subjectText)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := ParseTemplate(cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &Email{cfg: cfg, subject: subject, tmpl: tmpl}, nil
+}
+
+// Notify send the event.
+func (m *Email) Notify(ctx context.Context, e *Event) error {
+	subject, err := Render(m.subject, e)
+	if err != nil {
+		return err
+	}
+	body, err := Render(m.tmpl, e)
+	if err != nil {
+		return err
+	}
+	if err := m.send(ctx, m.message(subject, body)); err != nil {
+		return fmt.Errorf("notification failed: %w", err)
+	}
+	return nil
+}
+
+func (m *Email) send(ctx context.Context, msg []byte) error {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", m.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	host, _, err := net.SplitHostPort(m.cfg.Addr)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range m.cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (m *Email) message(subject, body string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.cfg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
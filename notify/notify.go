@@ -0,0 +1,317 @@
+// Package notify detect when the security posture of a host degrade and deliver the resulting events. Compare and
+// Check build an Event from two scans, and the Notifier implementations deliver it to a JSON webhook signed with
+// HMAC, Slack, Microsoft Teams or by email, with a message rendered from a text/template.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/baseline"
+	"github.com/tigerwill90/observatory/diff"
+	"github.com/tigerwill90/observatory/grader"
+	"github.com/tigerwill90/observatory/internal/option"
+	"github.com/tigerwill90/observatory/logging"
+	"github.com/tigerwill90/observatory/policy"
+	"github.com/tigerwill90/observatory/types"
+	"strings"
+	"time"
+)
+
+// Trigger is a reason to notify.
+type Trigger string
+
+const (
+	// TriggerGradeDrop is raised when the grade of a scan is worse than the grade of the previous scan.
+	TriggerGradeDrop Trigger = "grade_drop"
+	// TriggerNewFailures is raised when tests that passed in the previous scan fail.
+	TriggerNewFailures Trigger = "new_failures"
+	// TriggerScanFailed is raised when HTTP Observatory fail or abort a scan.
+	TriggerScanFailed Trigger = "scan_failed"
+	// TriggerPolicyViolation is raised when policy rules that passed in the previous scan fail.
+	TriggerPolicyViolation Trigger = "policy_violation"
+)
+
+// Event describe what changed between the previous and the latest scan of a host.
+type Event struct {
+	// reasons of the notification, in the order they were detected
+	Triggers []Trigger `json:"triggers"`
+	Host     string    `json:"host"`
+	Time     time.Time `json:"time"`
+	// unique ID of the latest scan, 0 if the scan failed before an ID was assigned
+	ScanID types.ScanID `json:"scan_id,omitempty"`
+	// unique ID of the previous scan, 0 for the first scan of the host
+	PreviousScanID types.ScanID `json:"previous_scan_id,omitempty"`
+	OldGrade       string       `json:"old_grade,omitempty"`
+	NewGrade       string       `json:"new_grade,omitempty"`
+	OldScore       int          `json:"old_score"`
+	NewScore       int          `json:"new_score"`
+	// tests that passed in the previous scan and fail in the latest one, ordered by name
+	NewFailures []string `json:"new_failures,omitempty"`
+	// tests that fail in the latest scan, ordered by name
+	FailingTests []string `json:"failing_tests,omitempty"`
+	// tests that fail in the latest scan but whose failure is waived by a baseline, ordered by name
+	Waived []string `json:"waived,omitempty"`
+	// policy rules that passed in the previous scan and fail in the latest one, with the reason they fail
+	Violations []string `json:"violations,omitempty"`
+	// error of a failed or aborted scan
+	Error string `json:"error,omitempty"`
+}
+
+// Has return true if the event was raised for the trigger.
+func (e *Event) Has(trigger Trigger) bool {
+	for _, t := range e.Triggers {
+		if t == trigger {
+			return true
+		}
+	}
+	return false
+}
+
+// ScoreDelta return the score difference between the latest and the previous scan.
+func (e *Event) ScoreDelta() int {
+	return e.NewScore - e.OldScore
+}
+
+// Compare return the event raised by the new scan of a host, or nil if its security posture did not degrade
+// since the old scan. The grade is compared in any case, while newly failing tests are only detected when the
+// test results of both scans are known.
+func Compare(host string, old, new *types.Scan) *Event {
+	return CompareWithBaseline(host, old, new, nil, nil)
+}
+
+// CompareWithBaseline is like Compare, but the failures waived in the baseline report of the new scan are listed
+// in Waived rather than failing. A test whose failure was waived in the old report and is no longer, typically
+// because its waiver expired, is a new failure even if the scan did not change. Nil reports waive nothing.
+func CompareWithBaseline(host string, old, new *types.Scan, oldReport, newReport *baseline.Report) *Event {
+	if old == nil {
+		return nil
+	}
+	sameScan := old.Result.ScanID == new.Result.ScanID
+
+	event := &Event{
+		Host:           host,
+		Time:           time.Now(),
+		ScanID:         new.Result.ScanID,
+		PreviousScanID: old.Result.ScanID,
+		OldGrade:       old.Result.Grade,
+		NewGrade:       new.Result.Grade,
+		OldScore:       old.Result.Score,
+		NewScore:       new.Result.Score,
+	}
+
+	oldRank, newRank := grader.Rank(old.Result.Grade), grader.Rank(new.Result.Grade)
+	if !sameScan && oldRank != 0 && newRank != 0 && newRank < oldRank {
+		event.Triggers = append(event.Triggers, TriggerGradeDrop)
+	}
+
+	if new.Tests != nil {
+		for _, test := range new.Tests.Summaries() {
+			if test.Result == "" || test.Pass {
+				continue
+			}
+			if newReport.Status(test.Name) == baseline.StatusWaived {
+				event.Waived = append(event.Waived, test.Name)
+				continue
+			}
+			event.FailingTests = append(event.FailingTests, test.Name)
+		}
+
+		failures := make(map[string]bool)
+		if old.Tests != nil && !sameScan {
+			for _, change := range diff.Diff(old.Tests, new.Tests).Tests {
+				if change.Old.Pass && !change.New.Pass && change.New.Result != "" {
+					failures[change.Name] = true
+				}
+			}
+		}
+		for _, o := range oldReport.Waived() {
+			failures[o.Name] = true
+		}
+		for _, name := range event.FailingTests {
+			if failures[name] {
+				event.NewFailures = append(event.NewFailures, name)
+			}
+		}
+		if len(event.NewFailures) > 0 {
+			event.Triggers = append(event.Triggers, TriggerNewFailures)
+		}
+	}
+
+	if len(event.Triggers) == 0 {
+		return nil
+	}
+	return event
+}
+
+// ComparePolicy return the event raised when policy rules that passed, or were waived, in the policy report of
+// the old scan of a host fail in the report of the new scan, or nil if there is none. If the old report is nil,
+// every failing rule is a violation.
+func ComparePolicy(host string, old, new *types.Scan, oldReport, newReport *policy.Report) *Event {
+	if newReport == nil {
+		return nil
+	}
+
+	failed := make(map[string]bool)
+	if oldReport != nil {
+		for _, o := range oldReport.Failures() {
+			failed[o.Rule] = true
+		}
+	}
+
+	event := &Event{
+		Host:   host,
+		Time:   time.Now(),
+		ScanID: new.Result.ScanID,
+	}
+	for _, o := range newReport.Failures() {
+		if !failed[o.Rule] {
+			event.Violations = append(event.Violations, o.Rule+": "+o.Explanation)
+		}
+	}
+	if len(event.Violations) == 0 {
+		return nil
+	}
+	event.Triggers = []Trigger{TriggerPolicyViolation}
+
+	if old != nil {
+		event.PreviousScanID = old.Result.ScanID
+		event.OldGrade, event.NewGrade = old.Result.Grade, new.Result.Grade
+		event.OldScore, event.NewScore = old.Result.Score, new.Result.Score
+	}
+	return event
+}
+
+// ScanFailed return the event raised when HTTP Observatory fail or abort the scan of a host. The old scan,
+// if known, provide the last known grade and score.
+func ScanFailed(host string, old *types.ScannerResult, err error) *Event {
+	event := &Event{
+		Triggers: []Trigger{TriggerScanFailed},
+		Host:     host,
+		Time:     time.Now(),
+		Error:    err.Error(),
+	}
+	if old != nil {
+		event.PreviousScanID = old.ScanID
+		event.OldGrade = old.Grade
+		event.OldScore = old.Score
+	}
+	return event
+}
+
+// Check analyze the host with Client.Analyze and compare the result with the previous scan found in the host
+// history. It returns the event raised, or nil if the security posture of the host did not degrade. Use
+// option.WaitFinished to wait for the scan to complete, since an unfinished scan is never compared.
+func Check(ctx context.Context, c *observatory.Client, host string, opts ...option.Option) (*Event, error) {
+	histories, err := c.GetScanHistory(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.Analyze(ctx, host, opts...)
+	if errors.Is(err, observatory.ErrScannerFailed) || errors.Is(err, observatory.ErrScannerAborted) {
+		var old *types.ScannerResult
+		if last := latest(histories, 0); last != nil {
+			old = &types.ScannerResult{ScanID: last.ScanId, Grade: last.Grade, Score: last.Score}
+		}
+		return ScanFailed(host, old, err), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.State != observatory.Finished {
+		return nil, nil
+	}
+
+	previous := latest(histories, result.ScanID)
+	if previous == nil {
+		return nil, nil
+	}
+
+	newTests, err := c.GetTestResults(ctx, result.ScanID)
+	if err != nil {
+		return nil, err
+	}
+	oldTests, err := c.GetTestResults(ctx, previous.ScanId)
+	if err != nil {
+		return nil, err
+	}
+	old := &types.Scan{
+		Result: &types.ScannerResult{ScanID: previous.ScanId, Grade: previous.Grade, Score: previous.Score},
+		Tests:  oldTests,
+	}
+	return Compare(host, old, &types.Scan{Result: result, Tests: newTests}), nil
+}
+
+// latest return the most recent scan of the host history other than the skipped one, or nil if there is none.
+// The history is not assumed to be ordered.
+func latest(histories []*types.ScannerHostHistory, skip types.ScanID) *types.ScannerHostHistory {
+	var last *types.ScannerHostHistory
+	for _, history := range histories {
+		if history.ScanId != skip && (last == nil || history.EndTimeUnixTimestamp > last.EndTimeUnixTimestamp) {
+			last = history
+		}
+	}
+	return last
+}
+
+// Notifier deliver events. Implementations must be safe for concurrent use.
+type Notifier interface {
+	Notify(ctx context.Context, e *Event) error
+}
+
+// NotifierFunc is an adapter to use an ordinary function as a Notifier.
+type NotifierFunc func(ctx context.Context, e *Event) error
+
+// Notify call f(ctx, e).
+func (f NotifierFunc) Notify(ctx context.Context, e *Event) error {
+	return f(ctx, e)
+}
+
+// Multi return a Notifier that deliver each event to every notifier, even if some of them fail.
+func Multi(notifiers ...Notifier) Notifier {
+	return NotifierFunc(func(ctx context.Context, e *Event) error {
+		failed := make([]string, 0)
+		for _, n := range notifiers {
+			if err := n.Notify(ctx, e); err != nil {
+				failed = append(failed, err.Error())
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("%d of %d notifications failed: %s", len(failed), len(notifiers), strings.Join(failed, "; "))
+		}
+		return nil
+	})
+}
+
+// NewLogNotifier return a Notifier that log each event at warn level.
+func NewLogNotifier(l logging.Logger) Notifier {
+	return NotifierFunc(func(ctx context.Context, e *Event) error {
+		triggers := make([]string, 0, len(e.Triggers))
+		for _, t := range e.Triggers {
+			triggers = append(triggers, string(t))
+		}
+		fields := []logging.Field{
+			logging.String("host", e.Host),
+			logging.String("triggers", strings.Join(triggers, ",")),
+		}
+		if e.ScanID != 0 {
+			fields = append(fields, logging.Int("scan_id", int(e.ScanID)))
+		}
+		if e.NewGrade != "" {
+			fields = append(fields, logging.String("old_grade", e.OldGrade), logging.String("new_grade", e.NewGrade), logging.Int("score_delta", e.ScoreDelta()))
+		}
+		if len(e.NewFailures) > 0 {
+			fields = append(fields, logging.String("new_failures", strings.Join(e.NewFailures, ",")))
+		}
+		if len(e.Violations) > 0 {
+			fields = append(fields, logging.String("violations", strings.Join(e.Violations, "; ")))
+		}
+		if e.Error != "" {
+			fields = append(fields, logging.String("error", e.Error))
+		}
+		l.Log(ctx, logging.LevelWarn, "security posture degraded", fields...)
+		return nil
+	})
+}
@@ -0,0 +1,297 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/baseline"
+	"github.com/tigerwill90/observatory/observatorytest"
+	"github.com/tigerwill90/observatory/option"
+	"github.com/tigerwill90/observatory/policy"
+	"github.com/tigerwill90/observatory/types"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTests(xfo bool) *types.ScannerTestResult {
+	tests := new(types.ScannerTestResult)
+	tests.XContentTypeOptions.Result = "x-content-type-options-nosniff"
+	tests.XContentTypeOptions.Pass = true
+	tests.XFrameOptions.Result = "x-frame-options-sameorigin"
+	tests.XFrameOptions.Pass = true
+	if !xfo {
+		tests.XFrameOptions.Result = "x-frame-options-not-implemented"
+		tests.XFrameOptions.Pass = false
+		tests.XFrameOptions.ScoreModifier = -20
+	}
+	return tests
+}
+
+func newEvent() *Event {
+	return &Event{
+		Triggers:       []Trigger{TriggerGradeDrop, TriggerNewFailures},
+		Host:           "observatory.mozilla.org",
+		Time:           time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC),
+		ScanID:         2,
+		PreviousScanID: 1,
+		OldGrade:       "A+",
+		NewGrade:       "B+",
+		OldScore:       100,
+		NewScore:       80,
+		NewFailures:    []string{types.TestXFrameOptions},
+		FailingTests:   []string{types.TestXFrameOptions},
+	}
+}
+
+func TestCompare(t *testing.T) {
+	old := &types.Scan{Result: &types.ScannerResult{ScanID: 1, Grade: "A+", Score: 100}, Tests: newTests(true)}
+	new := &types.Scan{Result: &types.ScannerResult{ScanID: 2, Grade: "B+", Score: 80}, Tests: newTests(false)}
+
+	event := Compare("observatory.mozilla.org", old, new)
+	require.NotNil(t, event)
+	event.Time = newEvent().Time
+	assert.Equal(t, newEvent(), event)
+
+	assert.Nil(t, Compare("observatory.mozilla.org", new, new))
+	assert.Nil(t, Compare("observatory.mozilla.org", new, old))
+	assert.Nil(t, Compare("observatory.mozilla.org", nil, new))
+}
+
+func TestCompareWithBaseline(t *testing.T) {
+	b, err := baseline.Parse([]byte(`
+waivers:
+  - host: observatory.mozilla.org
+    test: x-frame-options
+    result: x-frame-options-not-implemented
+    expires: 2021-03-01
+    justification: legacy iframe integration
+`))
+	require.Nil(t, err)
+	old := &types.Scan{Result: &types.ScannerResult{ScanID: 1, Grade: "A+", Score: 100}, Tests: newTests(true)}
+	new := &types.Scan{Result: &types.ScannerResult{ScanID: 2, Grade: "B+", Score: 80}, Tests: newTests(false)}
+
+	waived := b.Evaluate("observatory.mozilla.org", new.Tests, time.Date(2021, time.February, 1, 0, 0, 0, 0, time.UTC))
+	event := CompareWithBaseline("observatory.mozilla.org", old, new, nil, waived)
+	require.NotNil(t, event)
+	assert.Equal(t, []Trigger{TriggerGradeDrop}, event.Triggers)
+	assert.Empty(t, event.FailingTests)
+	assert.Equal(t, []string{types.TestXFrameOptions}, event.Waived)
+
+	// The waiver expired, so the failure resurface even though the scan did not change.
+	expired := b.Evaluate("observatory.mozilla.org", new.Tests, time.Date(2021, time.March, 2, 0, 0, 0, 0, time.UTC))
+	event = CompareWithBaseline("observatory.mozilla.org", new, new, waived, expired)
+	require.NotNil(t, event)
+	assert.Equal(t, []Trigger{TriggerNewFailures}, event.Triggers)
+	assert.Equal(t, []string{types.TestXFrameOptions}, event.NewFailures)
+	assert.Empty(t, event.Waived)
+
+	assert.Nil(t, CompareWithBaseline("observatory.mozilla.org", new, new, expired, expired))
+}
+
+func TestComparePolicy(t *testing.T) {
+	p, err := policy.Parse([]byte(`
+rules:
+  - name: grade
+    expr: grade >= A
+  - name: x-frame-options
+    expr: x-frame-options.pass == true
+`))
+	require.Nil(t, err)
+	old := &types.Scan{Result: &types.ScannerResult{ScanID: 1, Grade: "A+", Score: 100}, Tests: newTests(true)}
+	new := &types.Scan{Result: &types.ScannerResult{ScanID: 2, Grade: "A", Score: 90}, Tests: newTests(false)}
+	oldReport := p.Evaluate("observatory.mozilla.org", old.Result, old.Tests)
+	newReport := p.Evaluate("observatory.mozilla.org", new.Result, new.Tests)
+
+	event := ComparePolicy("observatory.mozilla.org", old, new, oldReport, newReport)
+	require.NotNil(t, event)
+	assert.Equal(t, []Trigger{TriggerPolicyViolation}, event.Triggers)
+	assert.Equal(t, []string{"x-frame-options: x-frame-options.pass is false, want == true"}, event.Violations)
+	assert.Equal(t, types.ScanID(1), event.PreviousScanID)
+
+	assert.Nil(t, ComparePolicy("observatory.mozilla.org", new, new, newReport, newReport))
+	assert.Nil(t, ComparePolicy("observatory.mozilla.org", old, new, oldReport, nil))
+
+	event = ComparePolicy("observatory.mozilla.org", nil, new, nil, newReport)
+	require.NotNil(t, event)
+	assert.Len(t, event.Violations, 1)
+	assert.Empty(t, event.OldGrade)
+}
+
+func TestCheck(t *testing.T) {
+	srv := observatorytest.NewServer()
+	defer srv.Close()
+	srv.AddHost(observatorytest.Host{
+		Name:    "observatory.mozilla.org",
+		Tests:   newTests(false),
+		States:  []string{observatory.Finished},
+		History: []*types.ScannerHostHistory{{EndTimeUnixTimestamp: 1000, Grade: "A", ScanId: 1, Score: 90}},
+	})
+	srv.AddHost(observatorytest.Host{Name: "failed.example.com", States: []string{observatory.Aborted}})
+
+	event, err := Check(context.Background(), srv.NewClient(), "observatory.mozilla.org", option.ForceRescan(true))
+	require.Nil(t, err)
+	require.NotNil(t, event)
+	assert.Equal(t, []Trigger{TriggerGradeDrop}, event.Triggers)
+	assert.Equal(t, "A", event.OldGrade)
+	assert.Equal(t, "B+", event.NewGrade)
+	assert.Equal(t, []string{types.TestXFrameOptions}, event.FailingTests)
+
+	event, err = Check(context.Background(), srv.NewClient(), "failed.example.com")
+	require.Nil(t, err)
+	require.NotNil(t, event)
+	assert.True(t, event.Has(TriggerScanFailed))
+}
+
+func TestLatest(t *testing.T) {
+	histories := []*types.ScannerHostHistory{
+		{EndTimeUnixTimestamp: 3000, ScanId: 3},
+		{EndTimeUnixTimestamp: 1000, ScanId: 1},
+		{EndTimeUnixTimestamp: 2000, ScanId: 2},
+	}
+	assert.Equal(t, types.ScanID(3), latest(histories, 0).ScanId)
+	assert.Equal(t, types.ScanID(2), latest(histories, 3).ScanId)
+	assert.Nil(t, latest(nil, 0))
+}
+
+func TestRender(t *testing.T) {
+	tmpl, err := ParseTemplate("")
+	require.Nil(t, err)
+	msg, err := Render(tmpl, newEvent())
+	require.Nil(t, err)
+	assert.Equal(t, "observatory.mozilla.org: grade dropped, new failing tests\n"+
+		"Grade: A+ -> B+ (score 100 -> 80, -20)\n"+
+		"Newly failing tests: x-frame-options\n"+
+		"Failing tests: x-frame-options", msg)
+
+	msg, err = Render(tmpl, &Event{Triggers: []Trigger{TriggerScanFailed}, Host: "observatory.mozilla.org", Error: "scan aborted"})
+	require.Nil(t, err)
+	assert.Equal(t, "observatory.mozilla.org: scan failed\nError: scan aborted", msg)
+
+	_, err = ParseTemplate("{{.Host")
+	assert.NotNil(t, err)
+}
+
+func TestWebhook(t *testing.T) {
+	var got WebhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.Nil(t, err)
+		assert.True(t, VerifySignature("s3cr3t", body, r.Header.Get(SignatureHeader)))
+		assert.False(t, VerifySignature("other", body, r.Header.Get(SignatureHeader)))
+		assert.Equal(t, "team-a", r.Header.Get("X-Team"))
+		require.Nil(t, json.Unmarshal(body, &got))
+	}))
+	defer srv.Close()
+
+	n, err := NewWebhook(WebhookConfig{URL: srv.URL, Secret: "s3cr3t", Header: map[string]string{"X-Team": "team-a"}, Template: "{{.Host}} {{signed .ScoreDelta}}"})
+	require.Nil(t, err)
+	require.Nil(t, n.Notify(context.Background(), newEvent()))
+	assert.Equal(t, "observatory.mozilla.org -20", got.Message)
+	assert.Equal(t, newEvent(), got.Event)
+}
+
+func TestChat(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = make(map[string]string)
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&got))
+		if strings.HasSuffix(r.URL.Path, "/down") {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	slack, err := NewSlack(ChatConfig{URL: srv.URL})
+	require.Nil(t, err)
+	require.Nil(t, slack.Notify(context.Background(), newEvent()))
+	assert.True(t, strings.HasPrefix(got["text"], "observatory.mozilla.org: grade dropped"))
+
+	teams, err := NewTeams(ChatConfig{URL: srv.URL})
+	require.Nil(t, err)
+	require.Nil(t, teams.Notify(context.Background(), newEvent()))
+	assert.Equal(t, "MessageCard", got["@type"])
+	assert.Equal(t, "observatory.mozilla.org: grade dropped, new failing tests", got["title"])
+	assert.Contains(t, got["text"], "Grade: A+ -> B+ (score 100 -> 80, -20)\n\nNewly failing tests")
+
+	slack, err = NewSlack(ChatConfig{URL: srv.URL + "/down"})
+	require.Nil(t, err)
+	assert.NotNil(t, slack.Notify(context.Background(), newEvent()))
+}
+
+// serveSMTP accept a single SMTP session and send the received message on the channel.
+func serveSMTP(ln net.Listener, messages chan<- string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		_, _ = conn.Write([]byte(line + "\r\n"))
+	}
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			messages <- data.String()
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEmail(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+	messages := make(chan string, 1)
+	go serveSMTP(ln, messages)
+
+	n, err := NewEmail(EmailConfig{
+		Addr: ln.Addr().String(),
+		From: "observatory@example.com",
+		To:   []string{"security@example.com", "ops@example.com"},
+	})
+	require.Nil(t, err)
+	require.Nil(t, n.Notify(context.Background(), newEvent()))
+
+	msg := <-messages
+	assert.Contains(t, msg, "To: security@example.com, ops@example.com\r\n")
+	assert.Contains(t, msg, "Subject: [observatory] observatory.mozilla.org: grade dropped, new failing tests\r\n")
+	assert.Contains(t, msg, "\r\n\r\nobservatory.mozilla.org: grade dropped, new failing tests\r\nGrade: A+ -> B+")
+
+	_, err = NewEmail(EmailConfig{Addr: ln.Addr().String()})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// DefaultTemplate is the message template used when a notifier is not given one. Templates are executed with
+// the Event, and can use the join, signed and trigger functions in addition to the text/template builtins.
+const DefaultTemplate = `{{.Host}}: {{range $i, $t := .Triggers}}{{if $i}}, {{end}}{{trigger $t}}{{end}}
+{{- if .NewGrade}}
+Grade: {{.OldGrade}} -> {{.NewGrade}} (score {{.OldScore}} -> {{.NewScore}}, {{signed .ScoreDelta}})
+{{- end}}
+{{- if .NewFailures}}
+Newly failing tests: {{join .NewFailures ", "}}
+{{- end}}
+{{- if .FailingTests}}
+Failing tests: {{join .FailingTests ", "}}
+{{- end}}
+{{- if .Waived}}
+Waived tests: {{join .Waived ", "}}
+{{- end}}
+{{- if .Violations}}
+Policy violations: {{join .Violations "; "}}
+{{- end}}
+{{- if .Error}}
+Error: {{.Error}}
+{{- end}}`
+
+// DefaultSubjectTemplate is the email subject template used when an email notifier is not given one.
+const DefaultSubjectTemplate = `[observatory] {{.Host}}: {{range $i, $t := .Triggers}}{{if $i}}, {{end}}{{trigger $t}}{{end}}`
+
+var triggerText = map[Trigger]string{
+	TriggerGradeDrop:       "grade dropped",
+	TriggerNewFailures:     "new failing tests",
+	TriggerScanFailed:      "scan failed",
+	TriggerPolicyViolation: "policy violated",
+}
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"signed": func(n int) string {
+		if n > 0 {
+			return "+" + strconv.Itoa(n)
+		}
+		return strconv.Itoa(n)
+	},
+	"trigger": func(t Trigger) string {
+		if text, ok := triggerText[t]; ok {
+			return text
+		}
+		return string(t)
+	},
+}
+
+// ParseTemplate parse a message template, or return the DefaultTemplate if text is empty.
+func ParseTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+	tmpl, err := template.New("message").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// Render execute the template with the event.
+func Render(tmpl *template.Template, e *Event) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, e); err != nil {
+		return "", fmt.Errorf("unable to render notification: %w", err)
+	}
+	return buf.String(), nil
+}
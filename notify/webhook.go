@@ -0,0 +1,208 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SignatureHeader is the header carrying the HMAC-SHA256 signature of a webhook payload, as "sha256=<hex>".
+const SignatureHeader = "X-Observatory-Signature"
+
+// WebhookConfig configure a generic JSON webhook.
+type WebhookConfig struct {
+	// URL the payload is posted to
+	URL string `yaml:"url"`
+	// secret used to sign the payload, which is not signed if empty
+	Secret string `yaml:"secret"`
+	// additional request headers
+	Header map[string]string `yaml:"headers"`
+	// message template, default to DefaultTemplate
+	Template string `yaml:"template"`
+	// client used to post the payload, default to a client with a 10 seconds timeout
+	Client *http.Client `yaml:"-"`
+}
+
+// WebhookPayload is the JSON body posted by a Webhook: the event fields and the rendered message.
+type WebhookPayload struct {
+	*Event
+	Message string `json:"message"`
+}
+
+// Webhook is a Notifier posting each event as JSON to an URL, signed with HMAC-SHA256 if a secret is set.
+type Webhook struct {
+	cfg  WebhookConfig
+	tmpl *template.Template
+}
+
+var _ Notifier = (*Webhook)(nil)
+
+// NewWebhook return a Webhook notifier.
+func NewWebhook(cfg WebhookConfig) (*Webhook, error) {
+	tmpl, err := ParseTemplate(cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &Webhook{cfg: cfg, tmpl: tmpl}, nil
+}
+
+// Notify post the event.
+func (w *Webhook) Notify(ctx context.Context, e *Event) error {
+	msg, err := Render(w.tmpl, e)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(&WebhookPayload{Event: e, Message: msg})
+	if err != nil {
+		return err
+	}
+
+	header := make(http.Header, len(w.cfg.Header)+1)
+	for key, value := range w.cfg.Header {
+		header.Set(key, value)
+	}
+	if w.cfg.Secret != "" {
+		header.Set(SignatureHeader, Sign(w.cfg.Secret, body))
+	}
+	return post(ctx, w.cfg.Client, w.cfg.URL, header, body)
+}
+
+// Sign return the signature of a webhook payload, as set in the SignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature report whether the signature, as found in the SignatureHeader, match the payload. Receivers
+// should use it to authenticate the webhook.
+func VerifySignature(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// ChatConfig configure a Slack or Microsoft Teams incoming webhook.
+type ChatConfig struct {
+	// incoming webhook URL
+	URL string `yaml:"url"`
+	// message template, default to DefaultTemplate
+	Template string `yaml:"template"`
+	// client used to post the message, default to a client with a 10 seconds timeout
+	Client *http.Client `yaml:"-"`
+}
+
+// Slack is a Notifier posting each event to a Slack-compatible incoming webhook.
+type Slack struct {
+	cfg  ChatConfig
+	tmpl *template.Template
+}
+
+var _ Notifier = (*Slack)(nil)
+
+// NewSlack return a Slack notifier.
+func NewSlack(cfg ChatConfig) (*Slack, error) {
+	tmpl, err := ParseTemplate(cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &Slack{cfg: cfg, tmpl: tmpl}, nil
+}
+
+// Notify post the event.
+func (s *Slack) Notify(ctx context.Context, e *Event) error {
+	msg, err := Render(s.tmpl, e)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"text": msg})
+	if err != nil {
+		return err
+	}
+	return post(ctx, s.cfg.Client, s.cfg.URL, nil, body)
+}
+
+// teamsCard is a Microsoft Teams MessageCard.
+type teamsCard struct {
+	Type       string `json:"@type"`
+	Context    string `json:"@context"`
+	Summary    string `json:"summary"`
+	ThemeColor string `json:"themeColor"`
+	Title      string `json:"title"`
+	Text       string `json:"text"`
+}
+
+// Teams is a Notifier posting each event as a card to a Microsoft Teams-compatible incoming webhook.
+type Teams struct {
+	cfg  ChatConfig
+	tmpl *template.Template
+}
+
+var _ Notifier = (*Teams)(nil)
+
+// NewTeams return a Teams notifier.
+func NewTeams(cfg ChatConfig) (*Teams, error) {
+	tmpl, err := ParseTemplate(cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &Teams{cfg: cfg, tmpl: tmpl}, nil
+}
+
+// Notify post the event. The first line of the message is the card title, and the other lines its text.
+func (t *Teams) Notify(ctx context.Context, e *Event) error {
+	msg, err := Render(t.tmpl, e)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(msg, "\n")
+	body, err := json.Marshal(&teamsCard{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		Summary:    lines[0],
+		ThemeColor: "D70000",
+		Title:      lines[0],
+		// Teams only break lines on blank lines
+		Text: strings.Join(lines[1:], "\n\n"),
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, t.cfg.Client, t.cfg.URL, nil, body)
+}
+
+var defaultHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+func post(ctx context.Context, c *http.Client, url string, header http.Header, body []byte) error {
+	if c == nil {
+		c = defaultHTTPClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("notification failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notification failed: %s", resp.Status)
+	}
+	return nil
+}
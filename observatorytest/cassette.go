@@ -0,0 +1,307 @@
+package observatorytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+)
+
+var ErrInteractionNotFound = errors.New("no recorded interaction match the request")
+
+// Mode select whether a Cassette record or replay interactions.
+type Mode int
+
+const (
+	// ModeReplay serve every request from the cassette file, without network access.
+	ModeReplay Mode = iota
+	// ModeRecord send every request to the api and record the interactions, replacing the cassette file on Save.
+	ModeRecord
+	// ModeAuto replay the cassette file if it exists, and record it otherwise.
+	ModeAuto
+)
+
+// Interaction is a recorded request and its response. Request headers are never recorded, so credentials
+// do not end up in the cassette file.
+type Interaction struct {
+	Method     string `json:"method"`
+	ApiCall    string `json:"api_call"`
+	Query      string `json:"query,omitempty"`
+	Form       string `json:"form,omitempty"`
+	StatusCode int    `json:"status_code"`
+	// response body when it is valid JSON, which is always the case for the api
+	Body json.RawMessage `json:"body,omitempty"`
+	// response body otherwise, e.g. an error page of a proxy
+	Text string `json:"text,omitempty"`
+}
+
+func (i *Interaction) match(other *Interaction) bool {
+	return i.Method == other.Method && i.ApiCall == other.ApiCall && i.Query == other.Query && i.Form == other.Form
+}
+
+func (i *Interaction) body() []byte {
+	if len(i.Body) != 0 {
+		return i.Body
+	}
+	return []byte(i.Text)
+}
+
+// Redactor rewrite volatile or sensitive parts of an interaction before it is recorded. Redactors are also
+// applied to the requests to replay, so a redacted query or form still match the recorded interaction.
+type Redactor func(i *Interaction)
+
+// RedactFields return a Redactor that replace the value of the given JSON fields of the response body, at
+// any depth, e.g. {"start_time": "Mon, 01 Mar 2021 12:00:00 GMT"} to freeze the start time of scans.
+func RedactFields(fields map[string]interface{}) Redactor {
+	return func(i *Interaction) {
+		if len(i.Body) == 0 {
+			return
+		}
+		var v interface{}
+		if err := json.Unmarshal(i.Body, &v); err != nil {
+			return
+		}
+		if buf, err := json.Marshal(redact(v, fields)); err == nil {
+			i.Body = buf
+		}
+	}
+}
+
+// RedactQuery return a Redactor that replace the value of the given query and form parameters.
+func RedactQuery(params map[string]string) Redactor {
+	return func(i *Interaction) {
+		i.Query = redactValues(i.Query, params)
+		i.Form = redactValues(i.Form, params)
+	}
+}
+
+func redact(v interface{}, fields map[string]interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if replacement, ok := fields[key]; ok {
+				v[key] = replacement
+				continue
+			}
+			v[key] = redact(value, fields)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redact(value, fields)
+		}
+	}
+	return v
+}
+
+func redactValues(encoded string, params map[string]string) string {
+	values, err := url.ParseQuery(encoded)
+	if err != nil || len(values) == 0 {
+		return encoded
+	}
+	for key, replacement := range params {
+		if _, ok := values[key]; ok {
+			values.Set(key, replacement)
+		}
+	}
+	return values.Encode()
+}
+
+// CassetteConfig configure a Cassette.
+type CassetteConfig struct {
+	// record or replay, default to ModeReplay
+	Mode Mode
+	// transport used to send the requests in record mode, default to http.DefaultTransport
+	Transport http.RoundTripper
+	// redactors applied, in order, to every interaction
+	Redactors []Redactor
+}
+
+type cassetteFile struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Cassette is an http.RoundTripper that record the interactions of a Client with the api into a file, and replay
+// them later. Requests are matched on their method, api call, query and form. When several interactions match,
+// such as the polling requests of Client.Analyze, they are replayed in the recorded order, and the last one is
+// replayed again once all have been used.
+type Cassette struct {
+	path         string
+	mode         Mode
+	transport    http.RoundTripper
+	redactors    []Redactor
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+var _ http.RoundTripper = (*Cassette)(nil)
+
+// NewCassette return a Cassette backed by the file at path, which is read unless the cassette record.
+func NewCassette(path string, cfg CassetteConfig) (*Cassette, error) {
+	if cfg.Mode == ModeAuto {
+		cfg.Mode = ModeRecord
+		if _, err := os.Stat(path); err == nil {
+			cfg.Mode = ModeReplay
+		}
+	}
+	if cfg.Transport == nil {
+		cfg.Transport = http.DefaultTransport
+	}
+
+	c := &Cassette{
+		path:         path,
+		mode:         cfg.Mode,
+		transport:    cfg.Transport,
+		redactors:    cfg.Redactors,
+		interactions: make([]*Interaction, 0),
+	}
+	if c.mode == ModeReplay {
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read cassette: %w", err)
+		}
+		file := new(cassetteFile)
+		if err := json.Unmarshal(buf, file); err != nil {
+			return nil, fmt.Errorf("unable to decode cassette %s: %w", path, err)
+		}
+		c.interactions = file.Interactions
+		c.used = make([]bool, len(file.Interactions))
+	}
+	return c, nil
+}
+
+// Mode return whether the cassette record or replay, ModeAuto being resolved when the cassette is created.
+func (c *Cassette) Mode() Mode {
+	return c.mode
+}
+
+// Client return an http.Client using the cassette as transport.
+func (c *Cassette) Client() *http.Client {
+	return &http.Client{Transport: c}
+}
+
+// RoundTrip record or replay the request.
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	interaction, err := newInteraction(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.mode == ModeReplay {
+		for _, redactor := range c.redactors {
+			redactor(interaction)
+		}
+		recorded, err := c.replay(interaction)
+		if err != nil {
+			return nil, err
+		}
+		return newResponse(req, recorded.StatusCode, recorded.body()), nil
+	}
+
+	resp, err := c.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction.StatusCode = resp.StatusCode
+	if json.Valid(buf) {
+		interaction.Body = json.RawMessage(bytes.TrimSpace(buf))
+	} else {
+		interaction.Text = string(buf)
+	}
+	for _, redactor := range c.redactors {
+		redactor(interaction)
+	}
+	c.mu.Lock()
+	c.interactions = append(c.interactions, interaction)
+	c.mu.Unlock()
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(buf))
+	return resp, nil
+}
+
+// Save write the recorded interactions to the cassette file. It does nothing when the cassette replay.
+func (c *Cassette) Save() error {
+	if c.mode == ModeReplay {
+		return nil
+	}
+
+	c.mu.Lock()
+	buf, err := json.MarshalIndent(&cassetteFile{Interactions: c.interactions}, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(c.path, append(buf, '\n'), 0o644); err != nil {
+		return fmt.Errorf("unable to write cassette: %w", err)
+	}
+	return nil
+}
+
+func (c *Cassette) replay(interaction *Interaction) (*Interaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last := -1
+	for i, recorded := range c.interactions {
+		if !recorded.match(interaction) {
+			continue
+		}
+		if !c.used[i] {
+			c.used[i] = true
+			return recorded, nil
+		}
+		last = i
+	}
+	if last < 0 {
+		return nil, fmt.Errorf("%w: %s %s?%s", ErrInteractionNotFound, interaction.Method, interaction.ApiCall, interaction.Query)
+	}
+	return c.interactions[last], nil
+}
+
+func newInteraction(req *http.Request) (*Interaction, error) {
+	interaction := &Interaction{
+		Method:  req.Method,
+		ApiCall: path.Base(req.URL.Path),
+		Query:   req.URL.Query().Encode(),
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		buf, err := ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(buf))
+		form, err := url.ParseQuery(string(buf))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse request body: %w", err)
+		}
+		interaction.Form = form.Encode()
+	}
+	return interaction, nil
+}
+
+func newResponse(req *http.Request, statusCode int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,61 @@
+package observatorytest
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/option"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCassette(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	redactors := []Redactor{
+		RedactFields(map[string]interface{}{"start_time": "Mon, 01 Mar 2021 12:00:00 GMT"}),
+		RedactQuery(map[string]string{"host": "example.com"}),
+	}
+
+	srv := NewServer()
+	srv.AddHost(Host{Name: "observatory.mozilla.org", Tests: newTests()})
+	recorder, err := NewCassette(path, CassetteConfig{Mode: ModeAuto, Redactors: redactors})
+	require.Nil(t, err)
+	require.Equal(t, ModeRecord, recorder.Mode())
+
+	c := observatory.NewCustomClient(recorder.Client(), srv.URL)
+	want, err := c.Analyze(context.Background(), "observatory.mozilla.org", option.WaitFinished(true, time.Millisecond))
+	require.Nil(t, err)
+	wantTests, err := c.GetTestResults(context.Background(), want.ScanID)
+	require.Nil(t, err)
+	require.Nil(t, recorder.Save())
+	srv.Close()
+
+	buf, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.NotContains(t, string(buf), "observatory.mozilla.org")
+
+	player, err := NewCassette(path, CassetteConfig{Mode: ModeAuto, Redactors: redactors})
+	require.Nil(t, err)
+	require.Equal(t, ModeReplay, player.Mode())
+
+	c = observatory.NewCustomClient(player.Client(), srv.URL)
+	got, err := c.Analyze(context.Background(), "observatory.mozilla.org", option.WaitFinished(true, time.Millisecond))
+	require.Nil(t, err)
+	assert.Equal(t, want.ScanID, got.ScanID)
+	assert.Equal(t, want.Grade, got.Grade)
+	assert.Equal(t, "Mon, 01 Mar 2021 12:00:00 GMT", got.StartTime)
+	gotTests, err := c.GetTestResults(context.Background(), got.ScanID)
+	require.Nil(t, err)
+	assert.Equal(t, wantTests, gotTests)
+
+	// The last matching interaction is replayed once all have been used.
+	got, err = c.GetAssessment(context.Background(), "observatory.mozilla.org")
+	require.Nil(t, err)
+	assert.Equal(t, observatory.Finished, got.State)
+
+	_, err = c.GetGradeDistribution(context.Background())
+	assert.ErrorIs(t, err, ErrInteractionNotFound)
+}
@@ -0,0 +1,293 @@
+package observatorytest
+
+import (
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/grader"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// maxRecentScans is the number of scans returned by getRecentScans.
+const maxRecentScans = 10
+
+// Host seed a host known by the Server. A host that is not seeded is scanned as if all its tests had no result.
+type Host struct {
+	// host name
+	Name string
+	// result of the scans of the host once finished. When the grade is empty, the score, grade, likelihood
+	// indicator and test counts are computed from Tests.
+	Result types.ScannerResult
+	// test results returned by getScanResults once a scan is finished
+	Tests *types.ScannerTestResult
+	// states a new scan go through, moving to the next one at each assessment retrieval. Default to
+	// PENDING, RUNNING and FINISHED.
+	States []string
+	// past scans returned by getHostHistory, before the scans run by the server
+	History []*types.ScannerHostHistory
+}
+
+type hostState struct {
+	seed  Host
+	scans []*scan
+}
+
+func newHostState(h Host) *hostState {
+	if h.Tests == nil {
+		h.Tests = new(types.ScannerTestResult)
+	}
+	if len(h.States) == 0 {
+		h.States = []string{observatory.Pending, observatory.Running, observatory.Finished}
+	}
+	if h.Result.Grade == "" {
+		summaries := h.Tests.Summaries()
+		h.Result.Score = grader.Score(summaries)
+		h.Result.Grade, h.Result.LikelihoodIndicator = grader.Grade(h.Result.Score)
+		h.Result.TestsPassed, h.Result.TestsFailed, h.Result.TestsQuantity = 0, 0, 0
+		for _, test := range summaries {
+			if test.Result == "" {
+				continue
+			}
+			h.Result.TestsQuantity++
+			if test.Pass {
+				h.Result.TestsPassed++
+			} else {
+				h.Result.TestsFailed++
+			}
+		}
+	}
+	return &hostState{seed: h}
+}
+
+func (h *hostState) last() *scan {
+	if len(h.scans) == 0 {
+		return nil
+	}
+	return h.scans[len(h.scans)-1]
+}
+
+// history return the seeded history followed by the finished scans, ordered by end time.
+func (h *hostState) history() []*types.ScannerHostHistory {
+	histories := make([]*types.ScannerHostHistory, 0, len(h.seed.History)+len(h.scans))
+	histories = append(histories, h.seed.History...)
+	for _, sc := range h.scans {
+		if sc.state() == observatory.Finished {
+			histories = append(histories, &types.ScannerHostHistory{
+				EndTime:              sc.end.Format(http.TimeFormat),
+				EndTimeUnixTimestamp: int(sc.end.Unix()),
+				Grade:                sc.result.Grade,
+				ScanId:               sc.id,
+				Score:                sc.result.Score,
+			})
+		}
+	}
+	sort.SliceStable(histories, func(i, j int) bool {
+		return histories[i].EndTimeUnixTimestamp < histories[j].EndTimeUnixTimestamp
+	})
+	return histories
+}
+
+type scan struct {
+	id     types.ScanID
+	host   string
+	hidden bool
+	step   int
+	result types.ScannerResult
+	tests  *types.ScannerTestResult
+	states []string
+	start  time.Time
+	end    time.Time
+}
+
+func (sc *scan) state() string {
+	return sc.states[sc.step]
+}
+
+func (sc *scan) done() bool {
+	state := sc.state()
+	return state == observatory.Finished || state == observatory.Failed || state == observatory.Aborted
+}
+
+// advance move the scan to its next state, if any.
+func (sc *scan) advance(now time.Time) {
+	if sc.step < len(sc.states)-1 {
+		sc.step++
+		if sc.done() {
+			sc.end = now
+		}
+	}
+}
+
+// view return the assessment of the scan, without the outcome of the scan until it is finished.
+func (sc *scan) view() *types.ScannerResult {
+	result := sc.result
+	result.ScanID = sc.id
+	result.State = sc.state()
+	result.Hidden = sc.hidden
+	result.StartTime = sc.start.Format(http.TimeFormat)
+	if result.State == observatory.Finished {
+		result.EndTime = sc.end.Format(http.TimeFormat)
+		return &result
+	}
+
+	result.EndTime = ""
+	result.Grade = ""
+	result.LikelihoodIndicator = ""
+	result.ResponseHeaders = nil
+	result.Score = 0
+	result.TestsFailed = 0
+	result.TestsPassed = 0
+	return &result
+}
+
+func (s *Server) host(name string) *hostState {
+	h, ok := s.hosts[name]
+	if !ok {
+		h = newHostState(Host{Name: name})
+		s.hosts[name] = h
+	}
+	return h
+}
+
+// invokeAssessment start a new scan, unless the last scan of the host is still running, or is finished and
+// rescan is false, in which case the last scan is returned.
+func (s *Server) invokeAssessment(name string, rescan, hidden bool) (int, interface{}) {
+	if name == "" {
+		return http.StatusBadRequest, apiError("invalid-hostname")
+	}
+
+	h := s.host(name)
+	if last := h.last(); last != nil && (!last.done() || (!rescan && last.state() == observatory.Finished)) {
+		return http.StatusOK, last.view()
+	}
+
+	s.lastID++
+	now := s.now()
+	sc := &scan{
+		id:     s.lastID,
+		host:   name,
+		hidden: hidden,
+		result: h.seed.Result,
+		tests:  h.seed.Tests,
+		states: h.seed.States,
+		start:  now,
+	}
+	if sc.done() {
+		sc.end = now
+	}
+	h.scans = append(h.scans, sc)
+	s.scans[sc.id] = sc
+	return http.StatusOK, sc.view()
+}
+
+// retrieveAssessment move the last scan of the host to its next state and return it.
+func (s *Server) retrieveAssessment(name string) (int, interface{}) {
+	h, ok := s.hosts[name]
+	if !ok || h.last() == nil {
+		return http.StatusOK, apiError("recent-scan-not-found")
+	}
+
+	last := h.last()
+	last.advance(s.now())
+	return http.StatusOK, last.view()
+}
+
+func (s *Server) retrieveTestResults(param string) (int, interface{}) {
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		return http.StatusOK, apiError("invalid-scan-id")
+	}
+
+	if sc, ok := s.scans[types.ScanID(id)]; ok {
+		if sc.state() != observatory.Finished {
+			return http.StatusOK, apiError("scan-not-finished")
+		}
+		return http.StatusOK, sc.tests
+	}
+	for _, h := range s.hosts {
+		for _, history := range h.seed.History {
+			if history.ScanId == types.ScanID(id) {
+				return http.StatusOK, h.seed.Tests
+			}
+		}
+	}
+	return http.StatusOK, apiError("invalid-scan-id")
+}
+
+func (s *Server) retrieveHostHistory(name string) (int, interface{}) {
+	h, ok := s.hosts[name]
+	if !ok {
+		return http.StatusOK, []*types.ScannerHostHistory{}
+	}
+	return http.StatusOK, h.history()
+}
+
+// retrieveRecentScans return the grade of the most recent finished scans, which are not hidden, with a
+// score between min and max.
+func (s *Server) retrieveRecentScans(minParam, maxParam string) (int, interface{}) {
+	min, max := 0, 100
+	var err error
+	if minParam != "" {
+		if min, err = strconv.Atoi(minParam); err != nil {
+			return http.StatusBadRequest, apiError("invalid-parameters")
+		}
+	}
+	if maxParam != "" {
+		if max, err = strconv.Atoi(maxParam); err != nil {
+			return http.StatusBadRequest, apiError("invalid-parameters")
+		}
+	}
+
+	scans := make([]*scan, 0)
+	for _, h := range s.hosts {
+		for i := len(h.scans) - 1; i >= 0; i-- {
+			sc := h.scans[i]
+			if sc.state() == observatory.Finished && !sc.hidden {
+				if sc.result.Score >= min && sc.result.Score <= max {
+					scans = append(scans, sc)
+				}
+				break
+			}
+		}
+	}
+	sort.Slice(scans, func(i, j int) bool {
+		return scans[i].end.After(scans[j].end)
+	})
+
+	recent := make(types.ScannerRecentScans, 0, maxRecentScans)
+	for i := 0; i < len(scans) && i < maxRecentScans; i++ {
+		recent = append(recent, types.RecentScan{Host: scans[i].host, Grade: scans[i].result.Grade})
+	}
+	return http.StatusOK, recent
+}
+
+// retrieveGradeDistribution return the configured grade distribution, or count the grade of the most
+// recent scan of each host.
+func (s *Server) retrieveGradeDistribution() (int, interface{}) {
+	if s.distribution != nil {
+		return http.StatusOK, s.distribution
+	}
+
+	d := new(types.ScannerGradeDistribution)
+	for _, h := range s.hosts {
+		if histories := h.history(); len(histories) > 0 {
+			countGrade(d, histories[len(histories)-1].Grade)
+		}
+	}
+	return http.StatusOK, d
+}
+
+func countGrade(d *types.ScannerGradeDistribution, grade string) {
+	counts := map[string]*int{
+		"A+": &d.A, "A": &d.A1, "A-": &d.A2,
+		"B+": &d.B, "B": &d.B1, "B-": &d.B2,
+		"C+": &d.C, "C": &d.C1, "C-": &d.C2,
+		"D+": &d.D, "D": &d.D1, "D-": &d.D2,
+		"F": &d.F,
+	}
+	if count, ok := counts[grade]; ok {
+		*count++
+	}
+}
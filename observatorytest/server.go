@@ -0,0 +1,272 @@
+// Package observatorytest provide a stateful, in-process fake of the HTTP Observatory api for tests. A Server
+// implement the analyze, getScanResults, getHostHistory, getRecentScans and getGradeDistribution api calls, let
+// tests seed hosts and script the states a scan go through, inject errors, latency and rate limiting, and record
+// every call it receives. A Cassette record the interactions with the real api into a file and replay them, so
+// integration tests run without network access.
+package observatorytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/internal/option"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Call is a request received by the Server.
+type Call struct {
+	Method     string
+	ApiCall    string
+	Query      url.Values
+	Form       url.Values
+	StatusCode int
+	Time       time.Time
+}
+
+// Fault make the Server fail matching requests instead of serving them.
+type Fault struct {
+	// api call to fail, any api call if empty
+	ApiCall string
+	// HTTP method to fail, any method if empty
+	Method string
+	// status code of the response, default to 500
+	StatusCode int
+	// number of matching requests to fail, every matching request if 0
+	Times int
+}
+
+func (f *Fault) match(method, apiCall string) bool {
+	return (f.ApiCall == "" || f.ApiCall == apiCall) && (f.Method == "" || f.Method == method)
+}
+
+// Server is a fake HTTP Observatory api listening on a local address. All methods are safe for concurrent use.
+type Server struct {
+	*httptest.Server
+	mu           sync.Mutex
+	hosts        map[string]*hostState
+	scans        map[types.ScanID]*scan
+	lastID       types.ScanID
+	calls        []Call
+	faults       []*Fault
+	latency      time.Duration
+	rateLimit    int
+	rateWindow   time.Duration
+	requests     []time.Time
+	distribution *types.ScannerGradeDistribution
+	now          func() time.Time
+}
+
+// NewServer start and return a new Server with no known host. The caller should call Close when finished,
+// to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		hosts: make(map[string]*hostState),
+		scans: make(map[types.ScanID]*scan),
+		now:   time.Now,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// NewClient return an HTTP Observatory client sending its requests to the server.
+func (s *Server) NewClient(opts ...option.ClientOption) *observatory.Client {
+	return observatory.NewCustomClient(s.Server.Client(), s.URL, opts...)
+}
+
+// AddHost seed a host, replacing any previous seed and scan of the same host.
+func (s *Server) AddHost(h Host) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, history := range h.History {
+		if history.ScanId > s.lastID {
+			s.lastID = history.ScanId
+		}
+	}
+	s.hosts[h.Name] = newHostState(h)
+}
+
+// InjectFault add a fault. Faults are evaluated in the order they were added, and the first matching
+// fault fail the request.
+func (s *Server) InjectFault(f Fault) {
+	if f.StatusCode == 0 {
+		f.StatusCode = http.StatusInternalServerError
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults remove every fault.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// SetLatency delay every response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetRateLimit answer with 429 Too Many Requests once more than limit requests were received within the
+// window. A zero limit disable rate limiting.
+func (s *Server) SetRateLimit(limit int, window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimit = limit
+	s.rateWindow = window
+	s.requests = nil
+}
+
+// SetGradeDistribution set the grade distribution returned by getGradeDistribution. By default, the grade
+// distribution is computed from the last finished scan of each host.
+func (s *Server) SetGradeDistribution(d *types.ScannerGradeDistribution) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.distribution = d
+}
+
+// SetNow set the clock used for the start and end time of scans. Default to time.Now.
+func (s *Server) SetNow(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// Calls return every request received so far, in order.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	calls := make([]Call, len(s.calls))
+	copy(calls, s.calls)
+	return calls
+}
+
+// CallsTo return the requests received so far for the api call, in order.
+func (s *Server) CallsTo(apiCall string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	calls := make([]Call, 0)
+	for _, c := range s.calls {
+		if c.ApiCall == apiCall {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// CallCount return the number of requests received so far for the api call.
+func (s *Server) CallCount(apiCall string) int {
+	return len(s.CallsTo(apiCall))
+}
+
+// ResetCalls forget every request received so far.
+func (s *Server) ResetCalls() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	latency := s.latency
+	s.mu.Unlock()
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+
+	s.mu.Lock()
+	call := Call{
+		Method:  r.Method,
+		ApiCall: strings.TrimPrefix(r.URL.Path, "/"),
+		Query:   r.URL.Query(),
+		Form:    r.PostForm,
+		Time:    s.now(),
+	}
+	status, body := s.handle(&call)
+	call.StatusCode = status
+	s.calls = append(s.calls, call)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// handle return the status code and body of the response. It must be called with the lock held.
+func (s *Server) handle(call *Call) (int, interface{}) {
+	if s.rateLimited() {
+		return http.StatusTooManyRequests, apiError("rate-limited")
+	}
+
+	for i, f := range s.faults {
+		if !f.match(call.Method, call.ApiCall) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return f.StatusCode, apiError(strings.ToLower(strings.ReplaceAll(http.StatusText(f.StatusCode), " ", "-")))
+	}
+
+	switch {
+	case call.ApiCall == observatory.ApiCallAnalyze && call.Method == http.MethodPost:
+		return s.invokeAssessment(call.Query.Get("host"), call.Form.Get("rescan") == "true", call.Form.Get("hidden") == "true")
+	case call.ApiCall == observatory.ApiCallAnalyze && call.Method == http.MethodGet:
+		return s.retrieveAssessment(call.Query.Get("host"))
+	case call.ApiCall == observatory.ApiCallGetScanResults && call.Method == http.MethodGet:
+		return s.retrieveTestResults(call.Query.Get("scan"))
+	case call.ApiCall == observatory.ApiCallGetHostHistory && call.Method == http.MethodGet:
+		return s.retrieveHostHistory(call.Query.Get("host"))
+	case call.ApiCall == observatory.ApiCallGetRecentScans && call.Method == http.MethodGet:
+		return s.retrieveRecentScans(call.Query.Get("min"), call.Query.Get("max"))
+	case call.ApiCall == observatory.ApiCallGetGradeDistribution && call.Method == http.MethodGet:
+		return s.retrieveGradeDistribution()
+	default:
+		return http.StatusNotFound, apiError(fmt.Sprintf("unknown-api-call-%s-%s", strings.ToLower(call.Method), call.ApiCall))
+	}
+}
+
+// rateLimited record the request and report whether it exceed the rate limit.
+func (s *Server) rateLimited() bool {
+	if s.rateLimit <= 0 {
+		return false
+	}
+
+	now := s.now()
+	kept := s.requests[:0]
+	for _, t := range s.requests {
+		if now.Sub(t) < s.rateWindow {
+			kept = append(kept, t)
+		}
+	}
+	s.requests = append(kept, now)
+	return len(s.requests) > s.rateLimit
+}
+
+func apiError(code string) map[string]string {
+	return map[string]string{"error": code}
+}
@@ -0,0 +1,163 @@
+package observatorytest
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/option"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTests() *types.ScannerTestResult {
+	tests := new(types.ScannerTestResult)
+	tests.XContentTypeOptions.Result = "x-content-type-options-nosniff"
+	tests.XContentTypeOptions.Pass = true
+	tests.XFrameOptions.Result = "x-frame-options-not-implemented"
+	tests.XFrameOptions.ScoreModifier = -20
+	return tests
+}
+
+func TestServerAnalyze(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddHost(Host{Name: "observatory.mozilla.org", Tests: newTests()})
+
+	c := srv.NewClient()
+	ctx := context.Background()
+	result, err := c.Analyze(ctx, "observatory.mozilla.org", option.WaitFinished(true, time.Millisecond))
+	require.Nil(t, err)
+	assert.Equal(t, observatory.Finished, result.State)
+	assert.Equal(t, types.ScanID(1), result.ScanID)
+	assert.Equal(t, 80, result.Score)
+	assert.Equal(t, "B+", result.Grade)
+	assert.Equal(t, 1, result.TestsPassed)
+	assert.Equal(t, 1, result.TestsFailed)
+
+	calls := srv.CallsTo(observatory.ApiCallAnalyze)
+	require.Len(t, calls, 3)
+	assert.Equal(t, http.MethodPost, calls[0].Method)
+	assert.Equal(t, "observatory.mozilla.org", calls[0].Query.Get("host"))
+	assert.Equal(t, "false", calls[0].Form.Get("rescan"))
+	assert.Equal(t, http.MethodGet, calls[2].Method)
+
+	// A finished scan is returned until a rescan is requested.
+	result, err = c.Analyze(ctx, "observatory.mozilla.org")
+	require.Nil(t, err)
+	assert.Equal(t, types.ScanID(1), result.ScanID)
+	result, err = c.Analyze(ctx, "observatory.mozilla.org", option.ForceRescan(true))
+	require.Nil(t, err)
+	assert.Equal(t, types.ScanID(2), result.ScanID)
+	assert.Equal(t, observatory.Pending, result.State)
+	assert.Equal(t, "", result.Grade)
+
+	tests, err := c.GetTestResults(ctx, 1)
+	require.Nil(t, err)
+	assert.Equal(t, newTests(), tests)
+	tests, err = c.GetTestResults(ctx, 2)
+	require.Nil(t, err)
+	assert.Equal(t, new(types.ScannerTestResult), tests)
+}
+
+func TestServerStates(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddHost(Host{Name: "failed.example.com", States: []string{observatory.Pending, observatory.Failed}})
+	srv.AddHost(Host{Name: "instant.example.com", States: []string{observatory.Finished}})
+
+	c := srv.NewClient()
+	ctx := context.Background()
+	_, err := c.Analyze(ctx, "failed.example.com", option.WaitFinished(true, time.Millisecond))
+	assert.ErrorIs(t, err, observatory.ErrScannerFailed)
+
+	result, err := c.Analyze(ctx, "instant.example.com")
+	require.Nil(t, err)
+	assert.Equal(t, observatory.Finished, result.State)
+	assert.Equal(t, "A+", result.Grade)
+	assert.Equal(t, 3, srv.CallCount(observatory.ApiCallAnalyze))
+}
+
+func TestServerHistory(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+	srv := NewServer()
+	defer srv.Close()
+	srv.SetNow(func() time.Time { return start })
+	srv.AddHost(Host{
+		Name:   "observatory.mozilla.org",
+		Result: types.ScannerResult{Grade: "A", Score: 90},
+		States: []string{observatory.Finished},
+		History: []*types.ScannerHostHistory{
+			{EndTimeUnixTimestamp: int(start.Add(-time.Hour).Unix()), Grade: "C", ScanId: 10, Score: 50},
+		},
+	})
+	srv.AddHost(Host{Name: "hidden.example.com", States: []string{observatory.Finished}})
+
+	c := srv.NewClient()
+	ctx := context.Background()
+	_, err := c.Analyze(ctx, "observatory.mozilla.org")
+	require.Nil(t, err)
+	_, err = c.Analyze(ctx, "hidden.example.com", option.HideResult(true))
+	require.Nil(t, err)
+
+	histories, err := c.GetScanHistory(ctx, "observatory.mozilla.org")
+	require.Nil(t, err)
+	require.Len(t, histories, 2)
+	assert.Equal(t, types.ScanID(10), histories[0].ScanId)
+	assert.Equal(t, types.ScanID(11), histories[1].ScanId)
+
+	recent, err := c.GetRecentScans(ctx, option.WithMinScore(80))
+	require.Nil(t, err)
+	assert.Equal(t, types.ScannerRecentScans{{Host: "observatory.mozilla.org", Grade: "A"}}, recent)
+
+	distribution, err := c.GetGradeDistribution(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, &types.ScannerGradeDistribution{A: 1, A1: 1}, distribution)
+}
+
+func TestServerFault(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.InjectFault(Fault{ApiCall: observatory.ApiCallGetGradeDistribution, StatusCode: http.StatusBadGateway, Times: 1})
+
+	c := srv.NewClient()
+	ctx := context.Background()
+	_, err := c.GetGradeDistribution(ctx)
+	assert.NotNil(t, err)
+	_, err = c.GetGradeDistribution(ctx)
+	assert.Nil(t, err)
+
+	calls := srv.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, http.StatusBadGateway, calls[0].StatusCode)
+	assert.Equal(t, http.StatusOK, calls[1].StatusCode)
+}
+
+func TestServerRateLimit(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.SetRateLimit(2, time.Minute)
+
+	c := srv.NewClient()
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		_, err := c.GetGradeDistribution(ctx)
+		require.Nil(t, err)
+	}
+	_, err := c.GetGradeDistribution(ctx)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, srv.Calls()[2].StatusCode)
+}
+
+func TestServerLatency(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.SetLatency(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := srv.NewClient().GetGradeDistribution(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,203 @@
+package option
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/tigerwill90/observatory/cache"
+	"github.com/tigerwill90/observatory/internal/option"
+	"github.com/tigerwill90/observatory/logging"
+	"github.com/tigerwill90/observatory/middleware"
+	"github.com/tigerwill90/observatory/telemetry"
+	"time"
+)
+
+const (
+	// APIv1 is the original HTTP Observatory api.
+	// https://github.com/mozilla/http-observatory/blob/master/httpobs/docs/api.md
+	APIv1 = option.APIv1
+	// APIv2 is the api of the HTTP Observatory hosted on MDN.
+	// https://developer.mozilla.org/en-US/observatory/docs/api
+	APIv2 = option.APIv2
+)
+
+type clientOptionImpl struct {
+	f func(*option.ClientConfig)
+}
+
+func (c *clientOptionImpl) Apply(o *option.ClientConfig) {
+	c.f(o)
+}
+
+func newClientOptionImpl(f func(*option.ClientConfig)) *clientOptionImpl {
+	return &clientOptionImpl{f: f}
+}
+
+// WithAPIVersion set the version of the api the client talk to. NewClient use the endpoint of the version. With
+// APIv2, scans are synchronous and always visible, so option.HideResult and option.ForceRescan have no effect,
+// GetTestResults only work for the latest scan of a host retrieved by the client, and GetRecentScans is not
+// supported. The responses are mapped onto the v1 types, and the fields only returned by v2 are exposed by
+// types.ScannerResult and types.ScannerTestResult Details. Default to APIv1.
+func WithAPIVersion(v option.APIVersion) option.ClientOption {
+	return newClientOptionImpl(func(o *option.ClientConfig) {
+		o.APIVersion = v
+	})
+}
+
+// WithCache enable the response cache of the client. Detailed test results are cached by scan ID without
+// expiration, while finished assessments and the grade distribution expire according to WithCacheTTL.
+// Use cache.NewLRU for an in-memory cache.
+func WithCache(c cache.Cache) option.ClientOption {
+	return newClientOptionImpl(func(o *option.ClientConfig) {
+		o.Cache = c
+	})
+}
+
+// WithCacheTTL set how long a finished assessment and the grade distribution are cached. An assessment is
+// never cached beyond 24 hours after the end of the scan, since HTTP Observatory stop returning it from
+// its own cache after that. A zero ttl disable the cache for the corresponding call. Default to 24 hours
+// for assessments and 1 hour for the grade distribution.
+func WithCacheTTL(assessment, gradeDistribution time.Duration) option.ClientOption {
+	return newClientOptionImpl(func(o *option.ClientConfig) {
+		o.AssessmentTTL = assessment
+		o.GradeDistributionTTL = gradeDistribution
+	})
+}
+
+// WithTracer enable tracing. Each public method of the client start a span, with a child span for each
+// polling iteration of Analyze and for each HTTP request.
+func WithTracer(t telemetry.Tracer) option.ClientOption {
+	return newClientOptionImpl(func(o *option.ClientConfig) {
+		o.Tracer = t
+	})
+}
+
+// WithMeter enable the recording of request and scan measurements.
+func WithMeter(m telemetry.Meter) option.ClientOption {
+	return newClientOptionImpl(func(o *option.ClientConfig) {
+		o.Meter = m
+	})
+}
+
+// WithLogger enable structured logging of requests, responses, polling iterations and cache lookups. Records
+// below the minimum level are discarded before being built. Every record carry the host and the scan ID,
+// when known.
+func WithLogger(l logging.Logger, level logging.Level) option.ClientOption {
+	return newClientOptionImpl(func(o *option.ClientConfig) {
+		o.Logger = l
+		o.LogLevel = level
+	})
+}
+
+// WithMiddleware add middlewares around every api call. Middlewares run in the order they are added, the first
+// one being the outermost, and inside the client own logging and metrics, so an injected failure is reported
+// like any other. See the middleware package for the built-in middlewares.
+func WithMiddleware(mws ...middleware.Middleware) option.ClientOption {
+	return newClientOptionImpl(func(o *option.ClientConfig) {
+		o.Middlewares = append(o.Middlewares, mws...)
+	})
+}
+
+// WithBearerToken authenticate every request with the token in the Authorization header, e.g. for a deployment
+// behind an authenticating reverse proxy. The header is set on the HTTP request once the middlewares ran, so that
+// they never see the token. It replaces WithBasicAuth.
+func WithBearerToken(token string) option.ClientOption {
+	return newClientOptionImpl(func(o *option.ClientConfig) {
+		o.BearerToken = token
+		o.BasicAuth = nil
+	})
+}
+
+// WithBasicAuth authenticate every request with the HTTP basic authentication scheme. Like WithBearerToken, the
+// credentials are never seen by the middlewares. It replaces WithBearerToken.
+func WithBasicAuth(username, password string) option.ClientOption {
+	return newClientOptionImpl(func(o *option.ClientConfig) {
+		o.BasicAuth = &option.BasicAuth{Username: username, Password: password}
+		o.BearerToken = ""
+	})
+}
+
+// WithClientCertificate authenticate the client with the certificates during the TLS handshake (mTLS). Use
+// tls.LoadX509KeyPair to load a certificate and its key from PEM files. See WithRootCAs for how TLS options
+// apply to the http.Client of NewCustomClient.
+func WithClientCertificate(certs ...tls.Certificate) option.ClientOption {
+	return newClientOptionImpl(func(o *option.ClientConfig) {
+		o.TLSConfig = tlsConfig(o)
+		o.TLSConfig.Certificates = append(o.TLSConfig.Certificates, certs...)
+	})
+}
+
+// WithRootCAs verify the server certificate against the pool instead of the system pool, e.g. for a deployment
+// on a private CA. Use observatory.LoadCABundle to load a pool from PEM files. TLS options apply to a copy of the
+// http.Client given to NewCustomClient whose transport is nil or an *http.Transport, other transports are
+// used as is.
+func WithRootCAs(pool *x509.CertPool) option.ClientOption {
+	return newClientOptionImpl(func(o *option.ClientConfig) {
+		o.TLSConfig = tlsConfig(o)
+		o.TLSConfig.RootCAs = pool
+	})
+}
+
+func tlsConfig(o *option.ClientConfig) *tls.Config {
+	if o.TLSConfig == nil {
+		return &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return o.TLSConfig
+}
+
+// WithFallbackEndpoints add api endpoints to fail over to, in order, when the endpoint of the client is down,
+// e.g. the public instance as a fallback of an internal one. A call is sent to the first endpoint whose circuit
+// breaker is closed, and to the next one on a 5xx response, a timeout or a connection error. An endpoint
+// failing 5 times in a row is skipped for 30 seconds, see WithCircuitBreaker. The calls about a scan, such as the polling of Analyze,
+// GetAssessment, GetScanHistory and GetTestResults, are sent to the endpoint that made the latest scan of the host,
+// or the scan, without failover, since the other endpoints do not know it. The credentials of the client are only
+// sent to the endpoints on the same host as the endpoint of the client, use the user info of the url otherwise.
+func WithFallbackEndpoints(urls ...string) option.ClientOption {
+	return newClientOptionImpl(func(o *option.ClientConfig) {
+		o.FallbackEndpoints = append(o.FallbackEndpoints, urls...)
+	})
+}
+
+// WithCircuitBreaker enable a circuit breaker on the endpoint of the client, so that calls fail fast with
+// observatory.ErrCircuitOpen instead of waiting for the timeout of a down endpoint. The circuit opens after
+// threshold consecutive 5xx responses, timeouts or connection errors, then let a single probe call through once
+// the cooldown elapsed: the circuit closes if the probe succeed, and opens again otherwise. Calls canceled by the
+// caller are not counted. It also configures the circuit breakers of WithFallbackEndpoints, which are always
+// enabled. A zero threshold or cooldown default to 5 failures and 30 seconds.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) option.ClientOption {
+	return newClientOptionImpl(func(o *option.ClientConfig) {
+		o.CircuitBreaker = &option.CircuitBreaker{Threshold: threshold, Cooldown: cooldown}
+	})
+}
+
+// WithCircuitStateHook register a function called on each state change of the circuit breaker of an endpoint,
+// e.g. to alert when the endpoint is down. The states are observatory.CircuitClosed, observatory.CircuitOpen and
+// observatory.CircuitHalfOpen. The function is called synchronously by the call that changed the state, and
+// must not block. State changes are also logged, and recorded by a meter implementing telemetry.CircuitMeter.
+func WithCircuitStateHook(f func(endpoint, from, to string)) option.ClientOption {
+	return newClientOptionImpl(func(o *option.ClientConfig) {
+		o.CircuitStateHook = f
+	})
+}
+
+// WithDeduplication enable or disable the coalescing of identical concurrent calls. When enabled, concurrent
+// requests with the same api call and parameters are sent once, through a single run of the middlewares, and
+// each caller get its own copy of the decoded result. Concurrent calls to Analyze waiting for the scan of the same
+// host share a single polling loop, at the interval of the first caller. A caller canceling its context does not
+// affect the others, and the shared request or polling loop is only canceled once every caller left. Default to
+// enabled.
+func WithDeduplication(enabled bool) option.ClientOption {
+	return newClientOptionImpl(func(o *option.ClientConfig) {
+		o.Deduplication = enabled
+	})
+}
+
+// WithHostValidation enable or disable the normalization of the host given to Analyze, GetAssessment and
+// GetScanHistory with hostname.Normalize. When enabled, URLs, ports and upper case are accepted and stripped, and
+// hosts that HTTP Observatory refuse to scan, such as IP addresses and localhost, fail with an error wrapping
+// hostname.ErrInvalidHost without calling the api. Disable it for a self-hosted instance scanning private hosts.
+// Default to enabled.
+func WithHostValidation(enabled bool) option.ClientOption {
+	return newClientOptionImpl(func(o *option.ClientConfig) {
+		o.HostValidation = enabled
+	})
+}
@@ -51,16 +51,44 @@ func newRecentScanOptionImpl(f func(*option.RecentScanOption)) *recentScanOption
 	return &recentScanOptionImpl{f: f}
 }
 
-// WithMinScore set minimum score to retrieve.
+// WithMinScore set minimum score to retrieve. It can be combined with WithMaxScore.
 func WithMinScore(min uint) option.ScanOption {
 	return newRecentScanOptionImpl(func(o *option.RecentScanOption) {
 		o.Min = min
 	})
 }
 
-// WithMaxScore set maximum score to retrieve.
+// WithMaxScore set maximum score to retrieve. It can be combined with WithMinScore.
 func WithMaxScore(max uint) option.ScanOption {
 	return newRecentScanOptionImpl(func(o *option.RecentScanOption) {
 		o.Max = max
 	})
 }
+
+// WithGrades only keep the scans with one of the grades, such as "A+" or "B-". The api does not filter by grade,
+// so fewer than ten scans may be returned.
+func WithGrades(grades ...string) option.ScanOption {
+	return newRecentScanOptionImpl(func(o *option.RecentScanOption) {
+		o.Grades = append(o.Grades, grades...)
+	})
+}
+
+type statsOptionImpl struct {
+	f func(*option.ScannerStatsOption)
+}
+
+func (s *statsOptionImpl) Apply(o *option.ScannerStatsOption) {
+	s.f(o)
+}
+
+func newStatsOptionImpl(f func(*option.ScannerStatsOption)) *statsOptionImpl {
+	return &statsOptionImpl{f: f}
+}
+
+// WithVerbose ask for the verbose statistics, which include the number of scans per hour over the last 24 hours.
+// HTTP Observatory may only honor it for requests from the scanner host.
+func WithVerbose(verbose bool) option.StatsOption {
+	return newStatsOptionImpl(func(o *option.ScannerStatsOption) {
+		o.Verbose = verbose
+	})
+}
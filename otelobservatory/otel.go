@@ -0,0 +1,152 @@
+// Package otelobservatory adapt OpenTelemetry to the telemetry hooks of the HTTP Observatory client.
+//
+//	c := observatory.NewClient(
+//		option.WithTracer(otelobservatory.NewTracer(otel.GetTracerProvider())),
+//		option.WithMeter(meter),
+//	)
+//
+// where meter is created with NewMeter(otel.GetMeterProvider()).
+package otelobservatory
+
+import (
+	"context"
+	"github.com/tigerwill90/observatory/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// ScopeName is the instrumentation scope of the tracer and meter.
+const ScopeName = "github.com/tigerwill90/observatory"
+
+type tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer return a telemetry.Tracer that start OpenTelemetry spans from the tracer provider.
+func NewTracer(tp trace.TracerProvider) telemetry.Tracer {
+	return &tracer{tracer: tp.Tracer(ScopeName)}
+}
+
+func (t *tracer) Start(ctx context.Context, name string, attrs ...telemetry.Attribute) (context.Context, telemetry.Span) {
+	ctx, s := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(convert(attrs)...))
+	return ctx, &span{span: s}
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (s *span) SetAttributes(attrs ...telemetry.Attribute) {
+	s.span.SetAttributes(convert(attrs)...)
+}
+
+func (s *span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s *span) End() {
+	s.span.End()
+}
+
+func convert(attrs []telemetry.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		switch v := attr.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(attr.Key, v))
+		case int:
+			kvs = append(kvs, attribute.Int(attr.Key, v))
+		case bool:
+			kvs = append(kvs, attribute.Bool(attr.Key, v))
+		}
+	}
+	return kvs
+}
+
+type meter struct {
+	requests        metric.Int64Counter
+	requestDuration metric.Float64Histogram
+	scanDuration    metric.Float64Histogram
+	circuitChanges  metric.Int64Counter
+}
+
+var _ telemetry.CircuitMeter = (*meter)(nil)
+
+// NewMeter return a telemetry.Meter that record the following OpenTelemetry instruments from the meter provider:
+//   - observatory.client.requests: number of HTTP requests sent to the api
+//   - observatory.client.request.duration: latency of the HTTP requests, in seconds
+//   - observatory.client.scan.duration: time spent by Client.Analyze waiting for a scan, in seconds
+//   - observatory.client.circuit.changes: number of state changes of the circuit breakers, by endpoint and new state
+func NewMeter(mp metric.MeterProvider) (telemetry.Meter, error) {
+	m := mp.Meter(ScopeName)
+	requests, err := m.Int64Counter(
+		"observatory.client.requests",
+		metric.WithDescription("Number of HTTP requests sent to the HTTP Observatory api."),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	requestDuration, err := m.Float64Histogram(
+		"observatory.client.request.duration",
+		metric.WithDescription("Latency of the HTTP requests sent to the HTTP Observatory api."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	scanDuration, err := m.Float64Histogram(
+		"observatory.client.scan.duration",
+		metric.WithDescription("Time spent waiting for a scan to complete."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	circuitChanges, err := m.Int64Counter(
+		"observatory.client.circuit.changes",
+		metric.WithDescription("Number of state changes of the circuit breakers of the HTTP Observatory api endpoints."),
+		metric.WithUnit("{change}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &meter{
+		requests:        requests,
+		requestDuration: requestDuration,
+		scanDuration:    scanDuration,
+		circuitChanges:  circuitChanges,
+	}, nil
+}
+
+func (m *meter) RecordRequest(ctx context.Context, apiCall, method string, statusCode int, duration time.Duration, err error) {
+	attrs := metric.WithAttributes(
+		attribute.String(telemetry.KeyApiCall, apiCall),
+		attribute.String(telemetry.KeyMethod, method),
+		attribute.Int(telemetry.KeyStatusCode, statusCode),
+		attribute.Bool("error", err != nil),
+	)
+	m.requests.Add(ctx, 1, attrs)
+	m.requestDuration.Record(ctx, duration.Seconds(), attrs)
+}
+
+func (m *meter) RecordScan(ctx context.Context, host, state string, duration time.Duration, err error) {
+	m.scanDuration.Record(ctx, duration.Seconds(), metric.WithAttributes(
+		attribute.String(telemetry.KeyHost, host),
+		attribute.String(telemetry.KeyState, state),
+		attribute.Bool("error", err != nil),
+	))
+}
+
+func (m *meter) RecordCircuitState(ctx context.Context, endpoint, from, to string) {
+	m.circuitChanges.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("observatory.endpoint", endpoint),
+		attribute.String("observatory.circuit.from", from),
+		attribute.String("observatory.circuit.to", to),
+	))
+}
@@ -0,0 +1,62 @@
+package otelobservatory
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/option"
+	"github.com/tigerwill90/observatory/types"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInstrumentation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := &types.ScannerResult{ScanID: 42, State: observatory.Finished}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer srv.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	meter, err := NewMeter(mp)
+	require.Nil(t, err)
+
+	c := observatory.NewCustomClient(srv.Client(), srv.URL, option.WithTracer(NewTracer(tp)), option.WithMeter(meter))
+	_, err = c.GetAssessment(context.Background(), "observatory.mozilla.org")
+	require.Nil(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	attempt, request, assessment := spans[0], spans[1], spans[2]
+	assert.Equal(t, "observatory.attempt", attempt.Name())
+	assert.Equal(t, request.SpanContext().SpanID(), attempt.Parent().SpanID())
+	assert.Contains(t, attempt.Attributes(), attribute.String("observatory.endpoint", srv.URL))
+	assert.Contains(t, attempt.Attributes(), attribute.String("observatory.outcome", "success"))
+	assert.Equal(t, "observatory.request", request.Name())
+	assert.Equal(t, assessment.SpanContext().SpanID(), request.Parent().SpanID())
+	assert.Equal(t, "observatory.GetAssessment", assessment.Name())
+	assert.Contains(t, assessment.Attributes(), attribute.String("observatory.host", "observatory.mozilla.org"))
+	assert.Contains(t, assessment.Attributes(), attribute.Int("observatory.scan_id", 42))
+
+	var rm metricdata.ResourceMetrics
+	require.Nil(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	names := make([]string, 0)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		names = append(names, m.Name)
+	}
+	assert.ElementsMatch(t, []string{"observatory.client.requests", "observatory.client.request.duration"}, names)
+}
@@ -0,0 +1,272 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/tigerwill90/observatory/grader"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	opEqual        = "=="
+	opNotEqual     = "!="
+	opGreater      = ">"
+	opGreaterEqual = ">="
+	opLess         = "<"
+	opLessEqual    = "<="
+	opIn           = "in"
+	opNotIn        = "not in"
+	opContains     = "contains"
+	opMatches      = "matches"
+)
+
+// condition is a compiled rule expression, comparing the value found at a field path with an operand.
+type condition struct {
+	field   string
+	path    []string
+	op      string
+	operand interface{}
+	re      *regexp.Regexp
+}
+
+// parseCondition compile an expression of the form "<field> <operator> <operand>".
+func parseCondition(expr string) (*condition, error) {
+	expr = strings.TrimSpace(expr)
+	i := strings.IndexAny(expr, " \t")
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %q: missing operator", ErrInvalidExpr, expr)
+	}
+	field, rest := expr[:i], strings.TrimSpace(expr[i:])
+
+	var op string
+	for _, candidate := range []string{opEqual, opNotEqual, opGreaterEqual, opLessEqual, opGreater, opLess, opNotIn, opIn, opContains, opMatches} {
+		if !strings.HasPrefix(rest, candidate) {
+			continue
+		}
+		// word operators must be followed by a space
+		if isWord(candidate) && (len(rest) == len(candidate) || (rest[len(candidate)] != ' ' && rest[len(candidate)] != '\t')) {
+			continue
+		}
+		op = candidate
+		break
+	}
+	if op == "" {
+		return nil, fmt.Errorf("%w: %q: unknown operator", ErrInvalidExpr, expr)
+	}
+	raw := strings.TrimSpace(rest[len(op):])
+	if raw == "" {
+		return nil, fmt.Errorf("%w: %q: missing operand", ErrInvalidExpr, expr)
+	}
+
+	c := &condition{field: field, path: strings.Split(field, "."), op: op}
+	if err := validatePath(c.path); err != nil {
+		return nil, fmt.Errorf("%w: %q: %s", ErrInvalidExpr, expr, err)
+	}
+
+	var err error
+	switch op {
+	case opIn, opNotIn:
+		if c.operand, err = parseList(raw); err != nil {
+			return nil, fmt.Errorf("%w: %q: %s", ErrInvalidExpr, expr, err)
+		}
+	case opMatches:
+		pattern, ok := parseScalar(raw).(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q: matches require a string pattern", ErrInvalidExpr, expr)
+		}
+		if c.re, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("%w: %q: %s", ErrInvalidExpr, expr, err)
+		}
+		c.operand = pattern
+	case opGreater, opGreaterEqual, opLess, opLessEqual:
+		c.operand = parseScalar(raw)
+		if c.isGrade() {
+			grade, ok := c.operand.(string)
+			if !ok || grader.Rank(grade) == 0 {
+				return nil, fmt.Errorf("%w: %q: unknown grade %s", ErrInvalidExpr, expr, raw)
+			}
+		} else if _, ok := c.operand.(float64); !ok {
+			return nil, fmt.Errorf("%w: %q: %s require a number", ErrInvalidExpr, expr, op)
+		}
+	default:
+		c.operand = parseScalar(raw)
+	}
+	return c, nil
+}
+
+func isWord(op string) bool {
+	return op == opIn || op == opNotIn || op == opContains || op == opMatches
+}
+
+// isGrade return true if the field is a grade, which is ordered from F to A+ rather than lexically.
+func (c *condition) isGrade() bool {
+	return c.path[len(c.path)-1] == "grade"
+}
+
+// eval compare the actual value with the operand. The explanation describe the actual value and what
+// was expected.
+func (c *condition) eval(actual interface{}, found bool) (bool, string) {
+	if !found || actual == nil {
+		return false, fmt.Sprintf("%s is not set, want %s %s", c.field, c.op, format(c.operand))
+	}
+
+	var pass bool
+	switch c.op {
+	case opEqual:
+		pass = equal(actual, c.operand)
+	case opNotEqual:
+		pass = !equal(actual, c.operand)
+	case opIn, opNotIn:
+		for _, v := range c.operand.([]interface{}) {
+			if equal(actual, v) {
+				pass = true
+				break
+			}
+		}
+		if c.op == opNotIn {
+			pass = !pass
+		}
+	case opContains:
+		switch actual := actual.(type) {
+		case string:
+			s, ok := c.operand.(string)
+			pass = ok && strings.Contains(actual, s)
+		case []interface{}:
+			for _, v := range actual {
+				if equal(v, c.operand) {
+					pass = true
+					break
+				}
+			}
+		}
+	case opMatches:
+		s, ok := actual.(string)
+		pass = ok && c.re.MatchString(s)
+	default:
+		cmp, ok := c.compare(actual)
+		if !ok {
+			return false, fmt.Sprintf("%s is %s, which can not be compared with %s", c.field, format(actual), format(c.operand))
+		}
+		switch c.op {
+		case opGreater:
+			pass = cmp > 0
+		case opGreaterEqual:
+			pass = cmp >= 0
+		case opLess:
+			pass = cmp < 0
+		case opLessEqual:
+			pass = cmp <= 0
+		}
+	}
+
+	if pass {
+		return true, fmt.Sprintf("%s is %s, %s %s", c.field, format(actual), c.op, format(c.operand))
+	}
+	return false, fmt.Sprintf("%s is %s, want %s %s", c.field, format(actual), c.op, format(c.operand))
+}
+
+// compare return -1, 0 or 1 if the actual value is lower, equal or greater than the operand, or false if
+// they can not be ordered.
+func (c *condition) compare(actual interface{}) (int, bool) {
+	var a, b float64
+	if c.isGrade() {
+		grade, ok := actual.(string)
+		if !ok || grader.Rank(grade) == 0 {
+			return 0, false
+		}
+		a, b = float64(grader.Rank(grade)), float64(grader.Rank(c.operand.(string)))
+	} else {
+		n, ok := actual.(float64)
+		if !ok {
+			return 0, false
+		}
+		a, b = n, c.operand.(float64)
+	}
+
+	switch {
+	case a < b:
+		return -1, true
+	case a > b:
+		return 1, true
+	default:
+		return 0, true
+	}
+}
+
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// parseScalar parse a quoted string, a boolean, a number or a bare string.
+func parseScalar(raw string) interface{} {
+	raw = strings.TrimSpace(raw)
+	if len(raw) >= 2 && (raw[0] == '"' || raw[0] == '\'') && raw[len(raw)-1] == raw[0] {
+		if raw[0] == '"' {
+			if s, err := strconv.Unquote(raw); err == nil {
+				return s
+			}
+		}
+		return raw[1 : len(raw)-1]
+	}
+	switch raw {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if n, err := strconv.ParseFloat(raw, 64); err == nil {
+		return n
+	}
+	return raw
+}
+
+// parseList parse a list of comma separated scalars between brackets. Commas within quotes are kept.
+func parseList(raw string) ([]interface{}, error) {
+	if !strings.HasPrefix(raw, "[") || !strings.HasSuffix(raw, "]") {
+		return nil, fmt.Errorf("operand must be a list, such as [a, b]")
+	}
+	raw = strings.TrimSpace(raw[1 : len(raw)-1])
+
+	list := make([]interface{}, 0)
+	if raw == "" {
+		return list, nil
+	}
+	var quote byte
+	start := 0
+	for i := 0; i <= len(raw); i++ {
+		if i == len(raw) || (raw[i] == ',' && quote == 0) {
+			list = append(list, parseScalar(raw[start:i]))
+			start = i + 1
+			continue
+		}
+		switch {
+		case quote == 0 && (raw[i] == '"' || raw[i] == '\''):
+			quote = raw[i]
+		case quote != 0 && raw[i] == quote:
+			quote = 0
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	return list, nil
+}
+
+func format(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, format(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,311 @@
+// Package policy evaluate scans against security requirements expressed declaratively in YAML or JSON. A rule is an
+// expression comparing a field of the scan result or of a test result with a value, such as "grade >= A-",
+// "strict-transport-security.output.max-age >= 31536000" or "cookies.pass == true", optionally scoped to hosts
+// matching glob patterns.
+//
+// Fields are addressed by their JSON name: the fields of the scan result, such as grade, score or
+// response_headers.<name>, and the fields of each test, as <test>.<field>, where output can be followed by the path
+// of a value within the test output. Supported operators are ==, !=, >, >=, <, <=, in, not in, contains and
+// matches. Grades are ordered from F to A+, and the operand of in and not in is a list, such as [a, b].
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tigerwill90/observatory/baseline"
+	"github.com/tigerwill90/observatory/types"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"strings"
+)
+
+var (
+	ErrInvalidExpr   = errors.New("invalid rule expression")
+	ErrInvalidPolicy = errors.New("invalid policy")
+)
+
+// Rule is a requirement that a scan must satisfy.
+type Rule struct {
+	// name of the rule, default to its expression
+	Name string `yaml:"name" json:"name,omitempty"`
+	// why the rule exist, for reports
+	Description string `yaml:"description" json:"description,omitempty"`
+	// glob patterns, as in path.Match, of the hosts the rule apply to, every host if empty
+	Hosts []string `yaml:"hosts" json:"hosts,omitempty"`
+	// expression of the form "<field> <operator> <operand>"
+	Expr string `yaml:"expr" json:"expr"`
+	cond *condition
+}
+
+// NewRule return a compiled rule.
+func NewRule(name, expr string, hosts ...string) (*Rule, error) {
+	r := &Rule{Name: name, Expr: expr, Hosts: hosts}
+	if err := r.compile(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// UnmarshalYAML decode and compile a rule.
+func (r *Rule) UnmarshalYAML(value *yaml.Node) error {
+	type plain Rule
+	if err := value.Decode((*plain)(r)); err != nil {
+		return err
+	}
+	return r.compile()
+}
+
+func (r *Rule) compile() error {
+	cond, err := r.condition()
+	if err != nil {
+		return err
+	}
+	r.cond = cond
+	return nil
+}
+
+// condition validate the rule and return its parsed condition, without modifying the rule.
+func (r *Rule) condition() (*condition, error) {
+	for _, pattern := range r.Hosts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%w: rule %s: bad host pattern %q", ErrInvalidPolicy, r.title(), pattern)
+		}
+	}
+	return parseCondition(r.Expr)
+}
+
+func (r *Rule) title() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Expr
+}
+
+// Match return true if the rule apply to the host.
+func (r *Rule) Match(host string) bool {
+	if len(r.Hosts) == 0 {
+		return true
+	}
+	for _, pattern := range r.Hosts {
+		if ok, _ := path.Match(pattern, strings.ToLower(host)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy is a set of rules.
+type Policy struct {
+	Rules []*Rule `yaml:"rules" json:"rules"`
+}
+
+// Parse decode a YAML or JSON policy and compile its rules.
+func Parse(data []byte) (*Policy, error) {
+	p := new(Policy)
+	if err := yaml.Unmarshal(data, p); err != nil {
+		if errors.Is(err, ErrInvalidExpr) || errors.Is(err, ErrInvalidPolicy) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPolicy, err)
+	}
+	return p, nil
+}
+
+// Validate compile every rule, which is only required for a policy that was not parsed, and must be done before
+// evaluating the policy concurrently.
+func (p *Policy) Validate() error {
+	for _, r := range p.Rules {
+		if err := r.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load read and parse the policy file at path.
+func Load(path string) (*Policy, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read policy: %w", err)
+	}
+	return Parse(buf)
+}
+
+// Outcome is the evaluation of a rule.
+type Outcome struct {
+	Rule        string `json:"rule"`
+	Expr        string `json:"expr"`
+	Description string `json:"description,omitempty"`
+	Pass        bool   `json:"pass"`
+	// test the rule is about, if any
+	Test string `json:"test,omitempty"`
+	// whether the rule failed on a test whose failure is waived
+	Waived bool             `json:"waived,omitempty"`
+	Waiver *baseline.Waiver `json:"waiver,omitempty"`
+	// value found at the field path, if any
+	Actual interface{} `json:"actual,omitempty"`
+	// human readable explanation of the outcome
+	Explanation string `json:"explanation"`
+}
+
+// Report hold the outcome of every rule that apply to a host, in the order of the policy.
+type Report struct {
+	Host     string    `json:"host"`
+	Outcomes []Outcome `json:"outcomes"`
+}
+
+// Passed return true if every rule passed or is waived.
+func (r *Report) Passed() bool {
+	return len(r.Failures()) == 0
+}
+
+// Failures return the outcome of the rules that failed and are not waived.
+func (r *Report) Failures() []Outcome {
+	failures := make([]Outcome, 0)
+	for _, o := range r.Outcomes {
+		if !o.Pass && !o.Waived {
+			failures = append(failures, o)
+		}
+	}
+	return failures
+}
+
+// Evaluate evaluate the rules that apply to the host against a scan result and its test results. Rules on
+// test fields fail if tests is nil. A rule that was not compiled, see Validate, is parsed on each evaluation, and
+// fail if invalid.
+func (p *Policy) Evaluate(host string, result *types.ScannerResult, tests *types.ScannerTestResult) *Report {
+	doc := document(result, tests)
+	report := &Report{Host: host, Outcomes: make([]Outcome, 0, len(p.Rules))}
+	for _, r := range p.Rules {
+		if !r.Match(host) {
+			continue
+		}
+		outcome := Outcome{Rule: r.title(), Expr: r.Expr, Description: r.Description}
+		cond := r.cond
+		if cond == nil {
+			var err error
+			if cond, err = r.condition(); err != nil {
+				outcome.Explanation = err.Error()
+				report.Outcomes = append(report.Outcomes, outcome)
+				continue
+			}
+		}
+		if types.IsTest(cond.path[0]) {
+			outcome.Test = cond.path[0]
+		}
+		actual, found := lookup(doc, cond.path)
+		outcome.Actual = actual
+		outcome.Pass, outcome.Explanation = cond.eval(actual, found)
+		report.Outcomes = append(report.Outcomes, outcome)
+	}
+	return report
+}
+
+// Waive mark as waived the failed rules about a test whose failure is waived in the baseline report of the
+// same host.
+func (r *Report) Waive(b *baseline.Report) {
+	for i, o := range r.Outcomes {
+		if o.Pass || o.Test == "" {
+			continue
+		}
+		if t, ok := b.Outcome(o.Test); ok && t.Status == baseline.StatusWaived {
+			r.Outcomes[i].Waived = true
+			r.Outcomes[i].Waiver = t.Waiver
+		}
+	}
+}
+
+var testFields = map[string]bool{
+	"expectation":       true,
+	"name":              true,
+	"output":            true,
+	"pass":              true,
+	"result":            true,
+	"score_description": true,
+	"score_modifier":    true,
+}
+
+// resultFields hold the JSON name of every field of the scan result, read from the struct tags rather than from a
+// marshalled result, which would omit the empty v2 fields.
+var resultFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(types.ScannerResult{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// validatePath check that a field path start with a scan result field, or with a test name and field.
+func validatePath(p []string) error {
+	switch {
+	case resultFields[p[0]]:
+		return nil
+	case types.IsTest(p[0]):
+		if len(p) < 2 || !testFields[p[1]] {
+			return fmt.Errorf("%s must be followed by a test field, such as pass or result", p[0])
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown field %s", p[0])
+	}
+}
+
+// document merge the scan result and the test results into a single JSON object, so that every field
+// is addressed by its JSON path.
+func document(result *types.ScannerResult, tests *types.ScannerTestResult) map[string]interface{} {
+	doc := make(map[string]interface{})
+	if tests != nil {
+		for key, value := range toMap(tests) {
+			doc[key] = value
+		}
+	}
+	if result != nil {
+		for key, value := range toMap(result) {
+			doc[key] = value
+		}
+	}
+	return doc
+}
+
+func toMap(v interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return m
+	}
+	_ = json.Unmarshal(buf, &m)
+	return m
+}
+
+// lookup return the value at the path. Keys are matched case-insensitively when there is no exact match,
+// since header names are case-insensitive.
+func lookup(doc map[string]interface{}, p []string) (interface{}, bool) {
+	var v interface{} = doc
+	for _, key := range p {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; ok {
+			continue
+		}
+		found := false
+		for k, value := range m {
+			if strings.EqualFold(k, key) {
+				v, found = value, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return v, true
+}
@@ -0,0 +1,206 @@
+package policy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory/baseline"
+	"github.com/tigerwill90/observatory/types"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newScan() (*types.ScannerResult, *types.ScannerTestResult) {
+	result := &types.ScannerResult{
+		Grade:           "B+",
+		Score:           80,
+		State:           "FINISHED",
+		ResponseHeaders: map[string]string{"Server": "nginx"},
+	}
+	tests := new(types.ScannerTestResult)
+	tests.StrictTransportSecurity.Pass = true
+	tests.StrictTransportSecurity.Result = "hsts-implemented-max-age-at-least-six-months"
+	tests.StrictTransportSecurity.Output.MaxAge = 15768000
+	tests.ContentSecurityPolicy.Result = "csp-implemented-with-unsafe-inline"
+	tests.Cookies.Pass = true
+	tests.Cookies.Result = "cookies-not-found"
+	return result, tests
+}
+
+func TestParseCondition(t *testing.T) {
+	cases := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{name: "grade", expr: "grade >= A-"},
+		{name: "test output", expr: "strict-transport-security.output.max-age >= 31536000"},
+		{name: "list", expr: `content-security-policy.result in [csp-implemented-with-no-unsafe, "a, b"]`},
+		{name: "not in", expr: "grade not in [F, D]"},
+		{name: "matches", expr: `response_headers.server matches "^nginx"`},
+		{name: "v2 field", expr: "algorithm_version >= 4"},
+		{name: "missing operator", expr: "grade", wantErr: true},
+		{name: "unknown operator", expr: "grade ~ A", wantErr: true},
+		{name: "missing operand", expr: "grade ==", wantErr: true},
+		{name: "unknown field", expr: "foo == 1", wantErr: true},
+		{name: "test without field", expr: "cookies == true", wantErr: true},
+		{name: "unknown grade", expr: "grade >= Z", wantErr: true},
+		{name: "not a number", expr: "score > abc", wantErr: true},
+		{name: "not a list", expr: "grade in A", wantErr: true},
+		{name: "bad regexp", expr: "state matches (", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseCondition(tc.expr)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidExpr)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	result, tests := newScan()
+
+	cases := []struct {
+		name     string
+		expr     string
+		hosts    []string
+		want     bool
+		skipped  bool
+		explains string
+	}{
+		{name: "grade below", expr: "grade >= A-", explains: "grade is B+, want >= A-"},
+		{name: "grade above", expr: "grade > B", want: true, explains: "grade is B+, > B"},
+		{name: "score", expr: "score <= 80", want: true},
+		{name: "max age", expr: "strict-transport-security.output.max-age >= 31536000", explains: "strict-transport-security.output.max-age is 15768000, want >= 31536000"},
+		{name: "in", expr: "content-security-policy.result in [csp-implemented-with-no-unsafe, csp-implemented-with-unsafe-inline]", want: true},
+		{name: "not in", expr: "content-security-policy.result not in [csp-implemented-with-unsafe-inline]"},
+		{name: "bool", expr: "cookies.pass == true", want: true},
+		{name: "not equal", expr: "state != FINISHED"},
+		{name: "contains", expr: "strict-transport-security.result contains six-months", want: true},
+		{name: "header case insensitive", expr: `response_headers.server matches "^nginx"`, want: true},
+		{name: "missing field", expr: "response_headers.x-frame-options == DENY", explains: "response_headers.x-frame-options is not set, want == DENY"},
+		{name: "host match", expr: "grade == A+", hosts: []string{"*.example.com"}, skipped: true},
+		{name: "host match", expr: "grade == B+", hosts: []string{"*.example.com", "observatory.*"}, want: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRule("", tc.expr, tc.hosts...)
+			require.Nil(t, err)
+			p := &Policy{Rules: []*Rule{r}}
+			report := p.Evaluate("observatory.mozilla.org", result, tests)
+			if tc.skipped {
+				assert.Empty(t, report.Outcomes)
+				return
+			}
+			require.Len(t, report.Outcomes, 1)
+			assert.Equal(t, tc.want, report.Outcomes[0].Pass, report.Outcomes[0].Explanation)
+			assert.Equal(t, tc.want, report.Passed())
+			if tc.explains != "" {
+				assert.Equal(t, tc.explains, report.Outcomes[0].Explanation)
+			}
+		})
+	}
+}
+
+func TestEvaluateWithoutTests(t *testing.T) {
+	result, _ := newScan()
+	r, err := NewRule("cookies", "cookies.pass == true")
+	require.Nil(t, err)
+
+	report := (&Policy{Rules: []*Rule{r}}).Evaluate("observatory.mozilla.org", result, nil)
+	require.Len(t, report.Failures(), 1)
+	assert.Equal(t, "cookies", report.Failures()[0].Rule)
+	assert.Equal(t, "cookies.pass is not set, want == true", report.Failures()[0].Explanation)
+}
+
+func TestEvaluateLiteral(t *testing.T) {
+	result, tests := newScan()
+	p := &Policy{Rules: []*Rule{{Name: "grade", Expr: "grade >= B"}, {Name: "bad", Expr: "grade >>> A"}}}
+
+	// A rule that was not compiled is evaluated concurrently without being modified.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report := p.Evaluate("observatory.mozilla.org", result, tests)
+			assert.Len(t, report.Outcomes, 2)
+			assert.Len(t, report.Failures(), 1)
+		}()
+	}
+	wg.Wait()
+	assert.Nil(t, p.Rules[0].cond)
+
+	assert.ErrorIs(t, p.Validate(), ErrInvalidExpr)
+	p.Rules = p.Rules[:1]
+	require.Nil(t, p.Validate())
+	assert.NotNil(t, p.Rules[0].cond)
+}
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(`
+rules:
+  - name: grade
+    description: every host must score at least A-
+    expr: grade >= A-
+  - name: hsts
+    hosts: ["*.mozilla.org"]
+    expr: strict-transport-security.output.max-age >= 31536000
+`))
+	require.Nil(t, err)
+	require.Len(t, p.Rules, 2)
+	assert.Equal(t, "every host must score at least A-", p.Rules[0].Description)
+	assert.Equal(t, []string{"*.mozilla.org"}, p.Rules[1].Hosts)
+
+	result, tests := newScan()
+	report := p.Evaluate("observatory.mozilla.org", result, tests)
+	assert.Len(t, report.Outcomes, 2)
+	assert.Len(t, report.Failures(), 2)
+	assert.Len(t, p.Evaluate("example.com", result, tests).Outcomes, 1)
+
+	p, err = Parse([]byte(`{"rules": [{"expr": "cookies.pass == true"}]}`))
+	require.Nil(t, err)
+	assert.True(t, p.Evaluate("example.com", result, tests).Passed())
+
+	_, err = Parse([]byte("rules:\n  - expr: foo == 1\n"))
+	assert.ErrorIs(t, err, ErrInvalidExpr)
+
+	_, err = Parse([]byte("rules:\n  - expr: grade == A\n    hosts: ['[']\n"))
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+
+	_, err = Parse([]byte("rules: 1"))
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+}
+
+func TestWaive(t *testing.T) {
+	result, tests := newScan()
+	p, err := Parse([]byte("rules:\n  - expr: content-security-policy.pass == true\n  - expr: grade >= A\n"))
+	require.Nil(t, err)
+	b, err := baseline.Parse([]byte(`
+waivers:
+  - host: observatory.mozilla.org
+    test: content-security-policy
+    result: csp-implemented-with-unsafe-inline
+    expires: 2021-06-30
+    justification: legacy scripts
+`))
+	require.Nil(t, err)
+
+	report := p.Evaluate("observatory.mozilla.org", result, tests)
+	require.Len(t, report.Failures(), 2)
+	report.Waive(b.Evaluate("observatory.mozilla.org", tests, time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)))
+	require.Len(t, report.Failures(), 1)
+	assert.Equal(t, "grade >= A", report.Failures()[0].Rule)
+	assert.True(t, report.Outcomes[0].Waived)
+	assert.Equal(t, "legacy scripts", report.Outcomes[0].Waiver.Justification)
+
+	report = p.Evaluate("observatory.mozilla.org", result, tests)
+	report.Waive(b.Evaluate("observatory.mozilla.org", tests, time.Date(2021, time.July, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Len(t, report.Failures(), 2)
+}
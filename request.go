@@ -4,9 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/tigerwill90/observatory/middleware"
+	"github.com/tigerwill90/observatory/telemetry"
 	"io"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
 )
@@ -18,40 +21,123 @@ type request struct {
 	data        url.Values
 }
 
+// key identify the identical requests.
+func (r request) key() string {
+	return r.method + " " + r.apiCall + "?" + r.queryParams.Encode() + " " + r.data.Encode()
+}
+
+// doRequest run the api call through the middleware chain and decode the response into data. Identical
+// concurrent requests are sent once, unless deduplication is disabled.
 func (c *Client) doRequest(ctx context.Context, reqConfig request, data interface{}) error {
-	var params string
-	if len(reqConfig.queryParams) != 0 {
-		params = fmt.Sprintf("?%s", reqConfig.queryParams.Encode())
+	if c.flights == nil {
+		return c.sendRequest(ctx, reqConfig, data)
+	}
+	result, shared, err := c.flights.do(copyLogAttrs(ctx), reqConfig.key(), func(ctx context.Context) (interface{}, error) {
+		result := reflect.New(reflect.TypeOf(data).Elem()).Interface()
+		return result, c.sendRequest(ctx, reqConfig, result)
+	})
+	if err != nil {
+		return err
+	}
+	return copyResult(data, result, shared)
+}
+
+// sendRequest run the api call through the middleware chain and decode the response into data.
+func (c *Client) sendRequest(ctx context.Context, reqConfig request, data interface{}) error {
+	call := &middleware.Call{
+		ApiCall: reqConfig.apiCall,
+		Method:  reqConfig.method,
+		Query:   reqConfig.queryParams,
+		Form:    reqConfig.data,
+		Header:  make(http.Header),
+		Result:  data,
+	}
+
+	ctx, span := c.startSpan(ctx, "observatory.request", reqConfig.apiCall, reqConfig.queryParams.Get("host"), 0)
+	resp, err := c.doer.Do(ctx, call)
+	if span != nil {
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		span.SetAttributes(
+			telemetry.String(telemetry.KeyMethod, reqConfig.method),
+			telemetry.Int(telemetry.KeyStatusCode, statusCode),
+		)
+		endSpan(span, nil, err)
+	}
+	return err
+}
+
+// do send the call to an endpoint and decode the response into the call result. It is the innermost Doer of
+// the middleware chain.
+func (c *Client) do(ctx context.Context, call *middleware.Call) (*middleware.Response, error) {
+	return c.route(ctx, call)
+}
+
+// send build the HTTP request of the call, send it to the endpoint and decode the response into the call result.
+func (c *Client) send(ctx context.Context, e *endpoint, call *middleware.Call) (*middleware.Response, outcome, error) {
+	reqUrl, err := e.url(call.ApiCall, call.Query)
+	if err != nil {
+		return nil, outcomeIgnored, err
 	}
-	reqUrl := fmt.Sprintf("%s/%s%s", c.url, reqConfig.apiCall, params)
 
 	var body io.Reader
-	if len(reqConfig.data) != 0 {
-		body = strings.NewReader(reqConfig.data.Encode())
+	if len(call.Form) != 0 {
+		body = strings.NewReader(call.Form.Encode())
 	}
 
-	req, err := http.NewRequestWithContext(ctx, reqConfig.method, reqUrl, body)
+	req, err := http.NewRequestWithContext(ctx, call.Method, reqUrl, body)
 	if err != nil {
-		return err
+		return nil, outcomeIgnored, err
+	}
+	for key, values := range call.Header {
+		req.Header[key] = values
 	}
-	if reqConfig.method == "POST" {
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-		req.Header.Add("Content-Length", strconv.Itoa(len(reqConfig.data.Encode())))
+	if e.credentials && c.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	}
+	if e.credentials && c.basicAuth != nil {
+		req.SetBasicAuth(c.basicAuth.Username, c.basicAuth.Password)
+	}
+	if call.Method == "POST" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Content-Length", strconv.Itoa(len(call.Form.Encode())))
 	}
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return err
+		if ctx.Err() != nil {
+			return nil, outcomeIgnored, err
+		}
+		return nil, outcomeFailure, err
 	}
 	defer resp.Body.Close()
 
+	response := &middleware.Response{StatusCode: resp.StatusCode, Header: resp.Header}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return response, outcomeFailure, fmt.Errorf("http request failed: %s", resp.Status)
+	}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("http request failed: %s", resp.Status)
+		return response, outcomeSuccess, fmt.Errorf("http request failed: %s", resp.Status)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(data); err != nil {
-		return err
+	if err := json.NewDecoder(resp.Body).Decode(call.Result); err != nil {
+		return response, outcomeSuccess, err
 	}
 
-	return nil
+	return response, outcomeSuccess, nil
+}
+
+// parseBaseURL parse the base url of the api, which must be absolute.
+func parseBaseURL(rawURL string) (*url.URL, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid base url %q: scheme and host are required", rawURL)
+	}
+	base.Fragment = ""
+	return base, nil
 }
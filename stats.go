@@ -0,0 +1,102 @@
+package observatory
+
+import (
+	"context"
+	"fmt"
+	"github.com/tigerwill90/observatory/internal/option"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// hourLayouts are the layouts of the hours of the per-hour scan counts, which are formatted by the database
+// driver of HTTP Observatory.
+var hourLayouts = []string{
+	"2006-01-02 15:04:05-07:00",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	time.RFC3339,
+	http.TimeFormat,
+	time.RFC1123Z,
+}
+
+// GetScannerStats retrieve the statistics of HTTP Observatory: the number of scans in each state, the grade
+// distributions, the overall counters and the most recent scans. Use option.WithVerbose to also retrieve the
+// number of scans per hour over the last 24 hours, parsed into ScannerStats ScansPerHour.
+// https://github.com/mozilla/http-observatory/blob/master/httpobs/website/api.py
+func (c *Client) GetScannerStats(ctx context.Context, opts ...option.StatsOption) (_ *types.ScannerStats, err error) {
+	ctx, span := c.startSpan(ctx, "observatory.GetScannerStats", ApiCallGetScannerStats, "", 0)
+	defer func() { endSpan(span, nil, err) }()
+	ctx = c.withLogAttrs(ctx, "", 0)
+
+	if c.version == option.APIv2 {
+		return nil, fmt.Errorf("retrieve scanner statistics failed: %w", ErrUnsupported)
+	}
+
+	o := option.DefaultStatsOption()
+	for _, opt := range opts {
+		opt.Apply(o)
+	}
+	data := url.Values{}
+	if o.Verbose {
+		data.Set("verbose", "true")
+	}
+
+	reqConfig := request{
+		method:      "GET",
+		apiCall:     ApiCallGetScannerStats,
+		queryParams: data,
+	}
+	stats := new(types.ScannerStats)
+	if err := c.doRequest(ctx, reqConfig, stats); err != nil {
+		return nil, fmt.Errorf("retrieve scanner statistics failed: %w", err)
+	}
+
+	stats.ScansPerHour, err = scanSeries(stats.Recent.Scans.NumPerHourLast24Hours)
+	if err != nil {
+		return nil, fmt.Errorf("retrieve scanner statistics failed: %w", err)
+	}
+	return stats, nil
+}
+
+// scanSeries parse the per-hour scan counts into a time series, in which the hours without scans between the
+// first and the last hour have a zero count.
+func scanSeries(counts map[string]int) (types.ScanSeries, error) {
+	if len(counts) == 0 {
+		return nil, nil
+	}
+
+	byHour := make(map[time.Time]int, len(counts))
+	for key, count := range counts {
+		hour, err := parseHour(key)
+		if err != nil {
+			return nil, err
+		}
+		byHour[hour] += count
+	}
+	hours := make([]time.Time, 0, len(byHour))
+	for hour := range byHour {
+		hours = append(hours, hour)
+	}
+	sort.Slice(hours, func(i, j int) bool {
+		return hours[i].Before(hours[j])
+	})
+
+	series := make(types.ScanSeries, 0, len(hours))
+	for hour := hours[0]; !hour.After(hours[len(hours)-1]); hour = hour.Add(time.Hour) {
+		series = append(series, types.HourlyScans{Hour: hour, Count: byHour[hour]})
+	}
+	return series, nil
+}
+
+// parseHour parse an hour of the per-hour scan counts, truncated to the hour, in UTC.
+func parseHour(s string) (time.Time, error) {
+	for _, layout := range hourLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC().Truncate(time.Hour), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid hour %q", s)
+}
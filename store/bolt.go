@@ -0,0 +1,279 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/tigerwill90/observatory/types"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+var (
+	hostsBucket   = []byte("hosts")
+	recordsBucket = []byte("records")
+	timeBucket    = []byte("time")
+	// grade distribution snapshots, keyed by time
+	snapshotsBucket = []byte("snapshots")
+)
+
+// BoltStore is a Store backed by an embedded bbolt database. Each host has its own bucket, with
+// records keyed by scan ID and a secondary index keyed by completion time to serve range queries.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+var (
+	_ Store         = (*BoltStore)(nil)
+	_ SnapshotStore = (*BoltStore)(nil)
+)
+
+// NewBoltStore open, or create, the bbolt database at path. The database is locked until the
+// store is closed.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open store database: %w", err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Save persist a record, merging it with an existing record with the same scan ID.
+func (s *BoltStore) Save(ctx context.Context, rec *Record) error {
+	if err := validateHost(rec.Host); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		hosts, err := tx.CreateBucketIfNotExists(hostsBucket)
+		if err != nil {
+			return err
+		}
+		hostBkt, err := hosts.CreateBucketIfNotExists([]byte(rec.Host))
+		if err != nil {
+			return err
+		}
+		records, err := hostBkt.CreateBucketIfNotExists(recordsBucket)
+		if err != nil {
+			return err
+		}
+		index, err := hostBkt.CreateBucketIfNotExists(timeBucket)
+		if err != nil {
+			return err
+		}
+
+		if buf := records.Get(scanKey(rec.ScanID)); buf != nil {
+			existing := new(Record)
+			if err := json.Unmarshal(buf, existing); err != nil {
+				return fmt.Errorf("corrupted record %s/%d: %w", rec.Host, rec.ScanID, err)
+			}
+			merged, changed := merge(existing, rec)
+			if !changed {
+				return nil
+			}
+			if err := index.Delete(timeKey(existing.Time, existing.ScanID)); err != nil {
+				return err
+			}
+			rec = merged
+		}
+
+		buf, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if err := records.Put(scanKey(rec.ScanID), buf); err != nil {
+			return err
+		}
+		return index.Put(timeKey(rec.Time, rec.ScanID), scanKey(rec.ScanID))
+	})
+}
+
+// Get return the record of a host scan, or ErrNotFound.
+func (s *BoltStore) Get(ctx context.Context, host string, scanID types.ScanID) (*Record, error) {
+	if err := validateHost(host); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	rec := new(Record)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var buf []byte
+		if hosts := tx.Bucket(hostsBucket); hosts != nil {
+			if hostBkt := hosts.Bucket([]byte(host)); hostBkt != nil {
+				buf = hostBkt.Bucket(recordsBucket).Get(scanKey(scanID))
+			}
+		}
+		if buf == nil {
+			return fmt.Errorf("%w: host %s, scan %d", ErrNotFound, host, scanID)
+		}
+		return json.Unmarshal(buf, rec)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Query return the records matching the query, ordered by completion time.
+func (s *BoltStore) Query(ctx context.Context, q Query) ([]*Record, error) {
+	if q.Host != "" {
+		if err := validateHost(q.Host); err != nil {
+			return nil, err
+		}
+	}
+
+	records := make([]*Record, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		hosts := tx.Bucket(hostsBucket)
+		if hosts == nil {
+			return nil
+		}
+		return hosts.ForEach(func(host, _ []byte) error {
+			if q.Host != "" && q.Host != string(host) {
+				return nil
+			}
+			hostBkt := hosts.Bucket(host)
+			recs := hostBkt.Bucket(recordsBucket)
+			c := hostBkt.Bucket(timeBucket).Cursor()
+			k, v := c.First()
+			if !q.From.IsZero() {
+				k, v = c.Seek(timeKey(q.From, 0))
+			}
+			var to []byte
+			if !q.To.IsZero() {
+				to = timeKey(q.To, 0)
+			}
+
+			for ; k != nil; k, v = c.Next() {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if to != nil && bytes.Compare(k, to) >= 0 {
+					break
+				}
+				rec := new(Record)
+				if err := json.Unmarshal(recs.Get(v), rec); err != nil {
+					return fmt.Errorf("corrupted record %s/%d: %w", host, binary.BigEndian.Uint64(v), err)
+				}
+				if q.Match(rec) {
+					records = append(records, rec)
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortRecords(records)
+	return records, nil
+}
+
+// Hosts return every host with at least one record, in lexical order.
+func (s *BoltStore) Hosts(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	hosts := make([]string, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(hostsBucket)
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(host, _ []byte) error {
+			hosts = append(hosts, string(host))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// SaveSnapshot persist a snapshot, replacing the one taken at the same time.
+func (s *BoltStore) SaveSnapshot(ctx context.Context, snap *Snapshot) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists(snapshotsBucket)
+		if err != nil {
+			return err
+		}
+		return bkt.Put(timeKey(snap.Time, 0), buf)
+	})
+}
+
+// Snapshots return the snapshots taken at or after from and before to, ordered by time.
+func (s *BoltStore) Snapshots(ctx context.Context, from, to time.Time) ([]*Snapshot, error) {
+	snapshots := make([]*Snapshot, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(snapshotsBucket)
+		if bkt == nil {
+			return nil
+		}
+		c := bkt.Cursor()
+		k, v := c.First()
+		if !from.IsZero() {
+			k, v = c.Seek(timeKey(from, 0))
+		}
+		for ; k != nil; k, v = c.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			snap := new(Snapshot)
+			if err := json.Unmarshal(v, snap); err != nil {
+				return fmt.Errorf("corrupted snapshot %x: %w", k, err)
+			}
+			if !to.IsZero() && !snap.Time.Before(to) {
+				break
+			}
+			if matchSnapshot(snap, from, to) {
+				snapshots = append(snapshots, snap)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// Close close the underlying database.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func scanKey(scanID types.ScanID) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(scanID))
+	return key
+}
+
+// timeKey build an index key that sort by completion time, then by scan ID. Times before
+// the unix epoch are clamped to it.
+func timeKey(t time.Time, scanID types.ScanID) []byte {
+	nanos := t.UnixNano()
+	if nanos < 0 {
+		nanos = 0
+	}
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(nanos))
+	binary.BigEndian.PutUint64(key[8:], uint64(scanID))
+	return key
+}
@@ -0,0 +1,287 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tigerwill90/observatory/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	recordExt = ".json"
+	// file of the grade distribution snapshots, at the root of the store, where hosts are directories
+	snapshotsFile = "snapshots.json"
+)
+
+// FileStore is a Store that keep each record in its own JSON file, under one directory per host.
+// It is suited for small inventories and for records that must stay human-readable.
+type FileStore struct {
+	mu  sync.RWMutex
+	dir string
+}
+
+var (
+	_ Store         = (*FileStore)(nil)
+	_ SnapshotStore = (*FileStore)(nil)
+)
+
+// NewFileStore return a FileStore rooted at dir. The directory is created if it does not exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create store directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Save persist a record, merging it with an existing record with the same scan ID.
+func (s *FileStore) Save(ctx context.Context, rec *Record) error {
+	if err := validateHost(rec.Host); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, err := s.read(rec.Host, rec.ScanID)
+	switch {
+	case err == nil:
+		merged, changed := merge(existing, rec)
+		if !changed {
+			return nil
+		}
+		rec = merged
+	case !errors.Is(err, ErrNotFound):
+		return err
+	}
+
+	return s.write(rec)
+}
+
+// Get return the record of a host scan, or ErrNotFound.
+func (s *FileStore) Get(ctx context.Context, host string, scanID types.ScanID) (*Record, error) {
+	if err := validateHost(host); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.read(host, scanID)
+}
+
+// Query return the records matching the query, ordered by completion time.
+func (s *FileStore) Query(ctx context.Context, q Query) ([]*Record, error) {
+	hosts := []string{q.Host}
+	if q.Host == "" {
+		var err error
+		if hosts, err = s.Hosts(ctx); err != nil {
+			return nil, err
+		}
+	} else if err := validateHost(q.Host); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]*Record, 0)
+	for _, host := range hosts {
+		entries, err := ioutil.ReadDir(filepath.Join(s.dir, host))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			id, ok := parseRecordName(entry.Name())
+			if !ok {
+				continue
+			}
+			rec, err := s.read(host, id)
+			if err != nil {
+				return nil, err
+			}
+			if q.Match(rec) {
+				records = append(records, rec)
+			}
+		}
+	}
+
+	sortRecords(records)
+	return records, nil
+}
+
+// Hosts return every host with at least one record, in lexical order.
+func (s *FileStore) Hosts(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			hosts = append(hosts, entry.Name())
+		}
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+// SaveSnapshot persist a snapshot, replacing the one taken at the same time. Every snapshot is kept in a single
+// JSON file.
+func (s *FileStore) SaveSnapshot(ctx context.Context, snap *Snapshot) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshots, err := s.readSnapshots()
+	if err != nil {
+		return err
+	}
+	kept := snapshots[:0]
+	for _, existing := range snapshots {
+		if !existing.Time.Equal(snap.Time) {
+			kept = append(kept, existing)
+		}
+	}
+	snapshots = append(kept, snap)
+	sortSnapshots(snapshots)
+
+	buf, err := json.MarshalIndent(snapshots, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(s.dir, snapshotsFile, buf)
+}
+
+// Snapshots return the snapshots taken at or after from and before to, ordered by time.
+func (s *FileStore) Snapshots(ctx context.Context, from, to time.Time) ([]*Snapshot, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshots, err := s.readSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]*Snapshot, 0, len(snapshots))
+	for _, snap := range snapshots {
+		if matchSnapshot(snap, from, to) {
+			matched = append(matched, snap)
+		}
+	}
+	return matched, nil
+}
+
+// Close is a no-op, a FileStore does not hold any resource.
+func (s *FileStore) Close() error {
+	return nil
+}
+
+func (s *FileStore) path(host string, scanID types.ScanID) string {
+	return filepath.Join(s.dir, host, strconv.Itoa(int(scanID))+recordExt)
+}
+
+func (s *FileStore) read(host string, scanID types.ScanID) (*Record, error) {
+	buf, err := ioutil.ReadFile(s.path(host, scanID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: host %s, scan %d", ErrNotFound, host, scanID)
+		}
+		return nil, err
+	}
+
+	rec := new(Record)
+	if err := json.Unmarshal(buf, rec); err != nil {
+		return nil, fmt.Errorf("corrupted record %s: %w", s.path(host, scanID), err)
+	}
+	return rec, nil
+}
+
+func (s *FileStore) readSnapshots() ([]*Snapshot, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(s.dir, snapshotsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Snapshot{}, nil
+		}
+		return nil, err
+	}
+
+	snapshots := make([]*Snapshot, 0)
+	if err := json.Unmarshal(buf, &snapshots); err != nil {
+		return nil, fmt.Errorf("corrupted snapshots %s: %w", filepath.Join(s.dir, snapshotsFile), err)
+	}
+	return snapshots, nil
+}
+
+func (s *FileStore) write(rec *Record) error {
+	buf, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(s.dir, rec.Host), strconv.Itoa(int(rec.ScanID))+recordExt, buf)
+}
+
+// writeFile atomically replace the file, so a crash never leave a truncated file behind.
+func writeFile(dir, name string, buf []byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
+
+func parseRecordName(name string) (types.ScanID, bool) {
+	if !strings.HasSuffix(name, recordExt) {
+		return 0, false
+	}
+	id, err := strconv.Atoi(strings.TrimSuffix(name, recordExt))
+	if err != nil {
+		return 0, false
+	}
+	return types.ScanID(id), true
+}
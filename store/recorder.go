@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/internal/option"
+	"sync"
+)
+
+// Backfill save the scans of the host history that are not yet in the store, and return how many
+// records were added. Since the history only carry a summary of each scan, the records are partial,
+// unless withTests is true, in which case the detailed test results are retrieved as well. The records
+// are saved under the host normalized by Client.NormalizeHost.
+func Backfill(ctx context.Context, c *observatory.Client, s Store, host string, withTests bool) (int, error) {
+	host, err := c.NormalizeHost(host)
+	if err != nil {
+		return 0, fmt.Errorf("backfill failed: %w", err)
+	}
+	histories, err := c.GetScanHistory(ctx, host)
+	if err != nil {
+		return 0, fmt.Errorf("backfill failed: %w", err)
+	}
+
+	added := 0
+	for _, history := range histories {
+		existing, err := s.Get(ctx, host, history.ScanId)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return added, fmt.Errorf("backfill failed: %w", err)
+		}
+		if existing != nil && (existing.Tests != nil || !withTests) {
+			continue
+		}
+
+		rec := NewHistoryRecord(host, history)
+		if withTests {
+			if rec.Tests, err = c.GetTestResults(ctx, history.ScanId); err != nil {
+				return added, fmt.Errorf("backfill failed: %w", err)
+			}
+		}
+		if err := s.Save(ctx, rec); err != nil {
+			return added, fmt.Errorf("backfill failed: %w", err)
+		}
+		if existing == nil {
+			added++
+		}
+	}
+	return added, nil
+}
+
+// Recorder analyze hosts with a Client and save every finished scan in a Store. The first time a host
+// is analyzed, its history is backfilled, so the store also keep the scans that happened before.
+type Recorder struct {
+	client     *observatory.Client
+	store      Store
+	mu         sync.Mutex
+	backfilled map[string]bool
+}
+
+// NewRecorder return a Recorder that save the scans made through c into s.
+func NewRecorder(c *observatory.Client, s Store) *Recorder {
+	return &Recorder{
+		client:     c,
+		store:      s,
+		backfilled: make(map[string]bool),
+	}
+}
+
+// Analyze invoke a scan of the host with Client.Analyze and, once the scan is finished, save its result
+// and detailed test results. Use option.WaitFinished to wait for the scan to complete, otherwise an
+// unfinished scan is returned without being saved. A URL or an upper case host is recorded as the
+// host the client scanned.
+func (r *Recorder) Analyze(ctx context.Context, host string, opts ...option.Option) (*Record, error) {
+	host, err := r.client.NormalizeHost(host)
+	if err != nil {
+		return nil, fmt.Errorf("invoke assessment failed: %w", err)
+	}
+	if err := r.backfill(ctx, host); err != nil {
+		return nil, err
+	}
+
+	result, err := r.client.Analyze(ctx, host, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if result.State != observatory.Finished {
+		return &Record{Host: host, ScanID: result.ScanID, Result: result}, nil
+	}
+
+	tests, err := r.client.GetTestResults(ctx, result.ScanID)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := NewRecord(host, result, tests)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.store.Save(ctx, rec); err != nil {
+		return nil, fmt.Errorf("save scan failed: %w", err)
+	}
+	return rec, nil
+}
+
+func (r *Recorder) backfill(ctx context.Context, host string) error {
+	r.mu.Lock()
+	done := r.backfilled[host]
+	r.mu.Unlock()
+	if done {
+		return nil
+	}
+
+	if _, err := Backfill(ctx, r.client, r.store, host, false); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.backfilled[host] = true
+	r.mu.Unlock()
+	return nil
+}
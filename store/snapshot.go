@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+	"github.com/tigerwill90/observatory/types"
+	"sort"
+	"time"
+)
+
+// Snapshot is the grade distribution of HTTP Observatory at a point in time.
+type Snapshot struct {
+	// time at which the distribution was retrieved
+	Time         time.Time                      `json:"time"`
+	Distribution types.ScannerGradeDistribution `json:"distribution"`
+}
+
+// SnapshotStore is a persistent collection of grade distribution snapshots, keyed by time. Both BoltStore and
+// FileStore implement it.
+type SnapshotStore interface {
+	// SaveSnapshot persist a snapshot, replacing the one taken at the same time.
+	SaveSnapshot(ctx context.Context, snap *Snapshot) error
+	// Snapshots return the snapshots taken at or after from and before to, ordered by time. Zero values are
+	// ignored.
+	Snapshots(ctx context.Context, from, to time.Time) ([]*Snapshot, error)
+}
+
+func matchSnapshot(snap *Snapshot, from, to time.Time) bool {
+	if !from.IsZero() && snap.Time.Before(from) {
+		return false
+	}
+	if !to.IsZero() && !snap.Time.Before(to) {
+		return false
+	}
+	return true
+}
+
+func sortSnapshots(snapshots []*Snapshot) {
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+}
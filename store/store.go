@@ -0,0 +1,156 @@
+// Package store persist scan results beyond the ten most recent scans returned by the HTTP Observatory api, which
+// allows to keep the full security history of a host.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound    = errors.New("record not found")
+	ErrInvalidHost = errors.New("invalid host")
+)
+
+// Record is a scan of a host, as persisted in a Store.
+type Record struct {
+	// the scanned host
+	Host string `json:"host"`
+	// unique ID number assigned to the scan
+	ScanID types.ScanID `json:"scan_id"`
+	// time at which the scan completed
+	Time time.Time `json:"time"`
+	// summarized result of the scan
+	Result *types.ScannerResult `json:"result"`
+	// detailed result of each test of the scan, if retrieved
+	Tests *types.ScannerTestResult `json:"tests,omitempty"`
+	// whether the summarized result was rebuilt from the host history, in which
+	// case only the end time, grade, score and scan ID are set
+	Partial bool `json:"partial,omitempty"`
+}
+
+// Query select records within a time range. Zero values are ignored.
+type Query struct {
+	// only return records of this host
+	Host string
+	// only return records that completed at or after this time
+	From time.Time
+	// only return records that completed before this time
+	To time.Time
+}
+
+// Store is a persistent collection of scan records, keyed by host and scan ID. Saving a record
+// with a scan ID already stored merge both records instead of creating a duplicate.
+type Store interface {
+	// Save persist a record.
+	Save(ctx context.Context, rec *Record) error
+	// Get return the record of a host scan, or ErrNotFound.
+	Get(ctx context.Context, host string, scanID types.ScanID) (*Record, error)
+	// Query return the records matching the query, ordered by completion time.
+	Query(ctx context.Context, q Query) ([]*Record, error)
+	// Hosts return every host with at least one record, in lexical order.
+	Hosts(ctx context.Context) ([]string, error)
+	// Close release the resources held by the store.
+	Close() error
+}
+
+// NewRecord create a record from the result of a scan. The completion time is parsed from
+// the scan end time, or from its start time if the scan is not finished yet.
+func NewRecord(host string, result *types.ScannerResult, tests *types.ScannerTestResult) (*Record, error) {
+	ts := result.EndTime
+	if ts == "" {
+		ts = result.StartTime
+	}
+	t, err := parseTime(ts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scan time: %w", err)
+	}
+
+	return &Record{
+		Host:   host,
+		ScanID: result.ScanID,
+		Time:   t,
+		Result: result,
+		Tests:  tests,
+	}, nil
+}
+
+// NewHistoryRecord create a partial record from an entry of the host history.
+func NewHistoryRecord(host string, history *types.ScannerHostHistory) *Record {
+	return &Record{
+		Host:   host,
+		ScanID: history.ScanId,
+		Time:   time.Unix(int64(history.EndTimeUnixTimestamp), 0).UTC(),
+		Result: &types.ScannerResult{
+			EndTime: history.EndTime,
+			Grade:   history.Grade,
+			ScanID:  history.ScanId,
+			Score:   history.Score,
+			State:   observatory.Finished,
+		},
+		Partial: true,
+	}
+}
+
+// Match return true if the record match the query.
+func (q Query) Match(rec *Record) bool {
+	if q.Host != "" && q.Host != rec.Host {
+		return false
+	}
+	if !q.From.IsZero() && rec.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !rec.Time.Before(q.To) {
+		return false
+	}
+	return true
+}
+
+// merge combine a new record into an existing one with the same scan ID. A complete result
+// replace a partial one, and tests are kept once known. It returns false if nothing changed.
+func merge(existing, rec *Record) (*Record, bool) {
+	merged := *existing
+	changed := false
+	if existing.Partial && !rec.Partial {
+		merged.Result = rec.Result
+		merged.Time = rec.Time
+		merged.Partial = false
+		changed = true
+	}
+	if existing.Tests == nil && rec.Tests != nil {
+		merged.Tests = rec.Tests
+		changed = true
+	}
+	return &merged, changed
+}
+
+func sortRecords(records []*Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Time.Equal(records[j].Time) {
+			return records[i].ScanID < records[j].ScanID
+		}
+		return records[i].Time.Before(records[j].Time)
+	})
+}
+
+func validateHost(host string) error {
+	if host == "" || host == "." || host == ".." || strings.ContainsAny(host, `/\`) {
+		return fmt.Errorf("%w: %q", ErrInvalidHost, host)
+	}
+	return nil
+}
+
+func parseTime(ts string) (time.Time, error) {
+	t, err := http.ParseTime(ts)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
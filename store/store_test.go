@@ -0,0 +1,218 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory"
+	"github.com/tigerwill90/observatory/option"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newStores(t *testing.T) map[string]Store {
+	fileStore, err := NewFileStore(t.TempDir())
+	require.Nil(t, err)
+	boltStore, err := NewBoltStore(filepath.Join(t.TempDir(), "observatory.db"))
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		_ = boltStore.Close()
+	})
+	return map[string]Store{
+		"file": fileStore,
+		"bolt": boltStore,
+	}
+}
+
+func newHistory(id types.ScanID, day int) *types.ScannerHostHistory {
+	ts := time.Date(2021, time.March, day, 12, 0, 0, 0, time.UTC)
+	return &types.ScannerHostHistory{
+		EndTime:              ts.Format(http.TimeFormat),
+		EndTimeUnixTimestamp: int(ts.Unix()),
+		Grade:                "B",
+		ScanId:               id,
+		Score:                70,
+	}
+}
+
+func TestStore(t *testing.T) {
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for i, host := range []string{"b.example.com", "a.example.com"} {
+				for day := 1; day <= 3; day++ {
+					id := types.ScanID(i*10 + day)
+					require.Nil(t, s.Save(ctx, NewHistoryRecord(host, newHistory(id, day))))
+				}
+			}
+
+			hosts, err := s.Hosts(ctx)
+			require.Nil(t, err)
+			assert.Equal(t, []string{"a.example.com", "b.example.com"}, hosts)
+
+			rec, err := s.Get(ctx, "b.example.com", 2)
+			require.Nil(t, err)
+			assert.True(t, rec.Partial)
+			assert.Equal(t, "B", rec.Result.Grade)
+
+			_, err = s.Get(ctx, "b.example.com", 42)
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			records, err := s.Query(ctx, Query{})
+			require.Nil(t, err)
+			assert.Len(t, records, 6)
+
+			records, err = s.Query(ctx, Query{
+				Host: "a.example.com",
+				From: time.Date(2021, time.March, 2, 0, 0, 0, 0, time.UTC),
+				To:   time.Date(2021, time.March, 3, 12, 0, 0, 0, time.UTC),
+			})
+			require.Nil(t, err)
+			require.Len(t, records, 1)
+			assert.Equal(t, types.ScanID(12), records[0].ScanID)
+		})
+	}
+}
+
+func TestStoreDeduplicate(t *testing.T) {
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			host := "observatory.mozilla.org"
+			require.Nil(t, s.Save(ctx, NewHistoryRecord(host, newHistory(1, 1))))
+			require.Nil(t, s.Save(ctx, NewHistoryRecord(host, newHistory(1, 1))))
+
+			result := &types.ScannerResult{
+				EndTime:         time.Date(2021, time.March, 1, 12, 0, 1, 0, time.UTC).Format(http.TimeFormat),
+				Grade:           "B",
+				ResponseHeaders: map[string]string{"Content-Type": "text/html"},
+				ScanID:          1,
+				Score:           70,
+				State:           observatory.Finished,
+			}
+			full, err := NewRecord(host, result, new(types.ScannerTestResult))
+			require.Nil(t, err)
+			require.Nil(t, s.Save(ctx, full))
+
+			// A partial record never override a complete one.
+			require.Nil(t, s.Save(ctx, NewHistoryRecord(host, newHistory(1, 1))))
+
+			records, err := s.Query(ctx, Query{Host: host})
+			require.Nil(t, err)
+			require.Len(t, records, 1)
+			assert.False(t, records[0].Partial)
+			assert.NotNil(t, records[0].Tests)
+			assert.Equal(t, result, records[0].Result)
+		})
+	}
+}
+
+func TestStoreInvalidHost(t *testing.T) {
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			err := s.Save(context.Background(), NewHistoryRecord("../etc", newHistory(1, 1)))
+			assert.ErrorIs(t, err, ErrInvalidHost)
+		})
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	host := "observatory.mozilla.org"
+	histories := []*types.ScannerHostHistory{newHistory(1, 1), newHistory(2, 2)}
+	result := &types.ScannerResult{
+		EndTime: time.Date(2021, time.March, 3, 12, 0, 0, 0, time.UTC).Format(http.TimeFormat),
+		Grade:   "A",
+		ScanID:  3,
+		Score:   90,
+		State:   observatory.Finished,
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{}
+		switch r.URL.Path {
+		case fmt.Sprintf("/%s", observatory.ApiCallGetHostHistory):
+			resp = histories
+		case fmt.Sprintf("/%s", observatory.ApiCallAnalyze):
+			resp = result
+		case fmt.Sprintf("/%s", observatory.ApiCallGetScanResults):
+			resp = new(types.ScannerTestResult)
+		default:
+			t.Fatalf("unexpected api call %s", r.URL.Path)
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer srv.Close()
+
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			r := NewRecorder(observatory.NewCustomClient(srv.Client(), srv.URL), s)
+			// The records are saved under the normalized host.
+			rec, err := r.Analyze(ctx, "https://Observatory.Mozilla.org/", option.WaitFinished(true, time.Second))
+			require.Nil(t, err)
+			assert.Equal(t, types.ScanID(3), rec.ScanID)
+			assert.Equal(t, host, rec.Host)
+
+			records, err := s.Query(ctx, Query{Host: host})
+			require.Nil(t, err)
+			require.Len(t, records, 3)
+			assert.True(t, records[0].Partial)
+			assert.True(t, records[1].Partial)
+			assert.False(t, records[2].Partial)
+			assert.NotNil(t, records[2].Tests)
+
+			added, err := Backfill(ctx, observatory.NewCustomClient(srv.Client(), srv.URL), s, "OBSERVATORY.mozilla.org", true)
+			require.Nil(t, err)
+			assert.Equal(t, 0, added)
+			rec, err = s.Get(ctx, host, 1)
+			require.Nil(t, err)
+			assert.NotNil(t, rec.Tests)
+
+			// Without host validation, the host is recorded as given to the client.
+			r = NewRecorder(observatory.NewCustomClient(srv.Client(), srv.URL, option.WithHostValidation(false)), s)
+			rec, err = r.Analyze(ctx, "intranet", option.WaitFinished(true, time.Second))
+			require.Nil(t, err)
+			assert.Equal(t, "intranet", rec.Host)
+		})
+	}
+}
+
+func TestSnapshotStore(t *testing.T) {
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			ss := s.(SnapshotStore)
+			day := func(d int) time.Time {
+				return time.Date(2021, time.March, d, 12, 0, 0, 0, time.UTC)
+			}
+			for _, d := range []int{3, 1, 2} {
+				require.Nil(t, ss.SaveSnapshot(ctx, &Snapshot{Time: day(d), Distribution: types.ScannerGradeDistribution{A: d}}))
+			}
+			// A snapshot taken at the same time is replaced.
+			require.Nil(t, ss.SaveSnapshot(ctx, &Snapshot{Time: day(2), Distribution: types.ScannerGradeDistribution{A: 20}}))
+
+			snapshots, err := ss.Snapshots(ctx, time.Time{}, time.Time{})
+			require.Nil(t, err)
+			require.Len(t, snapshots, 3)
+			assert.Equal(t, []int{1, 20, 3}, []int{snapshots[0].Distribution.A, snapshots[1].Distribution.A, snapshots[2].Distribution.A})
+
+			snapshots, err = ss.Snapshots(ctx, day(2), day(3))
+			require.Nil(t, err)
+			require.Len(t, snapshots, 1)
+			assert.True(t, day(2).Equal(snapshots[0].Time))
+
+			// Snapshots are not hosts.
+			hosts, err := s.Hosts(ctx)
+			require.Nil(t, err)
+			assert.Empty(t, hosts)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package observatory
+
+import (
+	"context"
+	"github.com/tigerwill90/observatory/telemetry"
+	"github.com/tigerwill90/observatory/types"
+	"time"
+)
+
+// startSpan start a span if a tracer is configured. Attributes are only built when needed, so
+// an uninstrumented client does not pay for them.
+func (c *Client) startSpan(ctx context.Context, name, apiCall, host string, scanID types.ScanID) (context.Context, telemetry.Span) {
+	if c.tracer == nil {
+		return ctx, nil
+	}
+
+	attrs := make([]telemetry.Attribute, 0, 3)
+	if apiCall != "" {
+		attrs = append(attrs, telemetry.String(telemetry.KeyApiCall, apiCall))
+	}
+	if host != "" {
+		attrs = append(attrs, telemetry.String(telemetry.KeyHost, host))
+	}
+	if scanID != 0 {
+		attrs = append(attrs, telemetry.Int(telemetry.KeyScanID, int(scanID)))
+	}
+	return c.tracer.Start(ctx, name, attrs...)
+}
+
+// endSpan record the error, if any, and end the span. The result, if any, add the scan ID
+// and state to the span attributes.
+func endSpan(span telemetry.Span, result *types.ScannerResult, err error) {
+	if span == nil {
+		return
+	}
+
+	if result != nil {
+		span.SetAttributes(
+			telemetry.Int(telemetry.KeyScanID, int(result.ScanID)),
+			telemetry.String(telemetry.KeyState, result.State),
+		)
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+func (c *Client) recordScan(ctx context.Context, host string, result *types.ScannerResult, start time.Time, err error) {
+	var state string
+	if result != nil {
+		state = result.State
+	}
+	c.meter.RecordScan(ctx, host, state, time.Since(start), err)
+}
@@ -0,0 +1,68 @@
+// Package telemetry define the hooks used by the HTTP Observatory client to report traces and metrics. The client
+// does not depend on any telemetry library: an adapter, such as the one provided by the otelobservatory module for
+// OpenTelemetry, implement these interfaces and is registered with option.WithTracer and option.WithMeter. When
+// no adapter is registered, the client skip instrumentation entirely.
+package telemetry
+
+import (
+	"context"
+	"time"
+)
+
+// Attribute keys set by the client on spans.
+const (
+	KeyHost       = "observatory.host"
+	KeyScanID     = "observatory.scan_id"
+	KeyApiCall    = "observatory.api_call"
+	KeyState      = "observatory.state"
+	KeyMethod     = "http.method"
+	KeyStatusCode = "http.status_code"
+	KeyEndpoint   = "observatory.endpoint"
+	KeyOutcome    = "observatory.outcome"
+)
+
+// Attribute is a key-value pair attached to a span. Value is either a string, an int or a bool.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String return a string attribute.
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int return an int attribute.
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Tracer start spans. The span is a child of the span found in the context, if any, and the returned
+// context carry the new span.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a unit of work started by a Tracer.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Meter record the client measurements.
+type Meter interface {
+	// RecordRequest is called after each HTTP request sent to the api. The status code is 0
+	// if no response was received.
+	RecordRequest(ctx context.Context, apiCall, method string, statusCode int, duration time.Duration, err error)
+	// RecordScan is called when Client.Analyze return, with the state of the returned scan, empty
+	// on error, and the time spent waiting for it.
+	RecordScan(ctx context.Context, host, state string, duration time.Duration, err error)
+}
+
+// CircuitMeter is optionally implemented by a Meter to record the state changes of the circuit breakers of the
+// client, see option.WithCircuitBreaker. The states are observatory.CircuitClosed, observatory.CircuitOpen and
+// observatory.CircuitHalfOpen.
+type CircuitMeter interface {
+	RecordCircuitState(ctx context.Context, endpoint, from, to string)
+}
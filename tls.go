@@ -0,0 +1,54 @@
+package observatory
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+var ErrNoCertificate = errors.New("no certificate found")
+
+// LoadCABundle return the system cert pool, or an empty pool if it is not available, with the certificates of
+// the PEM files added, e.g. the CA of a private deployment. Use it with option.WithRootCAs.
+func LoadCABundle(paths ...string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	for _, path := range paths {
+		pem, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w in CA bundle %s", ErrNoCertificate, path)
+		}
+	}
+	return pool, nil
+}
+
+// withTLS return a copy of c whose transport use the TLS config, or c itself if there is no TLS config or if its
+// transport is not an *http.Transport.
+func withTLS(c *http.Client, config *tls.Config) *http.Client {
+	if config == nil {
+		return c
+	}
+
+	var transport *http.Transport
+	switch t := c.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return c
+	}
+	transport.TLSClientConfig = config.Clone()
+
+	copied := *c
+	copied.Transport = transport
+	return &copied
+}
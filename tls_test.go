@@ -0,0 +1,69 @@
+package observatory
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory/option"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestClientTLS(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"A+": 3}`)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "ca.pem")
+	require.Nil(t, ioutil.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o644))
+	pool, err := LoadCABundle(bundle)
+	require.Nil(t, err)
+
+	// The server certificate is signed by an unknown CA.
+	c := NewCustomClient(&http.Client{}, srv.URL)
+	_, err = c.GetGradeDistribution(context.Background())
+	assert.NotNil(t, err)
+
+	// The client certificate is missing.
+	c = NewCustomClient(&http.Client{}, srv.URL, option.WithRootCAs(pool))
+	_, err = c.GetGradeDistribution(context.Background())
+	assert.NotNil(t, err)
+
+	hc := &http.Client{Transport: &http.Transport{}}
+	c = NewCustomClient(hc, srv.URL, option.WithRootCAs(pool), option.WithClientCertificate(srv.TLS.Certificates[0]))
+	distribution, err := c.GetGradeDistribution(context.Background())
+	require.Nil(t, err)
+	assert.Equal(t, 3, distribution.A)
+	// The TLS options are not applied to the http.Client given to the client.
+	if config := hc.Transport.(*http.Transport).TLSClientConfig; config != nil {
+		assert.Nil(t, config.RootCAs)
+		assert.Empty(t, config.Certificates)
+	}
+}
+
+func TestLoadCABundle(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.pem")
+	require.Nil(t, ioutil.WriteFile(empty, []byte("not a certificate"), 0o644))
+
+	_, err := LoadCABundle(empty)
+	assert.ErrorIs(t, err, ErrNoCertificate)
+	_, err = LoadCABundle(filepath.Join(dir, "missing.pem"))
+	assert.NotNil(t, err)
+}
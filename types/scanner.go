@@ -1,5 +1,11 @@
 package types
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
 type ScanID int
 
 // ScannerResult is a summarized result of a scan.
@@ -28,6 +34,14 @@ type ScannerResult struct {
 	TestsPassed int `json:"tests_passed"`
 	// the total number of tests available and assessed at the time of the scan
 	TestsQuantity int `json:"tests_quantity"`
+	// url of the page detailing the scan on MDN, v2 api only
+	DetailsURL string `json:"details_url,omitempty"`
+	// version of the scoring algorithm that graded the scan, v2 api only
+	AlgorithmVersion int `json:"algorithm_version,omitempty"`
+	// HTTP status code returned by the scanned site, v2 api only
+	StatusCode int `json:"status_code,omitempty"`
+	// reason of the failure of a FAILED scan, v2 api only
+	Error string `json:"error,omitempty"`
 }
 
 // ScannerTestResult hold the detailed result of each test of a scan.
@@ -216,6 +230,21 @@ type ScannerTestResult struct {
 		ScoreDescription string `json:"score_description"`
 		ScoreModifier    int    `json:"score_modifier"`
 	} `json:"x-xss-protection"`
+	// every test returned by the v2 api by name, including the tests unknown to v1
+	Details map[string]TestDetail `json:"details,omitempty"`
+}
+
+// TestDetail hold the result of a test as returned by the v2 api.
+type TestDetail struct {
+	TestSummary
+	// human readable name of the test
+	Title string `json:"title"`
+	// url of the documentation of the test
+	Link string `json:"link"`
+	// how to improve the result of the test
+	Recommendation string `json:"recommendation"`
+	// test specific output
+	Data interface{} `json:"data"`
 }
 
 // ScannerGradeDistribution hold statistics on "Grade" repartition
@@ -236,6 +265,45 @@ type ScannerGradeDistribution struct {
 	F  int `json:"F"`
 }
 
+// Count return the number of sites with the grade, or 0 for an unknown grade.
+func (d *ScannerGradeDistribution) Count(grade string) int {
+	switch grade {
+	case "A+":
+		return d.A
+	case "A":
+		return d.A1
+	case "A-":
+		return d.A2
+	case "B+":
+		return d.B
+	case "B":
+		return d.B1
+	case "B-":
+		return d.B2
+	case "C+":
+		return d.C
+	case "C":
+		return d.C1
+	case "C-":
+		return d.C2
+	case "D+":
+		return d.D
+	case "D":
+		return d.D1
+	case "D-":
+		return d.D2
+	case "F":
+		return d.F
+	default:
+		return 0
+	}
+}
+
+// Total return the number of sites.
+func (d *ScannerGradeDistribution) Total() int {
+	return d.A + d.A1 + d.A2 + d.B + d.B1 + d.B2 + d.C + d.C1 + d.C2 + d.D + d.D1 + d.D2 + d.F
+}
+
 // ScannerHostHistory hold a short summary of the result of a past scan.
 type ScannerHostHistory struct {
 	EndTime              string `json:"end_time"`
@@ -245,5 +313,238 @@ type ScannerHostHistory struct {
 	Score                int    `json:"score"`
 }
 
-// ScannerRecentScans hold the grade result of maximum ten last scans.
-type ScannerRecentScans map[string]string
+// RecentScan is the grade of the recent scan of a host.
+type RecentScan struct {
+	Host  string `json:"host"`
+	Grade string `json:"grade"`
+}
+
+// ScannerRecentScans hold the grade result of maximum ten last scans, most recent first. Like in the api, it is
+// encoded in JSON as an object mapping each host to its grade, whose order is kept.
+type ScannerRecentScans []RecentScan
+
+// Grade return the grade of the host, or false if the host is not one of the scans.
+func (s ScannerRecentScans) Grade(host string) (string, bool) {
+	for _, scan := range s {
+		if scan.Host == host {
+			return scan.Grade, true
+		}
+	}
+	return "", false
+}
+
+// MarshalJSON encode the scans as a JSON object, in order.
+func (s ScannerRecentScans) MarshalJSON() ([]byte, error) {
+	if s == nil {
+		return []byte("null"), nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, scan := range s {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		host, err := json.Marshal(scan.Host)
+		if err != nil {
+			return nil, err
+		}
+		grade, err := json.Marshal(scan.Grade)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(host)
+		buf.WriteByte(':')
+		buf.Write(grade)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decode the scans from a JSON object, in order. A null grade is decoded as an empty grade.
+func (s *ScannerRecentScans) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		*s = nil
+		return nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("recent scans: expected a JSON object, got %v", tok)
+	}
+
+	scans := make(ScannerRecentScans, 0)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var grade *string
+		if err := dec.Decode(&grade); err != nil {
+			return err
+		}
+		scan := RecentScan{Host: tok.(string)}
+		if grade != nil {
+			scan.Grade = *grade
+		}
+		scans = append(scans, scan)
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	*s = scans
+	return nil
+}
+
+// Name of each test run by HTTP Observatory, as found in the detailed test result.
+const (
+	TestContentSecurityPolicy      = "content-security-policy"
+	TestContribute                 = "contribute"
+	TestCookies                    = "cookies"
+	TestCrossOriginResourceSharing = "cross-origin-resource-sharing"
+	TestPublicKeyPinning           = "public-key-pinning"
+	TestRedirection                = "redirection"
+	TestStrictTransportSecurity    = "strict-transport-security"
+	TestSubresourceIntegrity       = "subresource-integrity"
+	TestXContentTypeOptions        = "x-content-type-options"
+	TestXFrameOptions              = "x-frame-options"
+	TestXXssProtection             = "x-xss-protection"
+)
+
+var testNames = map[string]bool{
+	TestContentSecurityPolicy:      true,
+	TestContribute:                 true,
+	TestCookies:                    true,
+	TestCrossOriginResourceSharing: true,
+	TestPublicKeyPinning:           true,
+	TestRedirection:                true,
+	TestStrictTransportSecurity:    true,
+	TestSubresourceIntegrity:       true,
+	TestXContentTypeOptions:        true,
+	TestXFrameOptions:              true,
+	TestXXssProtection:             true,
+}
+
+// IsTest return true if name is the name of a test run by HTTP Observatory.
+func IsTest(name string) bool {
+	return testNames[name]
+}
+
+// TestSummary hold the fields shared by every test of a scan, without the test specific output.
+type TestSummary struct {
+	// the expected result of the test
+	Expectation string `json:"expectation"`
+	// the name of the test
+	Name string `json:"name"`
+	// whether the test passed or failed
+	Pass bool `json:"pass"`
+	// the actual result of the test
+	Result string `json:"result"`
+	// a short description of the result
+	ScoreDescription string `json:"score_description"`
+	// how much the result modify the final score
+	ScoreModifier int `json:"score_modifier"`
+}
+
+// Summaries return the summary of each test of a scan, ordered by test name. The summary name
+// is always set to the test name, even if the test is missing from the detailed result.
+func (r *ScannerTestResult) Summaries() []TestSummary {
+	return []TestSummary{
+		{
+			Expectation:      r.ContentSecurityPolicy.Expectation,
+			Name:             TestContentSecurityPolicy,
+			Pass:             r.ContentSecurityPolicy.Pass,
+			Result:           r.ContentSecurityPolicy.Result,
+			ScoreDescription: r.ContentSecurityPolicy.ScoreDescription,
+			ScoreModifier:    r.ContentSecurityPolicy.ScoreModifier,
+		},
+		{
+			Expectation:      r.Contribute.Expectation,
+			Name:             TestContribute,
+			Pass:             r.Contribute.Pass,
+			Result:           r.Contribute.Result,
+			ScoreDescription: r.Contribute.ScoreDescription,
+			ScoreModifier:    r.Contribute.ScoreModifier,
+		},
+		{
+			Expectation:      r.Cookies.Expectation,
+			Name:             TestCookies,
+			Pass:             r.Cookies.Pass,
+			Result:           r.Cookies.Result,
+			ScoreDescription: r.Cookies.ScoreDescription,
+			ScoreModifier:    r.Cookies.ScoreModifier,
+		},
+		{
+			Expectation:      r.CrossOriginResourceSharing.Expectation,
+			Name:             TestCrossOriginResourceSharing,
+			Pass:             r.CrossOriginResourceSharing.Pass,
+			Result:           r.CrossOriginResourceSharing.Result,
+			ScoreDescription: r.CrossOriginResourceSharing.ScoreDescription,
+			ScoreModifier:    r.CrossOriginResourceSharing.ScoreModifier,
+		},
+		{
+			Expectation:      r.PublicKeyPinning.Expectation,
+			Name:             TestPublicKeyPinning,
+			Pass:             r.PublicKeyPinning.Pass,
+			Result:           r.PublicKeyPinning.Result,
+			ScoreDescription: r.PublicKeyPinning.ScoreDescription,
+			ScoreModifier:    r.PublicKeyPinning.ScoreModifier,
+		},
+		{
+			Expectation:      r.Redirection.Expectation,
+			Name:             TestRedirection,
+			Pass:             r.Redirection.Pass,
+			Result:           r.Redirection.Result,
+			ScoreDescription: r.Redirection.ScoreDescription,
+			ScoreModifier:    r.Redirection.ScoreModifier,
+		},
+		{
+			Expectation:      r.StrictTransportSecurity.Expectation,
+			Name:             TestStrictTransportSecurity,
+			Pass:             r.StrictTransportSecurity.Pass,
+			Result:           r.StrictTransportSecurity.Result,
+			ScoreDescription: r.StrictTransportSecurity.ScoreDescription,
+			ScoreModifier:    r.StrictTransportSecurity.ScoreModifier,
+		},
+		{
+			Expectation:      r.SubresourceIntegrity.Expectation,
+			Name:             TestSubresourceIntegrity,
+			Pass:             r.SubresourceIntegrity.Pass,
+			Result:           r.SubresourceIntegrity.Result,
+			ScoreDescription: r.SubresourceIntegrity.ScoreDescription,
+			ScoreModifier:    r.SubresourceIntegrity.ScoreModifier,
+		},
+		{
+			Expectation:      r.XContentTypeOptions.Expectation,
+			Name:             TestXContentTypeOptions,
+			Pass:             r.XContentTypeOptions.Pass,
+			Result:           r.XContentTypeOptions.Result,
+			ScoreDescription: r.XContentTypeOptions.ScoreDescription,
+			ScoreModifier:    r.XContentTypeOptions.ScoreModifier,
+		},
+		{
+			Expectation:      r.XFrameOptions.Expectation,
+			Name:             TestXFrameOptions,
+			Pass:             r.XFrameOptions.Pass,
+			Result:           r.XFrameOptions.Result,
+			ScoreDescription: r.XFrameOptions.ScoreDescription,
+			ScoreModifier:    r.XFrameOptions.ScoreModifier,
+		},
+		{
+			Expectation:      r.XXssProtection.Expectation,
+			Name:             TestXXssProtection,
+			Pass:             r.XXssProtection.Pass,
+			Result:           r.XXssProtection.Result,
+			ScoreDescription: r.XXssProtection.ScoreDescription,
+			ScoreModifier:    r.XXssProtection.ScoreModifier,
+		},
+	}
+}
+
+// Scan hold both the summarized and the detailed result of a scan.
+type Scan struct {
+	Result *ScannerResult     `json:"result"`
+	Tests  *ScannerTestResult `json:"tests"`
+}
@@ -0,0 +1,102 @@
+package types
+
+import "time"
+
+// ScannerStats hold the statistics of HTTP Observatory.
+type ScannerStats struct {
+	GradeDistribution struct {
+		// grade of the latest scan of each site
+		Latest ScannerGradeDistribution `json:"latest"`
+		// grade of every scan
+		All ScannerGradeDistribution `json:"all"`
+	} `json:"gradeDistribution"`
+	// number of sites by how many grades they gained, or lost if negative, since their first scan
+	GradeImprovements map[string]int   `json:"gradeImprovements"`
+	Misc              ScannerMiscStats `json:"misc"`
+	Recent            struct {
+		Scans struct {
+			// most recent scans with a score of at least 90
+			Best ScannerRecentScans `json:"best"`
+			// most recent scans
+			Recent ScannerRecentScans `json:"recent"`
+			// most recent scans with a score of at most 20
+			Worst ScannerRecentScans `json:"worst"`
+			// number of scans by hour, as returned by the api, verbose mode only
+			NumPerHourLast24Hours map[string]int `json:"numPerHourLast24Hours"`
+		} `json:"scans"`
+	} `json:"recent"`
+	// number of scans in each state
+	States ScannerStates `json:"states"`
+	// number of scans per hour over the last 24 hours, oldest first, verbose mode only
+	ScansPerHour ScanSeries `json:"-"`
+}
+
+// ScannerMiscStats hold the overall counters of HTTP Observatory. The counters over the last 24 hours are -1
+// unless the statistics are verbose.
+type ScannerMiscStats struct {
+	MostRecentScanDate                string `json:"mostRecentScanDate"`
+	NumHoursWithoutScansInLast24Hours int    `json:"numHoursWithoutScansInLast24Hours"`
+	NumImprovedSites                  int    `json:"numImprovedSites"`
+	NumScans                          int    `json:"numScans"`
+	NumScansLast24Hours               int    `json:"numScansLast24Hours"`
+	NumSuccessfulScans                int    `json:"numSuccessfulScans"`
+	NumUniqueSites                    int    `json:"numUniqueSites"`
+}
+
+// ScannerStates hold the number of scans in each state.
+type ScannerStates struct {
+	Aborted  int `json:"ABORTED"`
+	Failed   int `json:"FAILED"`
+	Finished int `json:"FINISHED"`
+	Pending  int `json:"PENDING"`
+	Running  int `json:"RUNNING"`
+	Starting int `json:"STARTING"`
+}
+
+// Queued return the number of scans waiting for or being processed by the scanner.
+func (s ScannerStates) Queued() int {
+	return s.Pending + s.Starting + s.Running
+}
+
+// HourlyScans is the number of scans started during an hour.
+type HourlyScans struct {
+	// start of the hour
+	Hour  time.Time `json:"hour"`
+	Count int       `json:"count"`
+}
+
+// ScanSeries is a time series of hourly scan counts, oldest first and without gap.
+type ScanSeries []HourlyScans
+
+// Total return the number of scans of the series.
+func (s ScanSeries) Total() int {
+	total := 0
+	for _, h := range s {
+		total += h.Count
+	}
+	return total
+}
+
+// Peak return the hour with the most scans, the latest one on ties. It returns false if the series is empty.
+func (s ScanSeries) Peak() (HourlyScans, bool) {
+	return s.find(func(count, best int) bool { return count >= best })
+}
+
+// Quietest return the hour with the fewest scans, the latest one on ties. It returns false if the series is
+// empty.
+func (s ScanSeries) Quietest() (HourlyScans, bool) {
+	return s.find(func(count, best int) bool { return count <= best })
+}
+
+func (s ScanSeries) find(better func(count, best int) bool) (HourlyScans, bool) {
+	if len(s) == 0 {
+		return HourlyScans{}, false
+	}
+	best := s[0]
+	for _, h := range s[1:] {
+		if better(h.Count, best.Count) {
+			best = h
+		}
+	}
+	return best, true
+}
@@ -0,0 +1,263 @@
+package observatory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/tigerwill90/observatory/grader"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// v2Scan is a scan as returned by the v2 api.
+type v2Scan struct {
+	ID               types.ScanID `json:"id"`
+	DetailsURL       string       `json:"details_url"`
+	AlgorithmVersion int          `json:"algorithm_version"`
+	ScannedAt        string       `json:"scanned_at"`
+	Error            *string      `json:"error"`
+	Grade            string       `json:"grade"`
+	StatusCode       int          `json:"status_code"`
+	Score            int          `json:"score"`
+	TestsFailed      int          `json:"tests_failed"`
+	TestsPassed      int          `json:"tests_passed"`
+	TestsQuantity    int          `json:"tests_quantity"`
+}
+
+type v2History struct {
+	ID        types.ScanID `json:"id"`
+	ScannedAt string       `json:"scanned_at"`
+	Grade     string       `json:"grade"`
+	Score     int          `json:"score"`
+}
+
+// v2Analysis is the latest scan of a host, with its tests and the previous scans.
+type v2Analysis struct {
+	Scan    v2Scan                      `json:"scan"`
+	Tests   map[string]types.TestDetail `json:"tests"`
+	History []v2History                 `json:"history"`
+}
+
+type v2GradeCount struct {
+	Grade string `json:"grade"`
+	Count int    `json:"count"`
+}
+
+// analysis is a v2 analysis mapped onto the v1 types.
+type analysis struct {
+	result  *types.ScannerResult
+	tests   *types.ScannerTestResult
+	history []*types.ScannerHostHistory
+}
+
+// scanV2 invoke a scan, which is synchronous with the v2 api.
+// https://developer.mozilla.org/en-US/observatory/docs/api#invoke_a_scan
+func (c *Client) scanV2(ctx context.Context, host string) (*types.ScannerResult, error) {
+	queryParams := url.Values{}
+	queryParams.Set("host", host)
+
+	reqConfig := request{
+		method:      "POST",
+		apiCall:     ApiCallScan,
+		queryParams: queryParams,
+	}
+	scan := new(v2Scan)
+	if err := c.doRequest(ctx, reqConfig, scan); err != nil {
+		return nil, err
+	}
+
+	result := scan.result()
+	c.scans.set(host, result.ScanID)
+	if err := checkScannerError(result.State); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, result.Error)
+	}
+	c.cacheAssessment(host, result)
+	return result, nil
+}
+
+// analysisV2 retrieve the latest scan of a host, and refresh the cache with it and its tests.
+// https://developer.mozilla.org/en-US/observatory/docs/api#retrieve_the_latest_scan
+func (c *Client) analysisV2(ctx context.Context, host string) (*analysis, error) {
+	queryParams := url.Values{}
+	queryParams.Set("host", host)
+
+	reqConfig := request{
+		method:      "GET",
+		apiCall:     ApiCallAnalyze,
+		queryParams: queryParams,
+	}
+	resp := new(v2Analysis)
+	if err := c.doRequest(ctx, reqConfig, resp); err != nil {
+		return nil, err
+	}
+
+	tests, err := testResult(resp.Tests)
+	if err != nil {
+		return nil, err
+	}
+	a := &analysis{
+		result:  resp.Scan.result(),
+		tests:   tests,
+		history: make([]*types.ScannerHostHistory, 0, len(resp.History)),
+	}
+	for _, h := range resp.History {
+		scannedAt, _ := time.Parse(time.RFC3339, h.ScannedAt)
+		a.history = append(a.history, &types.ScannerHostHistory{
+			EndTime:              httpTime(h.ScannedAt),
+			EndTimeUnixTimestamp: int(scannedAt.Unix()),
+			Grade:                h.Grade,
+			ScanId:               h.ID,
+			Score:                h.Score,
+		})
+	}
+
+	c.scans.set(host, a.result.ScanID)
+	if err := checkScannerError(a.result.State); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, a.result.Error)
+	}
+	c.cacheAssessment(host, a.result)
+	if hasTestResults(a.tests) {
+		c.cacheSet(c.testResultsKey(a.result.ScanID), a.tests, 0)
+	}
+	return a, nil
+}
+
+// testResultsV2 retrieve the tests of a scan. The v2 api only return the tests of the latest scan of a host, so
+// the scan must be the latest one retrieved by the client for its host.
+func (c *Client) testResultsV2(ctx context.Context, scanID types.ScanID) (*types.ScannerTestResult, error) {
+	host, ok := c.scans.host(scanID)
+	if !ok {
+		return nil, fmt.Errorf("%w: scan %d is not the latest scan of a host retrieved by the client", ErrUnsupported, scanID)
+	}
+	a, err := c.analysisV2(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if a.result.ScanID != scanID {
+		return nil, fmt.Errorf("%w: scan %d is no longer the latest scan of %s", ErrUnsupported, scanID, host)
+	}
+	return a.tests, nil
+}
+
+// gradeDistributionV2 retrieve the number of scans of each grade.
+func (c *Client) gradeDistributionV2(ctx context.Context) (*types.ScannerGradeDistribution, error) {
+	counts := make([]v2GradeCount, 0)
+	if err := c.doRequest(ctx, request{method: "GET", apiCall: ApiCallGradeDistribution}, &counts); err != nil {
+		return nil, err
+	}
+
+	distribution := new(types.ScannerGradeDistribution)
+	fields := map[string]*int{
+		"A+": &distribution.A, "A": &distribution.A1, "A-": &distribution.A2,
+		"B+": &distribution.B, "B": &distribution.B1, "B-": &distribution.B2,
+		"C+": &distribution.C, "C": &distribution.C1, "C-": &distribution.C2,
+		"D+": &distribution.D, "D": &distribution.D1, "D-": &distribution.D2,
+		"F": &distribution.F,
+	}
+	for _, count := range counts {
+		if field, ok := fields[count.Grade]; ok {
+			*field += count.Count
+		}
+	}
+	return distribution, nil
+}
+
+// result map a v2 scan onto a v1 result. A v2 scan is finished once returned, unless it failed.
+func (s *v2Scan) result() *types.ScannerResult {
+	result := &types.ScannerResult{
+		EndTime:             httpTime(s.ScannedAt),
+		Grade:               s.Grade,
+		ScanID:              s.ID,
+		Score:               s.Score,
+		LikelihoodIndicator: grader.Likelihood(s.Grade),
+		StartTime:           httpTime(s.ScannedAt),
+		State:               Finished,
+		TestsFailed:         s.TestsFailed,
+		TestsPassed:         s.TestsPassed,
+		TestsQuantity:       s.TestsQuantity,
+		DetailsURL:          s.DetailsURL,
+		AlgorithmVersion:    s.AlgorithmVersion,
+		StatusCode:          s.StatusCode,
+	}
+	if s.Error != nil {
+		result.State = Failed
+		result.Error = *s.Error
+	}
+	return result
+}
+
+// testResult map the v2 tests onto a v1 test result. Only the fields shared by every test are mapped, since
+// the test specific output differ between the two versions, and every v2 test is kept in Details.
+func testResult(tests map[string]types.TestDetail) (*types.ScannerTestResult, error) {
+	summaries := make(map[string]types.TestSummary, len(tests))
+	for name, test := range tests {
+		summaries[name] = test.TestSummary
+	}
+	buf, err := json.Marshal(summaries)
+	if err != nil {
+		return nil, err
+	}
+	result := new(types.ScannerTestResult)
+	if err := json.Unmarshal(buf, result); err != nil {
+		return nil, err
+	}
+	if len(tests) > 0 {
+		result.Details = tests
+	}
+	return result, nil
+}
+
+// httpTime convert an RFC 3339 timestamp of the v2 api to the format of the v1 api.
+func httpTime(ts string) string {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return ts
+	}
+	return t.UTC().Format(http.TimeFormat)
+}
+
+// maxScanHosts bound the number of hosts whose latest scan is remembered.
+const maxScanHosts = 4096
+
+// scanHosts remember the latest scan of each host, since the v2 api retrieve test results by host.
+type scanHosts struct {
+	mu    sync.Mutex
+	hosts map[types.ScanID]string
+	scans map[string]types.ScanID
+	// hosts in insertion order, to evict the oldest ones
+	order []string
+}
+
+func newScanHosts() *scanHosts {
+	return &scanHosts{
+		hosts: make(map[types.ScanID]string),
+		scans: make(map[string]types.ScanID),
+	}
+}
+
+func (s *scanHosts) set(host string, scanID types.ScanID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if previous, ok := s.scans[host]; ok {
+		delete(s.hosts, previous)
+	} else {
+		s.order = append(s.order, host)
+	}
+	s.scans[host] = scanID
+	s.hosts[scanID] = host
+	for len(s.order) > maxScanHosts {
+		delete(s.hosts, s.scans[s.order[0]])
+		delete(s.scans, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+func (s *scanHosts) host(scanID types.ScanID) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	host, ok := s.hosts[scanID]
+	return host, ok
+}
@@ -0,0 +1,229 @@
+package observatory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tigerwill90/observatory/cache"
+	"github.com/tigerwill90/observatory/option"
+	"github.com/tigerwill90/observatory/types"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const v2ScanResponse = `{
+  "id": 51278373,
+  "details_url": "https://developer.mozilla.org/en-US/observatory/analyze?host=observatory.mozilla.org",
+  "algorithm_version": 4,
+  "scanned_at": "2024-08-07T11:42:10.017Z",
+  "error": null,
+  "grade": "B+",
+  "status_code": 200,
+  "score": 80,
+  "tests_failed": 1,
+  "tests_passed": 9,
+  "tests_quantity": 10
+}`
+
+const v2AnalyzeResponse = `{
+  "scan": ` + v2ScanResponse + `,
+  "tests": {
+    "content-security-policy": {
+      "expectation": "csp-implemented-with-no-unsafe",
+      "name": "content-security-policy",
+      "title": "Content Security Policy (CSP)",
+      "link": "https://developer.mozilla.org/en-US/docs/Web/HTTP/CSP",
+      "pass": false,
+      "result": "csp-not-implemented",
+      "score_description": "Content Security Policy (CSP) header not implemented",
+      "score_modifier": -25,
+      "recommendation": "Implement one, see MDN's Content Security Policy (CSP) documentation.",
+      "data": null
+    },
+    "strict-transport-security": {
+      "expectation": "hsts-implemented-max-age-at-least-six-months",
+      "name": "strict-transport-security",
+      "title": "Strict Transport Security (HSTS)",
+      "pass": true,
+      "result": "hsts-implemented-max-age-at-least-six-months",
+      "score_modifier": 0,
+      "data": {"max-age": 63072000}
+    },
+    "referrer-policy": {
+      "expectation": "referrer-policy-private",
+      "name": "referrer-policy",
+      "title": "Referrer Policy",
+      "pass": true,
+      "result": "referrer-policy-private",
+      "score_modifier": 5
+    }
+  },
+  "history": [
+    {"id": 51278000, "scanned_at": "2024-08-01T08:00:00Z", "grade": "B", "score": 70},
+    {"id": 51278373, "scanned_at": "2024-08-07T11:42:10.017Z", "grade": "B+", "score": 80}
+  ]
+}`
+
+func newV2Server(t *testing.T, calls *uint32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddUint32(calls, 1)
+		var body string
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/"+ApiCallScan:
+			assert.Equal(t, "observatory.mozilla.org", r.URL.Query().Get("host"))
+			body = v2ScanResponse
+		case r.Method == http.MethodGet && r.URL.Path == "/"+ApiCallAnalyze:
+			assert.Equal(t, "observatory.mozilla.org", r.URL.Query().Get("host"))
+			body = v2AnalyzeResponse
+		case r.Method == http.MethodGet && r.URL.Path == "/"+ApiCallGradeDistribution:
+			body = `[{"grade": "A+", "count": 3}, {"grade": "F", "count": 46770}]`
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+}
+
+func TestClientV2Analyze(t *testing.T) {
+	var calls uint32
+	srv := newV2Server(t, &calls)
+	defer srv.Close()
+	c := NewCustomClient(srv.Client(), srv.URL, option.WithAPIVersion(option.APIv2))
+
+	result, err := c.Analyze(context.Background(), "observatory.mozilla.org", option.WaitFinished(true, 0), option.HideResult(true))
+	require.Nil(t, err)
+	assert.Equal(t, &types.ScannerResult{
+		EndTime:             "Wed, 07 Aug 2024 11:42:10 GMT",
+		Grade:               "B+",
+		ScanID:              51278373,
+		Score:               80,
+		LikelihoodIndicator: "MEDIUM",
+		StartTime:           "Wed, 07 Aug 2024 11:42:10 GMT",
+		State:               Finished,
+		TestsFailed:         1,
+		TestsPassed:         9,
+		TestsQuantity:       10,
+		DetailsURL:          "https://developer.mozilla.org/en-US/observatory/analyze?host=observatory.mozilla.org",
+		AlgorithmVersion:    4,
+		StatusCode:          200,
+	}, result)
+
+	tests, err := c.GetTestResults(context.Background(), result.ScanID)
+	require.Nil(t, err)
+	assert.Equal(t, "csp-not-implemented", tests.ContentSecurityPolicy.Result)
+	assert.Equal(t, -25, tests.ContentSecurityPolicy.ScoreModifier)
+	assert.False(t, tests.ContentSecurityPolicy.Pass)
+	assert.True(t, tests.StrictTransportSecurity.Pass)
+	assert.Empty(t, tests.XFrameOptions.Result)
+	require.Len(t, tests.Details, 3)
+	assert.Equal(t, "Content Security Policy (CSP)", tests.Details[types.TestContentSecurityPolicy].Title)
+	assert.Equal(t, "https://developer.mozilla.org/en-US/docs/Web/HTTP/CSP", tests.Details[types.TestContentSecurityPolicy].Link)
+	assert.NotEmpty(t, tests.Details[types.TestContentSecurityPolicy].Recommendation)
+	assert.Equal(t, map[string]interface{}{"max-age": float64(63072000)}, tests.Details[types.TestStrictTransportSecurity].Data)
+	assert.Equal(t, 5, tests.Details["referrer-policy"].ScoreModifier)
+	assert.Equal(t, uint32(2), atomic.LoadUint32(&calls))
+
+	_, err = c.GetTestResults(context.Background(), 42)
+	assert.ErrorIs(t, err, ErrUnsupported)
+
+	_, err = c.GetRecentScans(context.Background(), option.WithMinScore(90))
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestClientV2AnalyzeFailed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 1, "scanned_at": "2024-08-07T11:42:10Z", "error": "site down", "grade": null, "score": null}`)
+	}))
+	defer srv.Close()
+	c := NewCustomClient(srv.Client(), srv.URL, option.WithAPIVersion(option.APIv2))
+
+	_, err := c.Analyze(context.Background(), "down.example.com")
+	assert.ErrorIs(t, err, ErrScannerFailed)
+	assert.Contains(t, err.Error(), "site down")
+}
+
+func TestClientV2GetAssessment(t *testing.T) {
+	var calls uint32
+	srv := newV2Server(t, &calls)
+	defer srv.Close()
+	c := NewCustomClient(srv.Client(), srv.URL, option.WithAPIVersion(option.APIv2), option.WithCache(cache.NewLRU(10)))
+
+	result, err := c.GetAssessment(context.Background(), "observatory.mozilla.org")
+	require.Nil(t, err)
+	assert.Equal(t, types.ScanID(51278373), result.ScanID)
+	assert.Equal(t, "B+", result.Grade)
+
+	// The tests of the assessment are cached, and test results are retrieved without a request.
+	tests, err := c.GetTestResults(context.Background(), result.ScanID)
+	require.Nil(t, err)
+	assert.Equal(t, "csp-not-implemented", tests.ContentSecurityPolicy.Result)
+	assert.Equal(t, uint32(1), atomic.LoadUint32(&calls))
+
+	history, err := c.GetScanHistory(context.Background(), "observatory.mozilla.org")
+	require.Nil(t, err)
+	assert.Equal(t, []*types.ScannerHostHistory{
+		{EndTime: "Thu, 01 Aug 2024 08:00:00 GMT", EndTimeUnixTimestamp: 1722499200, Grade: "B", ScanId: 51278000, Score: 70},
+		{EndTime: "Wed, 07 Aug 2024 11:42:10 GMT", EndTimeUnixTimestamp: 1723030930, Grade: "B+", ScanId: 51278373, Score: 80},
+	}, history)
+}
+
+func TestClientV2AnalyzeCached(t *testing.T) {
+	var calls uint32
+	srv := newV2Server(t, &calls)
+	defer srv.Close()
+	c := NewCustomClient(srv.Client(), srv.URL, option.WithAPIVersion(option.APIv2), option.WithCache(cache.NewLRU(10)))
+	c.cacheSet(c.assessmentKey("observatory.mozilla.org"), &types.ScannerResult{ScanID: 51278373, State: Finished}, time.Hour)
+
+	// The assessment is served from the cache, and the host of its scan is still known to retrieve its tests.
+	result, err := c.Analyze(context.Background(), "observatory.mozilla.org")
+	require.Nil(t, err)
+	assert.Equal(t, types.ScanID(51278373), result.ScanID)
+	assert.Equal(t, uint32(0), atomic.LoadUint32(&calls))
+	tests, err := c.GetTestResults(context.Background(), result.ScanID)
+	require.Nil(t, err)
+	assert.Equal(t, "csp-not-implemented", tests.ContentSecurityPolicy.Result)
+}
+
+func TestScanHostsBound(t *testing.T) {
+	s := newScanHosts()
+	for i := 0; i <= maxScanHosts; i++ {
+		s.set(fmt.Sprintf("%d.example.com", i), types.ScanID(i+1))
+	}
+	s.set("1.example.com", maxScanHosts+2)
+	assert.Len(t, s.scans, maxScanHosts)
+	assert.Len(t, s.hosts, maxScanHosts)
+	_, ok := s.host(1)
+	assert.False(t, ok)
+	host, ok := s.host(maxScanHosts + 2)
+	assert.True(t, ok)
+	assert.Equal(t, "1.example.com", host)
+}
+
+func TestClientV2GetGradeDistribution(t *testing.T) {
+	var calls uint32
+	srv := newV2Server(t, &calls)
+	defer srv.Close()
+	c := NewCustomClient(srv.Client(), srv.URL, option.WithAPIVersion(option.APIv2))
+
+	distribution, err := c.GetGradeDistribution(context.Background())
+	require.Nil(t, err)
+	assert.Equal(t, &types.ScannerGradeDistribution{A: 3, F: 46770}, distribution)
+}
+
+func TestTestResultJSON(t *testing.T) {
+	// Details are omitted for v1 results, so that stored v1 results are unchanged.
+	buf, err := json.Marshal(new(types.ScannerTestResult))
+	require.Nil(t, err)
+	assert.NotContains(t, string(buf), "details")
+}
+
+func TestNewClientV2(t *testing.T) {
+	assert.Equal(t, EndpointV2, NewClient(option.WithAPIVersion(option.APIv2)).url)
+	assert.Equal(t, Endpoint, NewClient().url)
+}